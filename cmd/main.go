@@ -2,32 +2,161 @@ package main
 
 import (
 	"context"
+	"loadbalancer/internal/admin"
 	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/clientip"
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
 	"loadbalancer/internal/server"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// configFile - путь к файлу конфигурации
+const configFile = "config.yaml"
+
 func main() {
-	conf, err := config.LoadConfig("config.yaml")
+	conf, err := config.LoadConfig(configFile)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-	log.Printf("Successful loading of the server configuration: %v\n", conf)
+	log.Printf("Successful loading of the server configuration: %s\n", conf.Summary())
 
-	backendPool := backend.NewPool(conf.Backends)
+	// Неизвестный lb_method отклоняем сразу при старте, а не на первом запросе
+	strategy, err := balancer.New(conf.LBMethod, balancer.Options{Hash: conf.Hash})
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	retryPolicy, err := server.NewRetryPolicy(conf.Retry)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	// заголовкам с IP клиента верим только от доверенных прокси
+	resolver, err := clientip.New(conf.ClientIP)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	clientip.SetDefault(resolver)
+	if err := bucket.Validate(conf); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	backendPool, err := newPool(conf, "default", conf.Backends, nil)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	upstreams := make(map[string]*backend.Pool, len(conf.Upstreams))
+	for _, up := range conf.Upstreams {
+		if up.Name == "" || up.Name == "default" || upstreams[up.Name] != nil {
+			log.Fatalf("Invalid config: upstream name %q must be unique and not empty", up.Name)
+		}
+		pool, err := newPool(conf, up.Name, up.Backends, up.HealthCheck)
+		if err != nil {
+			log.Fatalf("Invalid config: upstream %s: %v", up.Name, err)
+		}
+		upstreams[up.Name] = pool
+	}
 
 	// Контекст для корректной остановки программы
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Запускаем HealthCheck в горутине, для проверки статусов серверов
+	// Запускаем HealthCheck в горутине, для проверки статусов серверов, у каждого пула свои проверки
 	go backendPool.HealthCheck(ctx)
+	for _, pool := range upstreams {
+		go pool.HealthCheck(ctx)
+	}
+
+	// Административный API на отдельном порту
+	if conf.Admin.Enabled {
+		adminServer, err := admin.NewServer(conf.Admin, backendPool)
+		if err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		adminServer.Start()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ServerShutdownTimeoutSec*time.Second)
+			defer cancel()
+			if err := adminServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Admin API shutdown error: %v", err)
+			}
+		}()
+	}
+
+	lb := server.NewLoadBalancer(conf.Port, backendPool, strategy, retryPolicy)
+	for name, pool := range upstreams {
+		lb.AddUpstream(name, pool)
+	}
+	if err := lb.ConfigureRoutes(conf); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := lb.ConfigureHeaders(conf.Headers); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	// Перезагрузка конфига по SIGHUP и при изменении файла
+	go watchConfig(ctx, lb, conf.Reload)
 
 	// Запускаем сервер
-	lb := server.NewLoadBalancer(conf.Port, backendPool)
 	if err := lb.StartServer(conf); err != nil {
 		log.Fatal(err)
 	}
 
 }
+
+// newPool - пул серверов с общими настройками пассивной и активной проверок здоровья, выключателей и TLS.
+// healthCheck - переопределение общего health_check для всего пула (upstream), nil - без переопределения
+func newPool(conf *config.Config, name string, backends []config.Backend, healthCheck *config.HealthCheck) (*backend.Pool, error) {
+	pool := backend.NewPool(backends)
+	pool.EnableOutlierDetection(conf.OutlierDetection)
+	pool.EnableCircuitBreaker(conf.CircuitBreaker)
+	pool.RegisterMetrics(name)
+	if err := pool.ConfigureHealthCheck(conf.HealthCheck.Merge(healthCheck)); err != nil {
+		return nil, err
+	}
+	if err := pool.ConfigureUpstreamTLS(conf.UpstreamTLS); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// watchConfig - перечитывает конфиг по SIGHUP (и при изменении файла, если reload.watch_file)
+// и применяет его к работающему балансировщику; некорректный конфиг отклоняется, старый остаётся в силе
+func watchConfig(ctx context.Context, lb *server.LoadBalancer, reload config.Reload) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var fileChanges <-chan struct{}
+	if reload.WatchFile {
+		fileChanges = config.Watch(ctx, configFile, reload.Interval)
+	}
+
+	for {
+		select {
+		case <-hup:
+			log.Println("SIGHUP received, reloading config...")
+		case _, ok := <-fileChanges:
+			if !ok {
+				return
+			}
+			log.Printf("%s changed, reloading config...\n", configFile)
+		case <-ctx.Done():
+			return
+		}
+
+		conf, err := config.LoadConfig(configFile)
+		if err == nil {
+			err = lb.Reload(conf)
+		}
+		if err != nil {
+			log.Printf("ERROR: config reload rejected, keeping the current config: %v\n", err)
+		}
+	}
+}
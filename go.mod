@@ -1,5 +1,5 @@
 module loadbalancer
 
-go 1.23.8
+go 1.24
 
 require gopkg.in/yaml.v2 v2.4.0
@@ -0,0 +1,216 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/reqinfo"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted - значение поля из списка redact
+const redacted = "[REDACTED]"
+
+// allFields - поля записи журнала в порядке вывода
+var allFields = []string{
+	"time", "client_ip", "method", "path", "status", "bytes", "duration_ms",
+	"backend", "retries", "rate_limited",
+}
+
+// Logger - структурированный журнал доступа (JSON или logfmt), одна строка на запрос
+type Logger struct {
+	out        io.Writer
+	closer     io.Closer // файл журнала, nil для stdout
+	logfmt     bool
+	sampleRate float64
+	fields     []string
+	redact     map[string]struct{}
+	mux        sync.Mutex // строки от разных запросов не перемешиваются
+}
+
+// New - создаёт журнал по настройкам access_log
+func New(conf config.AccessLog) (*Logger, error) {
+	l := &Logger{
+		out:        os.Stdout,
+		sampleRate: conf.SampleRate,
+		fields:     allFields,
+		redact:     make(map[string]struct{}),
+	}
+
+	switch conf.Format {
+	case "", "json":
+	case "logfmt":
+		l.logfmt = true
+	default:
+		return nil, fmt.Errorf("access_log: unknown format %q, expected json|logfmt", conf.Format)
+	}
+
+	if conf.SampleRate < 0 || conf.SampleRate > 1 {
+		return nil, fmt.Errorf("access_log: sample_rate must be in [0, 1], got %v", conf.SampleRate)
+	}
+	if conf.SampleRate == 0 {
+		l.sampleRate = 1
+	}
+
+	known := make(map[string]struct{}, len(allFields))
+	for _, field := range allFields {
+		known[field] = struct{}{}
+	}
+	if len(conf.Fields) > 0 {
+		l.fields = nil
+		for _, field := range conf.Fields {
+			if _, ok := known[field]; !ok {
+				return nil, fmt.Errorf("access_log: unknown field %q", field)
+			}
+			l.fields = append(l.fields, field)
+		}
+	}
+	for _, field := range conf.Redact {
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("access_log: unknown redact field %q", field)
+		}
+		l.redact[field] = struct{}{}
+	}
+
+	if conf.Output != "" && conf.Output != "stdout" {
+		file, err := newRotatingFile(conf.Output, int64(conf.MaxSizeMB)<<20, conf.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("access_log: %w", err)
+		}
+		l.out, l.closer = file, file
+	}
+	return l, nil
+}
+
+// Close - закрывает файл журнала
+func (l *Logger) Close() error {
+	if l.closer != nil {
+		return l.closer.Close()
+	}
+	return nil
+}
+
+// Middleware - оборачивает обработчик и пишет запись о каждом запросе (с учётом sample_rate)
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.sampleRate < 1 && rand.Float64() >= l.sampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ctx, info := reqinfo.New(r.Context())
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		ip, err := clientip.Get(r)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		l.write(map[string]any{
+			"time":         start.UTC().Format(time.RFC3339Nano),
+			"client_ip":    ip,
+			"method":       r.Method,
+			"path":         r.URL.Path,
+			"status":       rw.status,
+			"bytes":        rw.bytes,
+			"duration_ms":  float64(time.Since(start).Microseconds()) / 1000,
+			"backend":      info.Backend,
+			"retries":      info.Retries,
+			"rate_limited": info.RateLimited,
+		})
+	})
+}
+
+// write - форматирует запись в выбранном формате и пишет одной строкой
+func (l *Logger) write(entry map[string]any) {
+	var buf bytes.Buffer
+	if l.logfmt {
+		for i, field := range l.fields {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(field)
+			buf.WriteByte('=')
+			buf.WriteString(logfmtValue(l.value(entry, field)))
+		}
+	} else {
+		buf.WriteByte('{')
+		for i, field := range l.fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(field)
+			value, _ := json.Marshal(l.value(entry, field))
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+func (l *Logger) value(entry map[string]any, field string) any {
+	if _, ok := l.redact[field]; ok {
+		return redacted
+	}
+	return entry[field]
+}
+
+// logfmtValue - значение в logfmt, строки с пробелами, кавычками и '=' берутся в кавычки
+func logfmtValue(v any) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \"=\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// responseWriter - запоминает код ответа и количество отправленных байт
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush - нужен ReverseProxy для потоковых ответов (SSE и т.п.)
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap - для http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,94 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile - файл журнала, который при достижении maxBytes переименовывается в <path>.1
+// (старые копии сдвигаются до <path>.<maxBackups>, самая старая удаляется)
+type rotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mux  sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxBytes int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write - пишет запись целиком, перед этим ротируя файл, если запись не помещается
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate - сдвигает старые копии и начинает файл заново. Если сдвинуть не удалось,
+// файл открывается снова на дозапись, чтобы следующие записи не уходили в закрытый файл
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err == nil {
+		err = f.shift()
+	}
+	if openErr := f.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shift - переименовывает <path>.i в <path>.i+1 и текущий файл в <path>.1,
+// без копий (max_backups: 0) просто обрезает файл
+func (f *rotatingFile) shift() error {
+	if f.maxBackups <= 0 {
+		return os.Truncate(f.path, 0)
+	}
+	if err := os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// Close - закрывает файл журнала
+func (f *rotatingFile) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.file.Close()
+}
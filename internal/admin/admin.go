@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	stderrors "errors"
+	"gopkg.in/yaml.v2"
+	"io"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPort  = 9090
+	defaultBind  = "127.0.0.1" // API меняет пул, поэтому по умолчанию доступен только с этой машины
+	maxBodyBytes = 1 << 20     // ограничение на размер тела запроса к API
+	sampleToken  = "change-me" // токен из примеров конфига, известен всем
+)
+
+// Server - административный HTTP API на отдельном порту для управления пулом серверов на лету
+type Server struct {
+	pool   *backend.Pool
+	token  []byte
+	server *http.Server
+}
+
+// BackendStatus - состояние сервера пула в ответах API
+type BackendStatus struct {
+	URL            string  `json:"url"`
+	Weight         int     `json:"weight"`
+	Alive          bool    `json:"alive"`
+	Ejected        bool    `json:"ejected"`
+	Draining       bool    `json:"draining"`
+	Circuit        string  `json:"circuit"` // closed | open | half_open
+	ActiveConnects int     `json:"active_connects"`
+	LatencyMs      float64 `json:"latency_ms"`
+}
+
+// NewServer - конструктор административного API. Без admin.token или с токеном из примеров API не запускается
+func NewServer(conf config.Admin, pool *backend.Pool) (*Server, error) {
+	if conf.Token == "" {
+		return nil, stderrors.New("admin.token is required")
+	}
+	if conf.Token == sampleToken {
+		return nil, stderrors.New("admin.token must be changed from the sample value " + sampleToken)
+	}
+	if conf.Port == 0 {
+		conf.Port = defaultPort
+	}
+	if conf.Bind == "" {
+		conf.Bind = defaultBind
+	}
+	s := &Server{pool: pool, token: []byte(conf.Token)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /backends", s.listBackends)
+	mux.HandleFunc("POST /backends", s.addBackend)
+	mux.HandleFunc("DELETE /backends", s.removeBackend)
+	mux.HandleFunc("POST /backends/drain", s.drainBackend)
+
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(conf.Bind, strconv.Itoa(conf.Port)),
+		Handler: s.authorize(mux),
+	}
+	return s, nil
+}
+
+// Start - запускает API в горутине
+func (s *Server) Start() {
+	go func() {
+		log.Printf("Admin API started on %s\n", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin API error: %v", err)
+		}
+	}()
+}
+
+// Shutdown - останавливает API, дожидаясь завершения текущих запросов
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Addr - адрес, на котором слушает API
+func (s *Server) Addr() string {
+	return s.server.Addr
+}
+
+// Handler - обработчик API с проверкой токена, для встраивания в другой сервер (в тестах - в httptest.Server)
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// authorize - пропускает только запросы с заголовком Authorization: Bearer <admin.token>
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, errors.NewAPIError(http.StatusUnauthorized, "Invalid or missing admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listBackends - GET /backends - все сервера пула с их состоянием
+func (s *Server) listBackends(w http.ResponseWriter, r *http.Request) {
+	backends := s.pool.Backends()
+	statuses := make([]BackendStatus, 0, len(backends))
+	for _, b := range backends {
+		statuses = append(statuses, statusOf(b))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// addBackend - POST /backends {"url": "...", "weight": 1, "health_check": {...}}.
+// Тело - тот же элемент, что и в backends из config.yaml: JSON является YAML, поэтому
+// разбирается тем же кодом и с теми же именами полей ("interval": "5s" и т.д.)
+func (s *Server) addBackend(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes))
+	if err != nil {
+		writeError(w, errors.NewAPIError(http.StatusBadRequest, "Failed to read request body"))
+		return
+	}
+	var conf config.Backend
+	if err := yaml.Unmarshal(body, &conf); err != nil {
+		writeError(w, errors.NewAPIError(http.StatusBadRequest, "Invalid JSON: "+err.Error()))
+		return
+	}
+
+	b, err := s.pool.AddBackend(conf)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusCreated, statusOf(b))
+}
+
+// removeBackend - DELETE /backends?url=... - убирает сервер, его текущие запросы завершаются
+func (s *Server) removeBackend(w http.ResponseWriter, r *http.Request) {
+	b, err := s.pool.RemoveBackend(r.URL.Query().Get("url"))
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, statusOf(b))
+}
+
+// drainBackend - POST /backends/drain?url=...[&enabled=false] - новые запросы на сервер не идут,
+// текущие завершаются; по active_connects в ответе видно, когда сервер можно удалять
+func (s *Server) drainBackend(w http.ResponseWriter, r *http.Request) {
+	draining := true
+	if enabled := r.URL.Query().Get("enabled"); enabled != "" {
+		var err error
+		if draining, err = strconv.ParseBool(enabled); err != nil {
+			writeError(w, errors.NewAPIError(http.StatusBadRequest, "Invalid 'enabled' parameter"))
+			return
+		}
+	}
+
+	b, err := s.pool.DrainBackend(r.URL.Query().Get("url"), draining)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, statusOf(b))
+}
+
+func statusOf(b *backend.Backend) BackendStatus {
+	return BackendStatus{
+		URL:            b.URL.String(),
+		Weight:         b.Weight,
+		Alive:          b.IsAlive(),
+		Ejected:        b.IsEjected(),
+		Draining:       b.IsDraining(),
+		Circuit:        b.CircuitState().String(),
+		ActiveConnects: b.GetActiveConnects(),
+		LatencyMs:      float64(b.GetLatency().Microseconds()) / 1000,
+	}
+}
+
+// toAPIError - ошибки пула в HTTP-коды
+func toAPIError(err error) *errors.APIError {
+	switch {
+	case stderrors.Is(err, backend.ErrBackendNotFound):
+		return errors.NewAPIError(http.StatusNotFound, err.Error())
+	case stderrors.Is(err, backend.ErrBackendExists):
+		return errors.NewAPIError(http.StatusConflict, err.Error())
+	default:
+		return errors.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, apiErr *errors.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	w.Write(apiErr.ToJSON())
+}
@@ -1,18 +1,41 @@
 package backend
 
 import (
+	"context"
+	"loadbalancer/internal/config"
+	"math"
+	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// latencyDecay - вес нового замера в EWMA времени ответа
+const latencyDecay = 0.3
+
 // Backend - один из списка серверов для получения запросов
 type Backend struct {
 	URL            *url.URL
 	Alive          bool // флаг доступности сервера
+	Weight         int  // вес сервера для lb-метода WRR (не меньше 1)
 	ReverseProxy   *httputil.ReverseProxy
-	activeConnects int32 // счетчик активных подключений (для lb-метода leastConnections)
+	activeConnects int32            // счетчик активных подключений (для lb-метода leastConnections)
+	latencyBits    uint64           // EWMA времени ответа в наносекундах, биты float64 (для lb-метода EWMA)
+	outlier        *outlierDetector // пассивная проверка здоровья, nil - выключена
+	outlierState   outlierState
+	breaker        *circuitBreaker     // автоматический выключатель, nil - выключен
+	healthOverride *config.HealthCheck // настройки активной проверки здоровья именно этого сервера
+	health         *healthSettings     // итоговые настройки активной проверки (общие + healthOverride)
+	stopProbe      context.CancelFunc  // останавливает активную проверку сервера при удалении из пула
+	tlsOverride    *config.UpstreamTLS // настройки TLS до именно этого сервера
+	transport      *http.Transport     // транспорт прокси и http-проверок здоровья
+	grpcTransport  *http.Transport     // HTTP/2 транспорт для grpc-проверок здоровья
+	tuning         *config.Transport   // настройки соединений с сервером
+	maxConns       int32               // лимит одновременных соединений из transport.max_conns, 0 - без ограничения
+	draining       int32               // 1 - новые запросы на сервер не отправляются
+	dynamic        bool                // добавлен через административный API, а не из конфига; меняется под Pool.mux
 	mux            sync.RWMutex
 }
 
@@ -30,6 +53,20 @@ func (b *Backend) IsAlive() bool {
 	return b.Alive
 }
 
+// SetDraining - включает/выключает вывод сервера из работы: новые запросы не отправляются, текущие завершаются
+func (b *Backend) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&b.draining, v)
+}
+
+// IsDraining - выводится ли сервер из работы
+func (b *Backend) IsDraining() bool {
+	return atomic.LoadInt32(&b.draining) == 1
+}
+
 // Далее методы для реализации lb-метода leastConnections
 
 // IncrementConn - увеличивает счетчик активных подключений к бэкенду
@@ -46,3 +83,29 @@ func (b *Backend) DecrementConn() {
 func (b *Backend) GetActiveConnects() int {
 	return int(atomic.LoadInt32(&b.activeConnects))
 }
+
+// IsBusy - сервер уже обрабатывает max_conns запросов, новые будут ждать свободного соединения
+func (b *Backend) IsBusy() bool {
+	return b.maxConns > 0 && atomic.LoadInt32(&b.activeConnects) >= b.maxConns
+}
+
+// ObserveLatency - учитывает время ответа сервера в скользящем среднем (EWMA)
+func (b *Backend) ObserveLatency(d time.Duration) {
+	sample := float64(d)
+	for {
+		oldBits := atomic.LoadUint64(&b.latencyBits)
+		old := math.Float64frombits(oldBits)
+		ewma := sample // первый замер берём как есть
+		if oldBits != 0 {
+			ewma = old + latencyDecay*(sample-old)
+		}
+		if atomic.CompareAndSwapUint64(&b.latencyBits, oldBits, math.Float64bits(ewma)) {
+			return
+		}
+	}
+}
+
+// GetLatency - возвращает EWMA времени ответа сервера, 0 - замеров ещё не было
+func (b *Backend) GetLatency() time.Duration {
+	return time.Duration(math.Float64frombits(atomic.LoadUint64(&b.latencyBits)))
+}
@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"loadbalancer/internal/config"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Значения по умолчанию для circuit_breaker
+const (
+	defaultBreakerWindow              = 10 * time.Second
+	defaultBreakerMinRequests         = 20
+	defaultBreakerErrorRatePercent    = 50
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerOpenTimeout         = 30 * time.Second
+	defaultBreakerHalfOpenRequests    = 3
+
+	breakerBuckets = 10 // на сколько частей делится скользящее окно
+)
+
+// CircuitState - состояние автоматического выключателя сервера
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // запросы идут как обычно
+	CircuitOpen                         // запросы на сервер не отправляются
+	CircuitHalfOpen                     // пропускается несколько пробных запросов
+)
+
+// String - closed | open | half_open
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerSettings - разобранные настройки circuit_breaker, общие для всех серверов пула
+type breakerSettings struct {
+	window              time.Duration
+	minRequests         int
+	errorRatePercent    int
+	consecutiveFailures int
+	openTimeout         time.Duration
+	halfOpenRequests    int
+}
+
+// circuitBreaker - автоматический выключатель одного сервера. Размыкается по доле ошибок или
+// ошибкам подряд в скользящем окне, через open_timeout пропускает half_open_requests пробных
+// запросов и замыкается, если все они успешны. Не зависит от флага Alive активной проверки здоровья
+type circuitBreaker struct {
+	settings *breakerSettings
+	url      string
+
+	mux         sync.Mutex
+	state       CircuitState
+	openedAt    time.Time
+	buckets     [breakerBuckets]breakerBucket
+	consecutive int // ошибок подряд
+	trials      int // пробных запросов выпущено в полуоткрытом состоянии
+	successes   int // из них успешных
+}
+
+// breakerBucket - запросы и ошибки за одну часть окна
+type breakerBucket struct {
+	slot     int64 // номер интервала длиной window/breakerBuckets от начала эпохи
+	total    int
+	failures int
+}
+
+// EnableCircuitBreaker - включает автоматический выключатель для каждого сервера пула
+func (p *Pool) EnableCircuitBreaker(conf config.CircuitBreaker) {
+	if !conf.Enabled {
+		return
+	}
+
+	s := &breakerSettings{
+		window:              conf.Window,
+		minRequests:         conf.MinRequests,
+		errorRatePercent:    conf.ErrorRatePercent,
+		consecutiveFailures: conf.ConsecutiveFailures,
+		openTimeout:         conf.OpenTimeout,
+		halfOpenRequests:    conf.HalfOpenRequests,
+	}
+	if s.window <= 0 {
+		s.window = defaultBreakerWindow
+	}
+	if s.minRequests <= 0 {
+		s.minRequests = defaultBreakerMinRequests
+	}
+	if s.errorRatePercent <= 0 || s.errorRatePercent > 100 {
+		s.errorRatePercent = defaultBreakerErrorRatePercent
+	}
+	if s.consecutiveFailures <= 0 {
+		s.consecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if s.openTimeout <= 0 {
+		s.openTimeout = defaultBreakerOpenTimeout
+	}
+	if s.halfOpenRequests <= 0 {
+		s.halfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.breaker = s
+	for _, b := range p.backends {
+		b.breaker = newCircuitBreaker(s, b)
+	}
+}
+
+// newCircuitBreaker - выключатель сервера, nil - выключатели не включены
+func newCircuitBreaker(s *breakerSettings, b *Backend) *circuitBreaker {
+	if s == nil {
+		return nil
+	}
+	return &circuitBreaker{settings: s, url: b.URL.String()}
+}
+
+// CircuitState - текущее состояние выключателя сервера (closed, если выключатели не включены)
+func (b *Backend) CircuitState() CircuitState {
+	cb := b.breaker
+	if cb == nil {
+		return CircuitClosed
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	return cb.state
+}
+
+// CircuitAvailable - может ли выключатель пропустить запрос на сервер (для отбора кандидатов)
+func (b *Backend) CircuitAvailable() bool {
+	cb := b.breaker
+	if cb == nil {
+		return true
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		return time.Since(cb.openedAt) >= cb.settings.openTimeout
+	case CircuitHalfOpen:
+		return cb.trials < cb.settings.halfOpenRequests
+	default:
+		return true
+	}
+}
+
+// AllowRequest - пропускает запрос на выбранный сервер. В полуоткрытом состоянии занимает
+// одно из мест для пробных запросов, false - места закончились, нужно выбрать другой сервер
+func (b *Backend) AllowRequest() bool {
+	cb := b.breaker
+	if cb == nil {
+		return true
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.settings.openTimeout {
+		cb.state, cb.trials, cb.successes = CircuitHalfOpen, 0, 0
+		log.Printf("INFO: circuit breaker %s - half-open, allowing %d trial requests\n", cb.url, cb.settings.halfOpenRequests)
+	}
+
+	switch cb.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if cb.trials >= cb.settings.halfOpenRequests {
+			return false
+		}
+		cb.trials++
+		return true
+	default:
+		return true
+	}
+}
+
+// observeResult - учитывает ответ бэкенда (status) или ошибку транспорта (err)
+func (cb *circuitBreaker) observeResult(status int, err error) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	// клиент сам отменил запрос - сервер тут ни при чём, пробное место освобождается
+	if errors.Is(err, context.Canceled) {
+		if cb.state == CircuitHalfOpen && cb.trials > 0 {
+			cb.trials--
+		}
+		return
+	}
+	failure := err != nil || status >= http.StatusInternalServerError
+
+	switch cb.state {
+	case CircuitOpen:
+		// ответы на запросы, отправленные до размыкания
+	case CircuitHalfOpen:
+		if failure {
+			cb.open("trial request failed")
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.settings.halfOpenRequests {
+			cb.state = CircuitClosed
+			cb.consecutive = 0
+			cb.buckets = [breakerBuckets]breakerBucket{}
+			log.Printf("INFO: circuit breaker %s - closed after %d successful trial requests\n", cb.url, cb.successes)
+		}
+	default:
+		bucket := cb.bucket(time.Now())
+		bucket.total++
+		if !failure {
+			cb.consecutive = 0
+			return
+		}
+		bucket.failures++
+		cb.consecutive++
+
+		if cb.consecutive >= cb.settings.consecutiveFailures {
+			cb.open("consecutive failures")
+			return
+		}
+		total, failures := cb.counts(time.Now())
+		if total >= cb.settings.minRequests && failures*100 >= total*cb.settings.errorRatePercent {
+			cb.open("error rate")
+		}
+	}
+}
+
+// open - размыкает выключатель, вызывается под cb.mux
+func (cb *circuitBreaker) open(reason string) {
+	cb.state = CircuitOpen
+	cb.openedAt = time.Now()
+	log.Printf("WARN: circuit breaker %s - open for %v (%s)\n", cb.url, cb.settings.openTimeout, reason)
+}
+
+// bucket - часть окна для момента now, устаревшая часть обнуляется
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	slot := now.UnixNano() / int64(cb.settings.window/breakerBuckets)
+	bucket := &cb.buckets[slot%breakerBuckets]
+	if bucket.slot != slot {
+		*bucket = breakerBucket{slot: slot}
+	}
+	return bucket
+}
+
+// counts - запросы и ошибки за последнее окно
+func (cb *circuitBreaker) counts(now time.Time) (total, failures int) {
+	slot := now.UnixNano() / int64(cb.settings.window/breakerBuckets)
+	for _, bucket := range cb.buckets {
+		if bucket.slot > slot-breakerBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
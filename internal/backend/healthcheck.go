@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/metrics"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// healthSettings - разобранные настройки активной проверки здоровья одного сервера
+type healthSettings struct {
+	kind               string // http | tcp | grpc
+	grpcService        string
+	method             string
+	path               string
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+	statuses           []statusRange
+	body               *regexp.Regexp
+}
+
+type statusRange struct {
+	from, to int
+}
+
+// newHealthSettings - проверяет настройки health_check и заполняет значения по умолчанию
+func newHealthSettings(conf config.HealthCheck) (*healthSettings, error) {
+	s := &healthSettings{
+		kind:               strings.ToLower(conf.Type),
+		grpcService:        conf.GRPCService,
+		method:             strings.ToUpper(conf.Method),
+		path:               conf.Path,
+		interval:           conf.Interval,
+		timeout:            conf.Timeout,
+		healthyThreshold:   conf.HealthyThreshold,
+		unhealthyThreshold: conf.UnhealthyThreshold,
+	}
+	switch s.kind {
+	case "":
+		s.kind = "http"
+	case "http", "tcp", "grpc":
+	default:
+		return nil, fmt.Errorf("health_check: unknown type %q, expected http|tcp|grpc", conf.Type)
+	}
+	if s.method == "" {
+		s.method = http.MethodGet
+	}
+	if s.path == "" {
+		s.path = "/health"
+	}
+	if !strings.HasPrefix(s.path, "/") {
+		s.path = "/" + s.path
+	}
+	if s.interval <= 0 {
+		s.interval = 3 * time.Second
+	}
+	if s.timeout <= 0 {
+		s.timeout = 2 * time.Second
+	}
+	if s.healthyThreshold <= 0 {
+		s.healthyThreshold = 1
+	}
+	if s.unhealthyThreshold <= 0 {
+		s.unhealthyThreshold = 1
+	}
+
+	statuses := conf.ExpectedStatuses
+	if len(statuses) == 0 {
+		statuses = []string{"200"}
+	}
+	for _, status := range statuses {
+		r, err := parseStatusRange(status)
+		if err != nil {
+			return nil, err
+		}
+		s.statuses = append(s.statuses, r)
+	}
+
+	if conf.ExpectedBody != "" {
+		body, err := regexp.Compile(conf.ExpectedBody)
+		if err != nil {
+			return nil, fmt.Errorf("health_check: invalid expected_body: %w", err)
+		}
+		s.body = body
+	}
+	return s, nil
+}
+
+// parseStatusRange - "200" или "200-299"
+func parseStatusRange(spec string) (statusRange, error) {
+	fromStr, toStr, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+	from, err := strconv.Atoi(fromStr)
+	to := from
+	if err == nil && isRange {
+		to, err = strconv.Atoi(toStr)
+	}
+	if err != nil || from < 100 || to > 599 || from > to {
+		return statusRange{}, fmt.Errorf("health_check: invalid expected status %q", spec)
+	}
+	return statusRange{from: from, to: to}, nil
+}
+
+func (s *healthSettings) expectedStatus(code int) bool {
+	for _, r := range s.statuses {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureHealthCheck - задаёт общие настройки активной проверки здоровья,
+// для каждого сервера они объединяются с его собственным health_check
+func (p *Pool) ConfigureHealthCheck(conf config.HealthCheck) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	settings := make([]*healthSettings, len(p.backends))
+	for i, b := range p.backends {
+		s, err := newHealthSettings(conf.Merge(b.healthOverride))
+		if err != nil {
+			return fmt.Errorf("backend %s: %w", b.URL, err)
+		}
+		settings[i] = s
+	}
+	for i, b := range p.backends {
+		b.health = settings[i]
+	}
+	p.healthConf = conf
+	return nil
+}
+
+// HealthCheck - периодично проверяет статусы серверов, каждый сервер в своей горутине.
+// Серверы, добавленные в пул позже, начинают проверяться сразу после AddBackend
+func (p *Pool) HealthCheck(ctx context.Context) {
+	p.mux.Lock()
+	p.healthCtx = ctx
+	for _, b := range p.backends {
+		p.startProbe(b)
+	}
+	p.mux.Unlock()
+
+	<-ctx.Done() // Остановка по сигналу или красиво "Graceful Shutdown"
+	p.healthWG.Wait()
+	log.Println("HealthCheck stopped")
+}
+
+// startProbe - запускает горутину с проверкой сервера, вызывается под p.mux
+func (p *Pool) startProbe(b *Backend) {
+	if p.healthCtx == nil || p.healthCtx.Err() != nil {
+		return
+	}
+	settings := b.healthSettings()
+	if settings == nil {
+		log.Printf("WARN: health check %s - invalid settings, probing disabled\n", b.URL)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.healthCtx)
+	b.stopProbe = cancel
+	p.healthWG.Add(1)
+	go func() {
+		defer p.healthWG.Done()
+		b.probeLoop(ctx, settings)
+	}()
+}
+
+// healthSettings - настройки проверки сервера, если ConfigureHealthCheck не вызывали - по умолчанию
+func (b *Backend) healthSettings() *healthSettings {
+	if b.health != nil {
+		return b.health
+	}
+	settings, _ := newHealthSettings(config.HealthCheck{}.Merge(b.healthOverride))
+	return settings
+}
+
+// probeLoop - проверяет сервер каждые interval со случайным сдвигом, чтобы проверки
+// разных серверов не совпадали по времени, и меняет статус по порогам healthy/unhealthy
+func (b *Backend) probeLoop(ctx context.Context, s *healthSettings) {
+	timer := time.NewTimer(jitter(s.interval, 1))
+	defer timer.Stop()
+
+	successes, failures := 0, 0
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		err := s.probe(ctx, b)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			metrics.HealthChecksTotal.Inc(b.URL.String(), "success")
+			successes, failures = successes+1, 0
+			if successes >= s.healthyThreshold && !b.IsAlive() {
+				log.Printf("INFO: health check %s - server is back\n", b.URL)
+				b.SetAlive(true)
+			}
+		} else {
+			metrics.HealthChecksTotal.Inc(b.URL.String(), "failure")
+			successes, failures = 0, failures+1
+			if failures >= s.unhealthyThreshold && b.IsAlive() {
+				log.Printf("WARN: health check %s - server is down: %v\n", b.URL, err)
+				b.SetAlive(false)
+			}
+		}
+
+		timer.Reset(s.interval + jitter(s.interval, 0.1))
+	}
+}
+
+// jitter - случайная задержка от 0 до fraction*interval
+func jitter(interval time.Duration, fraction float64) time.Duration {
+	max := int64(float64(interval) * fraction)
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(max))
+}
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"loadbalancer/internal/metrics"
+	"sort"
+	"sync"
+)
+
+// metricPools - пулы, состояние серверов которых выводится в /metrics, по имени пула (upstream)
+var (
+	metricPools     = make(map[string]*Pool)
+	metricPoolsMux  sync.RWMutex
+	registerMetrics sync.Once
+)
+
+// RegisterMetrics - добавляет серверы пула в gauge-метрики текущего состояния для /metrics.
+// upstream - имя пула в метке upstream (default - основной пул backends)
+func (p *Pool) RegisterMetrics(upstream string) {
+	metricPoolsMux.Lock()
+	metricPools[upstream] = p
+	metricPoolsMux.Unlock()
+
+	registerMetrics.Do(func() {
+		labels := []string{"upstream", "backend"}
+		gauge := func(name, help string, value func(b *Backend) float64) {
+			metrics.NewGaugeFunc(name, help, labels, func(emit func(float64, ...string)) {
+				eachBackend(func(upstream string, b *Backend) {
+					emit(value(b), upstream, b.URL.String())
+				})
+			})
+		}
+
+		gauge("lb_backend_active_connections", "Current active connections per backend.",
+			func(b *Backend) float64 { return float64(b.GetActiveConnects()) })
+		gauge("lb_backend_up", "Backend alive state from health checks (1 - alive).",
+			func(b *Backend) float64 { return boolToFloat(b.IsAlive()) })
+		gauge("lb_backend_ejected", "Backend ejected by outlier detection (1 - ejected).",
+			func(b *Backend) float64 { return boolToFloat(b.IsEjected()) })
+		gauge("lb_backend_circuit_state", "Backend circuit breaker state (0 - closed, 1 - open, 2 - half-open).",
+			func(b *Backend) float64 { return float64(b.CircuitState()) })
+	})
+}
+
+// forgetMetrics - удаляет серии счётчиков и гистограмм удалённых из пула серверов, чтобы /metrics не рос
+// с каждым сервером, который когда-либо был в пуле. Серии адреса остаются, пока он есть в другом пуле
+func forgetMetrics(urls ...string) {
+	if len(urls) == 0 {
+		return
+	}
+	inUse := make(map[string]bool)
+	eachBackend(func(_ string, b *Backend) {
+		inUse[b.URL.String()] = true
+	})
+	for _, url := range urls {
+		if inUse[url] {
+			continue
+		}
+		metrics.RequestsTotal.DeleteLabelValue("backend", url)
+		metrics.RequestDuration.DeleteLabelValue("backend", url)
+		metrics.HealthChecksTotal.DeleteLabelValue("backend", url)
+	}
+}
+
+// eachBackend - обходит серверы всех зарегистрированных пулов в порядке имён пулов
+func eachBackend(fn func(upstream string, b *Backend)) {
+	metricPoolsMux.RLock()
+	names := make([]string, 0, len(metricPools))
+	for name := range metricPools {
+		names = append(names, name)
+	}
+	pools := make(map[string]*Pool, len(metricPools))
+	for name, p := range metricPools {
+		pools[name] = p
+	}
+	metricPoolsMux.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		for _, b := range pools[name].Backends() {
+			fn(name, b)
+		}
+	}
+}
+
+func boolToFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
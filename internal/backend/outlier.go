@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"loadbalancer/internal/config"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Значения по умолчанию для outlier_detection
+const (
+	defaultConsecutive5xx             = 5
+	defaultConsecutiveGatewayFailures = 3
+	defaultBaseEjectionTime           = 30 * time.Second
+	defaultMaxEjectionTime            = 5 * time.Minute
+	defaultMaxEjectionPercent         = 50
+)
+
+// outlierDetector - пассивная проверка здоровья по живому трафику (как outlier detection в Envoy).
+// Сервер, подряд вернувший слишком много 5xx или ошибок шлюза, исключается из балансировки
+// на время, которое удваивается с каждым следующим исключением
+type outlierDetector struct {
+	consecutive5xx             int32
+	consecutiveGatewayFailures int32
+	baseEjectionTime           time.Duration
+	maxEjectionTime            time.Duration
+	maxEjectionPercent         int
+
+	pool *Pool
+	mux  sync.Mutex // исключение серверов, чтобы не превысить maxEjectionPercent
+}
+
+// outlierState - счётчики пассивной проверки одного бэкенда
+type outlierState struct {
+	consecutive5xx     int32
+	consecutiveGateway int32
+	ejectedUntil       int64 // unix nano, до какого момента сервер исключён
+	ejections          int32 // сколько раз подряд исключали, определяет длительность исключения
+}
+
+// EnableOutlierDetection - включает пассивную проверку здоровья для всех серверов пула
+func (p *Pool) EnableOutlierDetection(conf config.OutlierDetection) {
+	if !conf.Enabled {
+		return
+	}
+
+	d := &outlierDetector{
+		consecutive5xx:             int32(conf.Consecutive5xx),
+		consecutiveGatewayFailures: int32(conf.ConsecutiveGatewayFailures),
+		baseEjectionTime:           conf.BaseEjectionTime,
+		maxEjectionTime:            conf.MaxEjectionTime,
+		maxEjectionPercent:         conf.MaxEjectionPercent,
+		pool:                       p,
+	}
+	if d.consecutive5xx <= 0 {
+		d.consecutive5xx = defaultConsecutive5xx
+	}
+	if d.consecutiveGatewayFailures <= 0 {
+		d.consecutiveGatewayFailures = defaultConsecutiveGatewayFailures
+	}
+	if d.baseEjectionTime <= 0 {
+		d.baseEjectionTime = defaultBaseEjectionTime
+	}
+	if d.maxEjectionTime <= 0 {
+		d.maxEjectionTime = defaultMaxEjectionTime
+	}
+	if d.maxEjectionPercent <= 0 {
+		d.maxEjectionPercent = defaultMaxEjectionPercent
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.outlier = d
+	for _, b := range p.backends {
+		b.outlier = d
+	}
+}
+
+// IsEjected - исключён ли сервер из балансировки пассивной проверкой здоровья
+func (b *Backend) IsEjected() bool {
+	until := atomic.LoadInt64(&b.outlierState.ejectedUntil)
+	return until != 0 && time.Now().UnixNano() < until
+}
+
+// observeResult - учитывает ответ бэкенда (status) или ошибку транспорта (err)
+func (d *outlierDetector) observeResult(b *Backend, status int, err error) {
+	state := &b.outlierState
+
+	if err != nil {
+		// клиент сам отменил запрос - сервер тут ни при чём
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		atomic.AddInt32(&state.consecutive5xx, 1)
+		if atomic.AddInt32(&state.consecutiveGateway, 1) >= d.consecutiveGatewayFailures {
+			d.eject(b, "consecutive gateway failures")
+		}
+		return
+	}
+
+	if status < http.StatusInternalServerError {
+		atomic.StoreInt32(&state.consecutive5xx, 0)
+		atomic.StoreInt32(&state.consecutiveGateway, 0)
+		d.forgive(b)
+		return
+	}
+
+	gatewayFailure := status == http.StatusBadGateway || status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+	if gatewayFailure && atomic.AddInt32(&state.consecutiveGateway, 1) >= d.consecutiveGatewayFailures {
+		d.eject(b, "consecutive gateway failures")
+		return
+	}
+	if atomic.AddInt32(&state.consecutive5xx, 1) >= d.consecutive5xx {
+		d.eject(b, "consecutive 5xx")
+	}
+}
+
+// eject - исключает сервер, если не превышена доля исключённых серверов пула
+func (d *outlierDetector) eject(b *Backend, reason string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if b.IsEjected() {
+		return
+	}
+
+	backends := d.pool.Backends()
+	ejected := 0
+	for _, other := range backends {
+		if other.IsEjected() {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(backends)*d.maxEjectionPercent {
+		log.Printf("WARN: outlier %s - not ejected (%s): max_ejection_percent %d%% reached\n",
+			b.URL, reason, d.maxEjectionPercent)
+		return
+	}
+
+	state := &b.outlierState
+	ejections := atomic.AddInt32(&state.ejections, 1)
+	duration := d.baseEjectionTime << (ejections - 1)
+	if duration > d.maxEjectionTime || duration <= 0 {
+		duration = d.maxEjectionTime
+	}
+	atomic.StoreInt64(&state.ejectedUntil, time.Now().Add(duration).UnixNano())
+	atomic.StoreInt32(&state.consecutive5xx, 0)
+	atomic.StoreInt32(&state.consecutiveGateway, 0)
+
+	log.Printf("WARN: outlier %s - ejected for %v (%s, ejection #%d)\n", b.URL, duration, reason, ejections)
+}
+
+// forgive - сбрасывает множитель длительности исключения, если сервер долго работает без ошибок
+func (d *outlierDetector) forgive(b *Backend) {
+	state := &b.outlierState
+	until := atomic.LoadInt64(&state.ejectedUntil)
+	if until == 0 || time.Since(time.Unix(0, until)) < d.maxEjectionTime {
+		return
+	}
+	atomic.StoreInt32(&state.ejections, 0)
+	atomic.StoreInt64(&state.ejectedUntil, 0)
+}
@@ -2,67 +2,295 @@ package backend
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/tlsutil"
 	"log"
 	"math"
-	"net/http"
-	"net/http/httputil"
 	"net/url"
+	"reflect"
 	"sync"
-	"time"
 )
 
-// Pool - список серверов, а также номер того, куда будет направлен следующий входящий запрос
+var (
+	// ErrBackendExists - сервер с таким адресом уже есть в пуле
+	ErrBackendExists = errors.New("backend already exists")
+	// ErrBackendNotFound - сервера с таким адресом нет в пуле
+	ErrBackendNotFound = errors.New("backend not found")
+)
+
+// Pool - список серверов, а также номер того, куда будет направлен следующий входящий запрос.
+// Список можно менять на лету (AddBackend/RemoveBackend): при изменении создаётся новый срез,
+// поэтому снимки, уже выданные через Backends/AliveBackends, остаются корректными
 type Pool struct {
 	backends []*Backend
 	current  uint32
+	outlier  *outlierDetector // пассивная проверка здоровья, nil - выключена
+	breaker  *breakerSettings // настройки автоматических выключателей, nil - выключены
 	mux      sync.RWMutex
+
+	healthConf config.HealthCheck // общие настройки активной проверки, для новых серверов
+	healthCtx  context.Context    // контекст запущенного HealthCheck, nil - проверки не запущены
+	healthWG   sync.WaitGroup
+
+	tlsConf config.UpstreamTLS // общие настройки TLS до бэкендов, для новых серверов
 }
 
-// NewPool - создаёт пул бэкендов из переданного списка адресов серверов
-func NewPool(backendURLs []string) *Pool {
+// NewPool - создаёт пул бэкендов из переданного списка серверов
+func NewPool(backends []config.Backend) *Pool {
 	var pool Pool
-	for _, u := range backendURLs {
-		parsedURL, _ := url.Parse(u)
-		proxy := httputil.NewSingleHostReverseProxy(parsedURL)
-		pool.backends = append(pool.backends, &Backend{
-			URL:          parsedURL,
-			Alive:        true,
-			ReverseProxy: proxy,
-		})
+	for _, b := range backends {
+		backend, err := newBackend(b)
+		if err != nil {
+			log.Printf("WARN: pool - skip backend: %v\n", err)
+			continue
+		}
+		pool.backends = append(pool.backends, backend)
 	}
 	return &pool
 }
 
+// newBackend - создаёт бэкенд из настроек сервера
+func newBackend(conf config.Backend) (*Backend, error) {
+	parsedURL, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("backend %q: %w", conf.URL, err)
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("backend %q: url must be absolute, e.g. http://127.0.0.1:8001", conf.URL)
+	}
+	weight := conf.Weight
+	if weight < 1 {
+		weight = 1
+	}
+
+	backend := &Backend{
+		URL:            parsedURL,
+		Alive:          true,
+		Weight:         weight,
+		healthOverride: conf.HealthCheck,
+		tlsOverride:    conf.TLS,
+		tuning:         conf.Transport,
+	}
+	if conf.Transport != nil {
+		backend.maxConns = int32(conf.Transport.MaxConns)
+	}
+	backend.ReverseProxy = newReverseProxy(backend)
+	// до ConfigureUpstreamTLS сервер использует только свои настройки tls
+	if err := backend.setTransport(config.UpstreamTLS{}.Merge(conf.TLS)); err != nil {
+		return nil, fmt.Errorf("backend %s: %w", conf.URL, err)
+	}
+	return backend, nil
+}
+
+// AddBackend - добавляет сервер в работающий пул и, если проверки здоровья запущены, начинает его проверять
+func (p *Pool) AddBackend(conf config.Backend) (*Backend, error) {
+	b, err := newBackend(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.find(b.URL.String()) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBackendExists, b.URL)
+	}
+	settings, err := newHealthSettings(p.healthConf.Merge(b.healthOverride))
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %w", b.URL, err)
+	}
+	if err := b.setTransport(p.tlsConf.Merge(b.tlsOverride)); err != nil {
+		return nil, fmt.Errorf("backend %s: %w", b.URL, err)
+	}
+	b.health = settings
+	b.dynamic = true
+	b.outlier = p.outlier
+	b.breaker = newCircuitBreaker(p.breaker, b)
+
+	backends := make([]*Backend, 0, len(p.backends)+1)
+	p.backends = append(append(backends, p.backends...), b)
+	p.startProbe(b)
+
+	log.Printf("INFO: pool - backend %s added\n", b.URL)
+	return b, nil
+}
+
+// ValidateBackends - проверяет новый список серверов, ничего не меняя в пуле
+func (p *Pool) ValidateBackends(backends []config.Backend) error {
+	p.mux.RLock()
+	healthConf, tlsConf := p.healthConf, p.tlsConf
+	p.mux.RUnlock()
+
+	seen := make(map[string]struct{}, len(backends))
+	for _, conf := range backends {
+		b, err := newBackend(conf)
+		if err != nil {
+			return err
+		}
+		if _, dup := seen[b.URL.String()]; dup {
+			return fmt.Errorf("%w: %s", ErrBackendExists, b.URL)
+		}
+		seen[b.URL.String()] = struct{}{}
+		if _, err := newHealthSettings(healthConf.Merge(b.healthOverride)); err != nil {
+			return fmt.Errorf("backend %s: %w", b.URL, err)
+		}
+		if _, err := tlsutil.ClientConfig(tlsConf.Merge(b.tlsOverride)); err != nil {
+			return fmt.Errorf("backend %s: %w", b.URL, err)
+		}
+	}
+	return nil
+}
+
+// SyncBackends - приводит пул к новому списку серверов (перезагрузка конфига).
+// Неизменившиеся сервера остаются как есть со своими счётчиками и проверками, сервера с
+// новым весом, health_check, tls или transport пересоздаются, пропавшие из списка - удаляются.
+// Сервера, добавленные через административный API, остаются в пуле, пока их нет в конфиге;
+// если адрес появился в конфиге, сервером дальше управляет конфиг
+func (p *Pool) SyncBackends(backends []config.Backend) error {
+	if err := p.ValidateBackends(backends); err != nil {
+		return err
+	}
+
+	var removed []string
+	defer func() { forgetMetrics(removed...) }() // после p.mux.Unlock: обходит серверы всех пулов
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	current := make(map[string]*Backend, len(p.backends))
+	for _, b := range p.backends {
+		current[b.URL.String()] = b
+	}
+
+	next := make([]*Backend, 0, len(backends))
+	for _, conf := range backends {
+		fresh, _ := newBackend(conf) // уже проверено в ValidateBackends
+		key := fresh.URL.String()
+		if old, ok := current[key]; ok && old.Weight == fresh.Weight &&
+			reflect.DeepEqual(old.healthOverride, fresh.healthOverride) &&
+			reflect.DeepEqual(old.tlsOverride, fresh.tlsOverride) &&
+			reflect.DeepEqual(old.tuning, fresh.tuning) {
+			old.dynamic = false
+			next = append(next, old)
+			delete(current, key)
+			continue
+		}
+
+		fresh.health, _ = newHealthSettings(p.healthConf.Merge(fresh.healthOverride))
+		if err := fresh.setTransport(p.tlsConf.Merge(fresh.tlsOverride)); err != nil {
+			// файлы сертификатов могли пропасть после ValidateBackends, сервер остаётся без своих настроек tls
+			log.Printf("WARN: pool - backend %s: %v\n", fresh.URL, err)
+		}
+		fresh.outlier = p.outlier
+		fresh.breaker = newCircuitBreaker(p.breaker, fresh)
+		next = append(next, fresh)
+		p.startProbe(fresh)
+		log.Printf("INFO: pool - backend %s added\n", fresh.URL)
+	}
+
+	inConfig := make(map[string]bool, len(next))
+	for _, b := range next {
+		inConfig[b.URL.String()] = true
+	}
+	// всё, что осталось в current - удалено из конфига, заменено новой версией или добавлено через API;
+	// добавленные через API остаются в прежнем порядке после серверов из конфига
+	for _, old := range p.backends {
+		key := old.URL.String()
+		if current[key] == old && old.dynamic && !inConfig[key] {
+			next = append(next, old)
+			delete(current, key)
+		}
+	}
+	for _, old := range current {
+		old.SetDraining(true)
+		if old.stopProbe != nil {
+			old.stopProbe()
+		}
+		log.Printf("INFO: pool - backend %s removed\n", old.URL)
+	}
+	for key := range current {
+		if !inConfig[key] {
+			removed = append(removed, key)
+		}
+	}
+	p.backends = next
+	return nil
+}
+
+// RemoveBackend - убирает сервер из пула; запросы, которые он уже обрабатывает, завершатся сами
+func (p *Pool) RemoveBackend(rawURL string) (*Backend, error) {
+	var removed []string
+	defer func() { forgetMetrics(removed...) }() // после p.mux.Unlock: обходит серверы всех пулов
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	b := p.find(rawURL)
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBackendNotFound, rawURL)
+	}
+
+	backends := make([]*Backend, 0, len(p.backends)-1)
+	for _, other := range p.backends {
+		if other != b {
+			backends = append(backends, other)
+		}
+	}
+	p.backends = backends
+	removed = append(removed, b.URL.String())
+	b.SetDraining(true)
+	if b.stopProbe != nil {
+		b.stopProbe()
+	}
+
+	log.Printf("INFO: pool - backend %s removed\n", b.URL)
+	return b, nil
+}
+
+// DrainBackend - перестаёт отправлять на сервер новые запросы, текущие завершаются как обычно
+func (p *Pool) DrainBackend(rawURL string, draining bool) (*Backend, error) {
+	b := p.Find(rawURL)
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBackendNotFound, rawURL)
+	}
+	b.SetDraining(draining)
+	log.Printf("INFO: pool - backend %s draining=%v, active connects: %d\n", b.URL, draining, b.GetActiveConnects())
+	return b, nil
+}
+
+// Find - ищет сервер пула по адресу
+func (p *Pool) Find(rawURL string) *Backend {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	return p.find(rawURL)
+}
+
+func (p *Pool) find(rawURL string) *Backend {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	for _, b := range p.backends {
+		if b.URL.String() == target.String() {
+			return b
+		}
+	}
+	return nil
+}
+
 // Next - реализация балансировки методом Round-Robin
 func (p *Pool) Next() *Backend {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
+	if len(p.backends) == 0 {
+		return nil
+	}
 	next := int(p.current+1) % len(p.backends)
 	p.current = uint32(next)
 	return p.backends[next]
 }
 
-// HealthCheck - периодично проверяет статусы серверов
-func (p *Pool) HealthCheck(ctx context.Context) {
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			for _, b := range p.backends {
-				resp, err := http.Get(b.URL.String() + "/health")
-				alive := err == nil && resp.StatusCode == http.StatusOK
-				b.SetAlive(alive)
-			}
-		case <-ctx.Done(): // Остановка по сигналу или красиво "Graceful Shutdown"
-			log.Println("HealthCheck stopped")
-			return
-		}
-	}
-}
-
 // GetMaxRetries - геттер-функция возращает количество серверов из пула
 func (p *Pool) GetLenBackends() int {
 	p.mux.RLock()
@@ -70,6 +298,28 @@ func (p *Pool) GetLenBackends() int {
 	return len(p.backends)
 }
 
+// Backends - возвращает снимок всех серверов пула
+func (p *Pool) Backends() []*Backend {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	return append([]*Backend(nil), p.backends...)
+}
+
+// AliveBackends - возвращает снимок живых, не исключённых, не выводимых из работы серверов пула
+// с замкнутым выключателем или свободным местом для пробного запроса (кандидаты для стратегии балансировки)
+func (p *Pool) AliveBackends() []*Backend {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+
+	alive := make([]*Backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		if b.IsAlive() && !b.IsEjected() && !b.IsDraining() && b.CircuitAvailable() {
+			alive = append(alive, b)
+		}
+	}
+	return alive
+}
+
 // GetLeastBusyBackend - возращает менее занятый бэкенд
 func (p *Pool) GetLeastBusyBackend() *Backend {
 	var leastBusy *Backend
@@ -79,8 +329,8 @@ func (p *Pool) GetLeastBusyBackend() *Backend {
 	defer p.mux.RUnlock()
 
 	for _, b := range p.backends {
-		// проверяем живой ли бэкенд
-		if !b.IsAlive() {
+		// проверяем живой ли бэкенд и есть ли у него свободные соединения
+		if !b.IsAlive() || b.IsDraining() || b.IsBusy() {
 			continue
 		}
 
@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxHealthBodyBytes - сколько тела ответа читается для проверки expected_body
+const maxHealthBodyBytes = 64 << 10
+
+// grpcServing - значение HealthCheckResponse.ServingStatus.SERVING
+const grpcServing = 1
+
+// Probe - одна активная проверка сервера по его настройкам health_check, nil - сервер здоров
+func (b *Backend) Probe(ctx context.Context) error {
+	s := b.healthSettings()
+	if s == nil {
+		return errors.New("invalid health_check settings")
+	}
+	return s.probe(ctx, b)
+}
+
+// probe - проверка сервера выбранным типом (http | tcp | grpc) с таймаутом
+func (s *healthSettings) probe(ctx context.Context, b *Backend) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	switch s.kind {
+	case "tcp":
+		return probeTCP(ctx, b)
+	case "grpc":
+		return probeGRPC(ctx, b, s.grpcService)
+	default:
+		return s.probeHTTP(ctx, b)
+	}
+}
+
+// probeHTTP - запрос на path, проверка кода ответа и (если задано) тела
+func (s *healthSettings) probeHTTP(ctx context.Context, b *Backend) error {
+	req, err := http.NewRequestWithContext(ctx, s.method, b.URL.String()+s.path, nil)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Transport: b.transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+	if err != nil {
+		return err
+	}
+	if !s.expectedStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if s.body != nil && !s.body.Match(body) {
+		return fmt.Errorf("body does not match %q", s.body)
+	}
+	return nil
+}
+
+// probeTCP - сервер здоров, если к нему удаётся подключиться
+func probeTCP(ctx context.Context, b *Backend) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(b))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeGRPC - стандартный grpc.health.v1.Health/Check, сервер здоров при статусе SERVING
+func probeGRPC(ctx context.Context, b *Backend, service string) error {
+	// HealthCheckRequest{service = 1} в protobuf, обёрнутый в gRPC-фрейм
+	var msg []byte
+	if service != "" {
+		msg = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	url := b.URL.Scheme + "://" + b.URL.Host + "/grpc.health.v1.Health/Check"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := b.grpcTransport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected http status %d", resp.StatusCode)
+	}
+
+	// grpc-status приходит в трейлерах, а при ответе без тела - в заголовках
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+	}
+	if grpcStatus != "0" {
+		message := resp.Trailer.Get("Grpc-Message")
+		if message == "" {
+			message = resp.Header.Get("Grpc-Message")
+		}
+		return fmt.Errorf("grpc-status %s: %s", grpcStatus, message)
+	}
+
+	status, err := parseGRPCHealthResponse(body)
+	if err != nil {
+		return err
+	}
+	if status != grpcServing {
+		return fmt.Errorf("grpc serving status %d", status)
+	}
+	return nil
+}
+
+// parseGRPCHealthResponse - достаёт HealthCheckResponse.status (поле 1, varint) из gRPC-фрейма
+func parseGRPCHealthResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, errors.New("grpc: short response")
+	}
+	if body[0] != 0 {
+		return 0, errors.New("grpc: compressed response is not supported")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	msg := body[5:]
+	if uint32(len(msg)) < size {
+		return 0, errors.New("grpc: truncated response")
+	}
+	msg = msg[:size]
+
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("grpc: malformed response")
+		}
+		msg = msg[n:]
+
+		// неизвестные поля любого типа пропускаем: сервер может отвечать более новой версией сообщения
+		var skip int
+		switch tag & 7 { // wire type
+		case 0: // varint
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("grpc: malformed response")
+			}
+			if tag>>3 == 1 {
+				return value, nil
+			}
+			skip = n
+		case 1: // fixed64
+			skip = 8
+		case 2: // length-delimited
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return 0, errors.New("grpc: malformed response")
+			}
+			skip = n + int(size)
+		case 5: // fixed32
+			skip = 4
+		default:
+			return 0, fmt.Errorf("grpc: unexpected wire type %d", tag&7)
+		}
+		if len(msg) < skip {
+			return 0, errors.New("grpc: malformed response")
+		}
+		msg = msg[skip:]
+	}
+	return 0, nil // поле не передано - значение по умолчанию UNKNOWN
+}
+
+// hostPort - адрес сервера с портом по умолчанию для схемы
+func hostPort(b *Backend) string {
+	if b.URL.Port() != "" {
+		return b.URL.Host
+	}
+	port := "80"
+	if strings.EqualFold(b.URL.Scheme, "https") {
+		port = "443"
+	}
+	return net.JoinHostPort(b.URL.Hostname(), port)
+}
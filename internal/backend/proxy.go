@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apierrors "loadbalancer/internal/errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+)
+
+// errRetryableStatus - ответ бэкенда отброшен ради повтора запроса на другом сервере
+var errRetryableStatus = errors.New("retryable upstream status")
+
+// Attempt - одна попытка проксирования запроса на бэкенд.
+// Кладётся в контекст запроса перед ReverseProxy.ServeHTTP, хуки прокси записывают в неё результат
+type Attempt struct {
+	// RetryStatus и RetryError решают, можно ли не отдавать ответ/ошибку клиенту и повторить запрос.
+	// nil - попытка последняя, всё отдаётся клиенту как есть
+	RetryStatus func(status int) bool
+	RetryError  func(err error) bool
+
+	// Director и ModifyResponse - дополнительная обработка запроса к бэкенду и ответа, который уйдёт клиенту
+	// (правила заголовков), nil - без обработки
+	Director       func(req *http.Request)
+	ModifyResponse func(resp *http.Response)
+	ModifyError    func(header http.Header) // для ответа 502, который при ошибке бэкенда пишет сам балансировщик
+
+	Retry  bool  // попытка прервана, ничего не записано в ответ - нужно повторить на другом сервере
+	Err    error // ошибка бэкенда или причина повтора
+	Status int   // код ответа бэкенда (или 502, записанный балансировщиком), 0 - ответа не было
+}
+
+type attemptKey struct{}
+
+// WithAttempt - кладёт попытку в контекст запроса
+func WithAttempt(ctx context.Context, a *Attempt) context.Context {
+	return context.WithValue(ctx, attemptKey{}, a)
+}
+
+func attemptFrom(ctx context.Context) *Attempt {
+	a, _ := ctx.Value(attemptKey{}).(*Attempt)
+	return a
+}
+
+// newReverseProxy - прокси на бэкенд с хуками для повторов, пассивной проверки здоровья и ошибками в формате JSON
+func newReverseProxy(b *Backend) *httputil.ReverseProxy {
+	target := b.URL
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		if a := attemptFrom(req.Context()); a != nil && a.Director != nil {
+			a.Director(req)
+		}
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if b.outlier != nil {
+			b.outlier.observeResult(b, resp.StatusCode, nil)
+		}
+		if b.breaker != nil {
+			b.breaker.observeResult(resp.StatusCode, nil)
+		}
+
+		a := attemptFrom(resp.Request.Context())
+		if a != nil {
+			a.Status = resp.StatusCode
+		}
+		if a != nil && a.RetryStatus != nil && a.RetryStatus(resp.StatusCode) {
+			return fmt.Errorf("%w %d", errRetryableStatus, resp.StatusCode)
+		}
+		if a != nil && a.ModifyResponse != nil {
+			a.ModifyResponse(resp)
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// ответ уже учтён в ModifyResponse
+		if !errors.Is(err, errRetryableStatus) {
+			if b.outlier != nil {
+				b.outlier.observeResult(b, 0, err)
+			}
+			if b.breaker != nil {
+				b.breaker.observeResult(0, err)
+			}
+		}
+
+		if a := attemptFrom(r.Context()); a != nil {
+			a.Err = err
+			if errors.Is(err, errRetryableStatus) || (a.RetryError != nil && a.RetryError(err)) {
+				a.Retry = true
+				return
+			}
+		}
+
+		log.Printf("WARN: proxy %s - %s %s: %v\n", target, r.Method, r.URL.Path, err)
+		apiErr := apierrors.NewAPIError(http.StatusBadGateway, "Bad gateway")
+		if a := attemptFrom(r.Context()); a != nil {
+			a.Status = apiErr.Code
+			if a.ModifyError != nil {
+				a.ModifyError(w.Header())
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(apiErr.Code)
+		w.Write(apiErr.ToJSON())
+	}
+	return proxy
+}
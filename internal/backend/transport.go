@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/tlsutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newTransport - транспорт до сервера на основе http.DefaultTransport с настройками upstream_tls
+// и собственными настройками соединений сервера (tuning, nil - по умолчанию)
+func newTransport(conf config.UpstreamTLS, tuning *config.Transport) (*http.Transport, error) {
+	tlsConfig, err := tlsutil.ClientConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if tuning == nil {
+		return transport, nil
+	}
+
+	if tuning.MaxIdleConns < 0 || tuning.MaxConns < 0 || tuning.IdleConnTimeout < 0 || tuning.DialTimeout < 0 ||
+		tuning.TLSHandshakeTimeout < 0 || tuning.ResponseHeaderTimeout < 0 {
+		return nil, fmt.Errorf("transport: values must not be negative")
+	}
+	// транспорт у каждого сервера свой, поэтому лимиты "на хост" и общие совпадают
+	if tuning.MaxIdleConns > 0 {
+		transport.MaxIdleConns = tuning.MaxIdleConns
+		transport.MaxIdleConnsPerHost = tuning.MaxIdleConns
+	}
+	if tuning.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = tuning.IdleConnTimeout
+	}
+	if tuning.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = tuning.TLSHandshakeTimeout
+	}
+	transport.DisableKeepAlives = tuning.DisableKeepAlives
+	transport.ResponseHeaderTimeout = tuning.ResponseHeaderTimeout
+	transport.MaxConnsPerHost = tuning.MaxConns
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second} // как у http.DefaultTransport
+	if tuning.DialTimeout > 0 {
+		dialer.Timeout = tuning.DialTimeout
+	}
+	if tuning.KeepAlive != 0 {
+		dialer.KeepAlive = tuning.KeepAlive
+	}
+	transport.DialContext = dialer.DialContext
+	return transport, nil
+}
+
+// newGRPCTransport - HTTP/2 без TLS (h2c) для http:// и HTTP/2 поверх TLS для https:// бэкендов,
+// с теми же настройками TLS, что и у транспорта для проксирования
+func newGRPCTransport(base *http.Transport) *http.Transport {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	transport := base.Clone()
+	transport.Protocols = protocols
+	return transport
+}
+
+// setTransport - пересоздаёт транспорты сервера (прокси и проверки здоровья) с итоговыми настройками TLS.
+// Вызывается до того, как сервер начинает получать запросы
+func (b *Backend) setTransport(conf config.UpstreamTLS) error {
+	transport, err := newTransport(conf, b.tuning)
+	if err != nil {
+		return err
+	}
+	b.transport = transport
+	b.grpcTransport = newGRPCTransport(transport)
+	if b.ReverseProxy != nil {
+		b.ReverseProxy.Transport = transport
+	}
+	return nil
+}
+
+// ConfigureUpstreamTLS - задаёт общие настройки TLS до бэкендов,
+// для каждого сервера они объединяются с его собственным tls
+func (p *Pool) ConfigureUpstreamTLS(conf config.UpstreamTLS) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	// сначала проверяем настройки всех серверов, чтобы при ошибке не менять ни одного
+	for _, b := range p.backends {
+		if _, err := tlsutil.ClientConfig(conf.Merge(b.tlsOverride)); err != nil {
+			return fmt.Errorf("backend %s: %w", b.URL, err)
+		}
+	}
+	for _, b := range p.backends {
+		if err := b.setTransport(conf.Merge(b.tlsOverride)); err != nil {
+			return fmt.Errorf("backend %s: %w", b.URL, err)
+		}
+	}
+	p.tlsConf = conf
+	return nil
+}
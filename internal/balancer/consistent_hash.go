@@ -0,0 +1,137 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"loadbalancer/internal/backend"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultVirtualNodes - точек на кольце на единицу веса, чем больше, тем ровнее распределение
+const defaultVirtualNodes = 160
+
+func init() {
+	Register("CH", newConsistentHash)
+}
+
+// consistentHash - кольцо консистентного хеширования с виртуальными узлами.
+// Кольцо строится по всем серверам пула, а сервера не из кандидатов пропускаются при поиске,
+// поэтому когда сервер умирает или уже опробован при повторе, на другие сервера переезжают только его ключи,
+// а кольцо не перестраивается
+type consistentHash struct {
+	key          keyFunc
+	virtualNodes int
+
+	mux     sync.RWMutex
+	members []*backend.Backend // сервера пула, по которым построено текущее кольцо
+	ring    []ringPoint        // отсортировано по hash
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend *backend.Backend
+}
+
+func newConsistentHash(opts Options) (Strategy, error) {
+	key, err := newKeyFunc(opts.Hash.Key)
+	if err != nil {
+		return nil, err
+	}
+	virtualNodes := opts.Hash.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	return &consistentHash{key: key, virtualNodes: virtualNodes}, nil
+}
+
+// Select - первый по часовой стрелке кандидат на кольце, построенном по самим кандидатам
+func (s *consistentHash) Select(r *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	return s.SelectMember(r, candidates, candidates)
+}
+
+// SelectMember - первый по часовой стрелке кандидат на кольце всех серверов пула от хеша ключа запроса
+func (s *consistentHash) SelectMember(r *http.Request, members, candidates []*backend.Backend) (*backend.Backend, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	ring := s.ringFor(members)
+	h := hashKey(s.key(r))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	// пока живы и не опробованы все сервера, подходит любая точка
+	var allowed map[*backend.Backend]struct{}
+	if !sameMembers(members, candidates) {
+		allowed = make(map[*backend.Backend]struct{}, len(candidates))
+		for _, b := range candidates {
+			allowed[b] = struct{}{}
+		}
+	}
+	for n := 0; n < len(ring); n++ {
+		b := ring[(start+n)%len(ring)].backend
+		if _, ok := allowed[b]; ok || allowed == nil {
+			return b, nil
+		}
+	}
+	// кандидатов нет на кольце: состав пула изменился между снимками кандидатов и серверов
+	return candidates[h%uint64(len(candidates))], nil
+}
+
+// ringFor - возвращает кольцо для серверов пула, перестраивая его только если состав пула изменился
+// (при смене веса сервер в пуле заменяется новым)
+func (s *consistentHash) ringFor(members []*backend.Backend) []ringPoint {
+	s.mux.RLock()
+	if sameMembers(s.members, members) {
+		ring := s.ring
+		s.mux.RUnlock()
+		return ring
+	}
+	s.mux.RUnlock()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if sameMembers(s.members, members) { // уже перестроил другой запрос
+		return s.ring
+	}
+
+	ring := make([]ringPoint, 0, len(members)*s.virtualNodes)
+	for _, b := range members {
+		addr := b.URL.String()
+		for i := 0; i < s.virtualNodes*b.Weight; i++ {
+			ring = append(ring, ringPoint{hash: hashKey(addr + "#" + strconv.Itoa(i)), backend: b})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	s.members = append(s.members[:0:0], members...)
+	s.ring = ring
+	return ring
+}
+
+func sameMembers(a, b []*backend.Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey - FNV-1a с финальным перемешиванием битов (splitmix64), чтобы близкие строки
+// вроде "host#1" и "host#2" равномерно расходились по кольцу
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,55 @@
+package balancer
+
+import (
+	"fmt"
+	"loadbalancer/internal/clientip"
+	"net/http"
+	"strings"
+)
+
+// keyFunc - достаёт из запроса ключ, по которому клиент привязывается к серверу
+type keyFunc func(r *http.Request) string
+
+// newKeyFunc - разбирает hash.key из конфига: ip | path | header:<имя> | cookie:<имя>.
+// Если в запросе нет нужного заголовка или куки, ключом становится IP клиента
+func newKeyFunc(spec string) (keyFunc, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "ip":
+		return ipKey, nil
+	case "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case "header":
+		if name == "" {
+			return nil, fmt.Errorf("hash key %q: header name is empty", spec)
+		}
+		name = http.CanonicalHeaderKey(name)
+		return func(r *http.Request) string {
+			if v := r.Header.Get(name); v != "" {
+				return v
+			}
+			return ipKey(r)
+		}, nil
+	case "cookie":
+		if name == "" {
+			return nil, fmt.Errorf("hash key %q: cookie name is empty", spec)
+		}
+		return func(r *http.Request) string {
+			if c, err := r.Cookie(name); err == nil && c.Value != "" {
+				return c.Value
+			}
+			return ipKey(r)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash key %q, expected ip|path|header:<name>|cookie:<name>", spec)
+	}
+}
+
+// ipKey - IP клиента по той же логике, что и у ограничителя запросов
+func ipKey(r *http.Request) string {
+	ip, err := clientip.Get(r)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,37 @@
+package balancer
+
+import (
+	"loadbalancer/internal/backend"
+	"math"
+	"net/http"
+)
+
+func init() {
+	Register("LC", func(Options) (Strategy, error) { return &leastConnections{}, nil })
+}
+
+// leastConnections - запрос уходит на сервер с наименьшим числом активных подключений
+type leastConnections struct{}
+
+// Select - реализация балансировки методом Least Connections.
+// Сервера, упёршиеся в transport.max_conns, выбираются, только если заняты все
+func (s *leastConnections) Select(_ *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	var leastBusy *backend.Backend
+	minConns := math.MaxInt32
+	busy := true
+
+	for _, b := range candidates {
+		connectsCount := b.GetActiveConnects()
+		bBusy := b.IsBusy()
+		if (busy && !bBusy) || (busy == bBusy && connectsCount < minConns) {
+			minConns = connectsCount
+			leastBusy = b
+			busy = bBusy
+		}
+	}
+
+	if leastBusy == nil {
+		return nil, ErrNoBackends
+	}
+	return leastBusy, nil
+}
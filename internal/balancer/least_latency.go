@@ -0,0 +1,36 @@
+package balancer
+
+import (
+	"loadbalancer/internal/backend"
+	"math"
+	"net/http"
+)
+
+func init() {
+	Register("EWMA", func(Options) (Strategy, error) { return &leastLatency{}, nil })
+}
+
+// leastLatency - запрос уходит на сервер с наименьшей ожидаемой задержкой:
+// EWMA времени ответа, умноженное на (активные подключения + 1), чтобы быстрый сервер
+// не забирал на себя весь поток запросов, пока его среднее не успело вырасти
+type leastLatency struct{}
+
+// Select - реализация балансировки методом Least Response Time (EWMA)
+func (s *leastLatency) Select(_ *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	var best *backend.Backend
+	minCost := math.Inf(1)
+
+	for _, b := range candidates {
+		// у сервера без замеров стоимость 0 - он сразу получит запрос и замер
+		cost := float64(b.GetLatency()) * float64(b.GetActiveConnects()+1)
+		if cost < minCost {
+			minCost = cost
+			best = b
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoBackends
+	}
+	return best, nil
+}
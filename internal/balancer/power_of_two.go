@@ -0,0 +1,38 @@
+package balancer
+
+import (
+	"loadbalancer/internal/backend"
+	"math/rand/v2"
+	"net/http"
+)
+
+func init() {
+	Register("P2C", func(Options) (Strategy, error) { return &powerOfTwoChoices{}, nil })
+}
+
+// powerOfTwoChoices - берёт два случайных живых сервера и отправляет запрос менее загруженному.
+// Почти так же ровно, как LC, но читает счётчики двух серверов, а не всех кандидатов. Запрос целиком
+// всё равно O(n): кандидатов собирает проход AliveBackends по пулу (см. BenchmarkStrategiesWithCandidates)
+type powerOfTwoChoices struct{}
+
+// Select - реализация балансировки методом Power of Two Choices
+func (s *powerOfTwoChoices) Select(_ *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, ErrNoBackends
+	case 1:
+		return candidates[0], nil
+	}
+
+	i := rand.IntN(len(candidates))
+	j := rand.IntN(len(candidates) - 1)
+	if j >= i { // второй сервер обязательно отличается от первого
+		j++
+	}
+
+	a, b := candidates[i], candidates[j]
+	if b.GetActiveConnects() < a.GetActiveConnects() {
+		return b, nil
+	}
+	return a, nil
+}
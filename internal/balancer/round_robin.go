@@ -0,0 +1,25 @@
+package balancer
+
+import (
+	"loadbalancer/internal/backend"
+	"net/http"
+	"sync/atomic"
+)
+
+func init() {
+	Register("RR", func(Options) (Strategy, error) { return &roundRobin{}, nil })
+}
+
+// roundRobin - запросы по очереди отправляются на каждый живой сервер
+type roundRobin struct {
+	current uint32
+}
+
+// Select - реализация балансировки методом Round-Robin
+func (s *roundRobin) Select(_ *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoBackends
+	}
+	next := atomic.AddUint32(&s.current, 1)
+	return candidates[int(next)%len(candidates)], nil
+}
@@ -0,0 +1,91 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoBackends - среди кандидатов нет ни одного сервера, способного принять запрос
+var ErrNoBackends = errors.New("no available backends")
+
+// Strategy - алгоритм выбора бэкенда для входящего запроса
+type Strategy interface {
+	// Select - выбирает один бэкенд из кандидатов (живых серверов пула)
+	Select(r *http.Request, candidates []*backend.Backend) (*backend.Backend, error)
+}
+
+// MemberStrategy - стратегия, состояние которой строится по всем серверам пула, а не по кандидатам:
+// когда часть серверов выпадает из кандидатов (умер, уже опробован при повторе), состояние не сбрасывается
+type MemberStrategy interface {
+	Strategy
+	// SelectMember - выбирает один бэкенд из кандидатов, members - все сервера пула
+	SelectMember(r *http.Request, members, candidates []*backend.Backend) (*backend.Backend, error)
+}
+
+// Select - выбирает стратегией s один бэкенд из кандидатов пула pool
+func Select(s Strategy, r *http.Request, pool *backend.Pool, candidates []*backend.Backend) (*backend.Backend, error) {
+	if ms, ok := s.(MemberStrategy); ok {
+		return ms.SelectMember(r, pool.Backends(), candidates)
+	}
+	return s.Select(r, candidates)
+}
+
+// Options - настройки стратегий из конфига; каждая стратегия читает только нужные ей поля
+type Options struct {
+	Hash config.Hash // для lb-метода CH
+}
+
+// Factory - конструктор стратегии, на каждый пул создаётся свой экземпляр со своим состоянием.
+// Ошибка означает некорректные настройки и отклоняет конфиг при старте
+type Factory func(opts Options) (Strategy, error)
+
+var (
+	registryMux sync.RWMutex
+	registry    = make(map[string]Factory)
+)
+
+// Register - регистрирует стратегию под именем, которое указывается в lb_method.
+// Вызывается из init() пакета со стратегией; повторная регистрация имени - ошибка программиста
+func Register(name string, factory Factory) {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+
+	if factory == nil {
+		panic("balancer: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("balancer: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New - создаёт стратегию по имени из конфига, неизвестное имя возвращает ошибку
+func New(name string, opts Options) (Strategy, error) {
+	registryMux.RLock()
+	factory, ok := registry[name]
+	registryMux.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown lb_method %q, available: %s", name, strings.Join(Names(), ", "))
+	}
+	return factory(opts)
+}
+
+// Names - отсортированный список зарегистрированных стратегий
+func Names() []string {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
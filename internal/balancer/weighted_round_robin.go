@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"loadbalancer/internal/backend"
+	"net/http"
+	"sync"
+)
+
+func init() {
+	Register("WRR", func(Options) (Strategy, error) {
+		return &weightedRoundRobin{currentWeights: make(map[*backend.Backend]int)}, nil
+	})
+}
+
+// weightedRoundRobin - плавный взвешенный Round-Robin (как в nginx):
+// при весах {a:5, b:1, c:1} получаем a a b a c a a, а не a a a a a b c.
+// Набранные веса хранятся для всех серверов пула: сервер, который выпал из кандидатов на время
+// (уже опробован при повторе), сохраняет свой вес и очередь не сбивается
+type weightedRoundRobin struct {
+	mux            sync.Mutex
+	currentWeights map[*backend.Backend]int
+}
+
+// Select - выбор среди кандидатов, когда других серверов в пуле нет
+func (s *weightedRoundRobin) Select(r *http.Request, candidates []*backend.Backend) (*backend.Backend, error) {
+	return s.SelectMember(r, candidates, candidates)
+}
+
+// SelectMember - каждый кандидат набирает свой вес, побеждает набравший больше всех и отдаёт сумму весов
+func (s *weightedRoundRobin) SelectMember(_ *http.Request, members, candidates []*backend.Backend) (*backend.Backend, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var best *backend.Backend
+	total := 0
+	for _, b := range candidates {
+		s.currentWeights[b] += b.Weight
+		total += b.Weight
+		if best == nil || s.currentWeights[b] > s.currentWeights[best] {
+			best = b
+		}
+	}
+	s.currentWeights[best] -= total
+
+	// сервера, удалённые из пула (или заменённые при смене веса), забываются
+	if len(s.currentWeights) > len(members) {
+		inPool := make(map[*backend.Backend]struct{}, len(members))
+		for _, b := range members {
+			inPool[b] = struct{}{}
+		}
+		for b := range s.currentWeights {
+			if _, ok := inPool[b]; !ok {
+				delete(s.currentWeights, b)
+			}
+		}
+	}
+
+	return best, nil
+}
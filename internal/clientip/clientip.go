@@ -0,0 +1,165 @@
+package clientip
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Resolver - определяет IP клиента с учётом доверенных прокси (client_ip.trusted_proxies)
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// current - действующий Resolver для Get, nil - доверенных прокси нет
+var current atomic.Pointer[Resolver]
+
+// New - проверяет список доверенных прокси и создаёт Resolver
+func New(conf config.ClientIP) (*Resolver, error) {
+	r := &Resolver{}
+	for _, s := range conf.TrustedProxies {
+		prefix, err := ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("client_ip.trusted_proxies: %w", err)
+		}
+		r.trusted = append(r.trusted, prefix)
+	}
+	return r, nil
+}
+
+// ParsePrefix - CIDR или отдельный IP (как /32 или /128)
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// SetDefault - делает r действующим для Get (при старте и перезагрузке конфига)
+func SetDefault(r *Resolver) {
+	current.Store(r)
+}
+
+// Get - возвращает реальный IP клиента по действующим настройкам client_ip
+func Get(r *http.Request) (string, error) {
+	return current.Load().ClientIP(r)
+}
+
+// TrustedPeer - является ли прямой собеседник запроса доверенным прокси по действующим настройкам client_ip
+func TrustedPeer(r *http.Request) bool {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	return ok && current.Load().Trusted(peer)
+}
+
+// Trusted - является ли адрес доверенным прокси
+func (res *Resolver) Trusted(addr netip.Addr) bool {
+	if res == nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP - IP клиента в нормализованном виде. Если прямой собеседник - доверенный прокси, берём адрес из
+// X-Forwarded-For, иначе Forwarded, иначе X-Real-IP. Списки обходятся справа: клиент - первый адрес,
+// не принадлежащий доверенным прокси (подделанное клиентом начало списка так не учитывается)
+func (res *Resolver) ClientIP(r *http.Request) (string, error) {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	if !ok {
+		return "", fmt.Errorf("invalid remote address %q", r.RemoteAddr)
+	}
+	if !res.Trusted(peer) {
+		return peer.String(), nil
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		return res.walk(peer, splitList(xff)).String(), nil
+	}
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		return res.walk(peer, forwardedFor(fwd)).String(), nil
+	}
+	if realIP, ok := ParseAddr(r.Header.Get("X-Real-Ip")); ok {
+		return realIP.String(), nil
+	}
+	return peer.String(), nil
+}
+
+// walk - обходит цепочку прокси справа налево до первого недоверенного адреса. Если в цепочке мусор,
+// клиентом считается последний доверенный прокси перед ним, если все адреса доверенные - самый левый
+func (res *Resolver) walk(peer netip.Addr, hops []string) netip.Addr {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := ParseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !res.Trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// splitList - элементы всех значений заголовка-списка через запятую
+func splitList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
+
+// forwardedFor - параметры for= элементов заголовка Forwarded (RFC 7239), пустая строка - параметра нет
+func forwardedFor(values []string) []string {
+	elements := splitList(values)
+	hops := make([]string, len(elements))
+	for i, element := range elements {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops[i] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return hops
+}
+
+// ParseAddr - IP из "ip", "ip:port", "[ipv6]" или "[ipv6]:port" в нормализованном виде:
+// IPv4-mapped IPv6 становится IPv4, зона IPv6 отбрасывается
+func ParseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
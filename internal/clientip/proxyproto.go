@@ -0,0 +1,173 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout - сколько ждём заголовок PROXY protocol от доверенного прокси
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature - начало бинарного заголовка PROXY protocol v2
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyListener - слушатель, принимающий заголовок PROXY protocol v1/v2 от доверенных прокси:
+// RemoteAddr соединения становится адресом клиента из заголовка. Соединения без заголовка
+// проходят как есть, а от недоверенных собеседников заголовок не разбирается вовсе
+func ProxyListener(ln net.Listener) net.Listener {
+	return &proxyListener{Listener: ln}
+}
+
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn - заголовок читается лениво при первом Read или RemoteAddr, уже в горутине соединения,
+// чтобы медленный прокси не задерживал Accept остальных
+type proxyConn struct {
+	net.Conn
+	once   sync.Once
+	reader *bufio.Reader // nil - заголовок не разбирался, читаем напрямую
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.remote = c.Conn.RemoteAddr()
+		peer, ok := ParseAddr(c.remote.String())
+		if !ok || !current.Load().Trusted(peer) {
+			return
+		}
+
+		c.reader = bufio.NewReader(c.Conn)
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		addr, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.err = fmt.Errorf("proxy protocol from %s: %w", c.remote, err)
+			return
+		}
+		if addr != nil {
+			c.remote = addr
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.reader != nil {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// readProxyHeader - разбирает заголовок PROXY protocol, если он есть. nil без ошибки - заголовка нет
+// или адрес клиента в нём не передан (UNKNOWN, LOCAL, не-IP семейство)
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+			return nil, nil // обычный POST/PUT/PATCH
+		}
+		return readProxyV1(r)
+	case '\r':
+		if sig, err := r.Peek(len(proxyV2Signature)); err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyV2(r)
+	default:
+		return nil, nil
+	}
+}
+
+// readProxyV1 - текстовый заголовок "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n" (не длиннее 107 байт)
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("malformed v1 header")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed v1 source address")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 - бинарный заголовок: сигнатура, версия/команда, семейство, длина и адреса (TLV пропускаются)
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0f {
+	case 0x0: // LOCAL - соединение самого прокси (например, проверка здоровья)
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported v2 command %d", header[12]&0x0f)
+	}
+
+	switch header[13] >> 4 {
+	case 0x1: // AF_INET: src(4) dst(4) sport(2) dport(2)
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2: // AF_INET6: src(16) dst(16) sport(2) dport(2)
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -1,32 +1,381 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
 	"time"
 )
 
 type Config struct {
-	Port                     int           `yaml:"port"`
-	ServerShutdownTimeoutSec time.Duration `yaml:"server_shutdown_timeout_sec"`
-	LBMethod                 string        `yaml:"lb_method"`
-	Backends                 []string      `yaml:"backends"`
-
-	RateLimit struct {
-		Enabled         bool          `yaml:"enabled"`
-		CleanupInterval time.Duration `yaml:"cleanup_interval"`
-		Default         struct {
-			RequestsPerSec int `yaml:"requests_per_sec"`
-			Burst          int `yaml:"burst"`
-		} `yaml:"default"`
-		SpecialLimits []struct {
-			IPs   []string `yaml:"ips"`
-			Limit struct {
-				RequestsPerSec int `yaml:"requests_per_sec"`
-				Burst          int `yaml:"burst"`
-			} `yaml:"limit"`
-		} `yaml:"special_limits"`
-	} `yaml:"rate_limit"`
+	Port                     int              `yaml:"port"`
+	ServerShutdownTimeoutSec time.Duration    `yaml:"server_shutdown_timeout_sec"`
+	LBMethod                 string           `yaml:"lb_method"`
+	Backends                 []Backend        `yaml:"backends"`          // основной пул, на него уходят запросы без подходящего маршрута
+	Upstreams                []Upstream       `yaml:"upstreams"`         // именованные пулы серверов для маршрутов
+	Routes                   []Route          `yaml:"routes"`            // таблица маршрутов, проверяется по порядку
+	Headers                  Headers          `yaml:"headers"`           // изменение заголовков запроса и ответа
+	Hash                     Hash             `yaml:"hash"`              // настройки lb-метода CH
+	Retry                    Retry            `yaml:"retry"`             // повтор запроса на другом сервере
+	HealthCheck              HealthCheck      `yaml:"health_check"`      // активная проверка здоровья серверов
+	OutlierDetection         OutlierDetection `yaml:"outlier_detection"` // пассивная проверка здоровья по живому трафику
+	CircuitBreaker           CircuitBreaker   `yaml:"circuit_breaker"`   // автоматический выключатель для каждого сервера
+	Admin                    Admin            `yaml:"admin"`             // административный API
+	Reload                   Reload           `yaml:"reload"`            // перезагрузка конфига на лету
+	Metrics                  Metrics          `yaml:"metrics"`           // эндпоинт /metrics для Prometheus
+	AccessLog                AccessLog        `yaml:"access_log"`        // структурированный журнал доступа
+	Tracing                  Tracing          `yaml:"tracing"`           // распределённая трассировка (W3C traceparent, OTLP)
+	TLS                      TLS              `yaml:"tls"`               // HTTPS на отдельном порту
+	UpstreamTLS              UpstreamTLS      `yaml:"upstream_tls"`      // TLS к https:// бэкендам, общий для всех серверов
+	ClientIP                 ClientIP         `yaml:"client_ip"`         // определение IP клиента за доверенными прокси
+
+	RateLimit RateLimit `yaml:"rate_limit"`
+}
+
+// RateLimit - настройки ограничителя запросов
+type RateLimit struct {
+	Enabled         bool          `yaml:"enabled"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	Default         Limit         `yaml:"default"`
+	Algorithm       string        `yaml:"algorithm"` // алгоритм для лимитов без своего algorithm, по умолчанию token_bucket
+	Key             string        `yaml:"key"`       // по чему считать клиентов: ip | header:<имя> | query:<имя> | cookie:<имя> | route | jwt | jwt_verified, составной через +
+	JWT             JWT           `yaml:"jwt"`       // токен для key: jwt | jwt_verified
+	Tiers           []Tier        `yaml:"tiers"`
+	SpecialLimits   []Tier        `yaml:"special_limits"` // устаревшее имя tiers, по-прежнему поддерживается
+	Allowlist       []string      `yaml:"allowlist"`      // IP и подсети, которые никогда не ограничиваются
+	Denylist        []string      `yaml:"denylist"`       // IP и подсети, которым всегда отвечаем 403
+	IPv6Prefix      int           `yaml:"ipv6_prefix"`    // IPv6 клиентов делят один бакет на подсеть этой длины (например 64), 0 - бакет на адрес
+	MaxBuckets      int           `yaml:"max_buckets"`    // сколько бакетов держать в памяти, после этого новые ключи клиентов считаются по IP; по умолчанию 100000
+	Store           Store         `yaml:"store"`          // где хранить бакеты, меняется только перезапуском
+}
+
+// Store - хранилище состояния ограничителя. memory - у каждой реплики свои бакеты, и лимит клиента
+// растёт с числом реплик; redis и gossip делят один лимит между репликами
+type Store struct {
+	Type   string      `yaml:"type"` // memory | redis | gossip, по умолчанию memory
+	Redis  RedisStore  `yaml:"redis"`
+	Gossip GossipStore `yaml:"gossip"`
+}
+
+// RedisStore - общий redis (или совместимый сервер): лимиты считаются атомарным Lua-скриптом GCRA
+type RedisStore struct {
+	Addr     string        `yaml:"addr"`      // host:port
+	Password string        `yaml:"password"`  // для AUTH, пусто - без авторизации
+	DB       int           `yaml:"db"`        // номер базы
+	Prefix   string        `yaml:"prefix"`    // начало ключей, по умолчанию lb:rl:
+	Timeout  time.Duration `yaml:"timeout"`   // на подключение и команду, по умолчанию 100ms
+	PoolSize int           `yaml:"pool_size"` // свободных соединений в пуле, по умолчанию 16
+}
+
+// GossipStore - бакеты в памяти каждой реплики, которые периодически рассылают друг другу,
+// сколько запросов пропустили, и списывают чужие запросы из своих бакетов
+type GossipStore struct {
+	Listen   string        `yaml:"listen"`   // адрес для приёма счётчиков от других реплик, например :7946
+	Peers    []string      `yaml:"peers"`    // адреса listen остальных реплик (host:port)
+	Interval time.Duration `yaml:"interval"` // как часто рассылать счётчики, по умолчанию 1s
+	Secret   string        `yaml:"secret"`   // общий секрет для подписи сообщений HMAC-SHA256, обязателен
+}
+
+// ClientIP - откуда брать IP клиента. Заголовкам X-Forwarded-For, Forwarded и X-Real-IP (и PROXY protocol)
+// верим, только если запрос пришёл напрямую от доверенного прокси
+type ClientIP struct {
+	TrustedProxies []string `yaml:"trusted_proxies"` // CIDR или отдельные IP доверенных прокси
+	ProxyProtocol  bool     `yaml:"proxy_protocol"`  // принимать заголовок PROXY protocol v1/v2 от доверенных прокси, меняется только перезапуском
+}
+
+// Limit - лимит запросов
+type Limit struct {
+	RequestsPerSec int    `yaml:"requests_per_sec"`
+	Burst          int    `yaml:"burst"`
+	Algorithm      string `yaml:"algorithm"` // token_bucket | gcra | sliding_log | sliding_window, по умолчанию rate_limit.algorithm
+}
+
+// Tier - уровень лимита для перечисленных ключей клиентов и IP/подсетей.
+// Сначала ищется точное совпадение ключа, затем самая узкая подсеть с IP клиента
+type Tier struct {
+	Name  string   `yaml:"name"` // имя уровня лимита в метриках, по умолчанию tier_<номер> (special_<номер> в special_limits)
+	Keys  []string `yaml:"keys"` // значения ключа rate_limit.key, например API-ключи
+	IPs   []string `yaml:"ips"`  // IP или CIDR
+	Limit Limit    `yaml:"limit"`
+}
+
+// JWT - откуда брать токен и чем проверять подпись для ключей jwt и jwt_verified
+type JWT struct {
+	Header        string `yaml:"header"`          // заголовок с токеном, по умолчанию Authorization (Bearer <token>)
+	Secret        string `yaml:"secret"`          // общий секрет для HS256/384/512
+	PublicKeyFile string `yaml:"public_key_file"` // PEM с открытым ключом для RS256/384/512 и ES256/384/512
+}
+
+// AccessLog - структурированный журнал доступа, одна строка на запрос
+type AccessLog struct {
+	Enabled    bool     `yaml:"enabled"`
+	Format     string   `yaml:"format"`      // json | logfmt, по умолчанию json
+	Output     string   `yaml:"output"`      // stdout или путь к файлу, по умолчанию stdout
+	MaxSizeMB  int      `yaml:"max_size_mb"` // размер файла, после которого он ротируется, 0 - без ротации
+	MaxBackups int      `yaml:"max_backups"` // сколько старых файлов хранить
+	SampleRate float64  `yaml:"sample_rate"` // доля записываемых запросов (0, 1], по умолчанию 1
+	Fields     []string `yaml:"fields"`      // какие поля писать, пусто - все
+	Redact     []string `yaml:"redact"`      // поля, значения которых заменяются на [REDACTED]
+}
+
+// TLS - приём HTTPS-соединений: сертификаты выбираются по SNI и перечитываются при изменении файлов
+type TLS struct {
+	Enabled        bool          `yaml:"enabled"`
+	Port           int           `yaml:"port"`            // по умолчанию 8443
+	Certificates   []Certificate `yaml:"certificates"`    // первый - для клиентов без SNI или с незнакомым именем
+	MinVersion     string        `yaml:"min_version"`     // 1.0 | 1.1 | 1.2 | 1.3, по умолчанию 1.2
+	CipherSuites   []string      `yaml:"cipher_suites"`   // наборы шифров для TLS 1.0-1.2, пусто - по умолчанию Go
+	RedirectHTTP   bool          `yaml:"redirect_http"`   // основной (http) порт отвечает редиректом на https
+	HTTP2          bool          `yaml:"http2"`           // разрешить клиентам HTTP/2
+	ReloadInterval time.Duration `yaml:"reload_interval"` // как часто проверять файлы сертификатов, по умолчанию 10s
+}
+
+// UpstreamTLS - TLS-соединения с бэкендами: свой CA, клиентский сертификат (mTLS) и имя сервера.
+// Применяются и к проксируемым запросам, и к активным проверкам здоровья
+type UpstreamTLS struct {
+	CAFile             string `yaml:"ca_file"`              // PEM с корневыми сертификатами вместо системных
+	CertFile           string `yaml:"cert_file"`            // клиентский сертификат для mTLS
+	KeyFile            string `yaml:"key_file"`             // ключ клиентского сертификата
+	ServerName         string `yaml:"server_name"`          // имя для SNI и проверки сертификата, по умолчанию хост из url
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // не проверять сертификат сервера - только для тестовых стендов
+}
+
+// Merge - накладывает заданные (ненулевые) поля override поверх общих настроек
+func (t UpstreamTLS) Merge(override *UpstreamTLS) UpstreamTLS {
+	if override == nil {
+		return t
+	}
+	if override.CAFile != "" {
+		t.CAFile = override.CAFile
+	}
+	if override.CertFile != "" {
+		t.CertFile = override.CertFile
+	}
+	if override.KeyFile != "" {
+		t.KeyFile = override.KeyFile
+	}
+	if override.ServerName != "" {
+		t.ServerName = override.ServerName
+	}
+	if override.InsecureSkipVerify {
+		t.InsecureSkipVerify = true
+	}
+	return t
+}
+
+// Certificate - пара файлов сертификат/ключ в PEM
+type Certificate struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Tracing - продолжение трассировки из traceparent и отправка спанов в коллектор по OTLP/HTTP JSON
+type Tracing struct {
+	Enabled       bool          `yaml:"enabled"`
+	CollectorURL  string        `yaml:"collector_url"`  // например http://otel-collector:4318/v1/traces
+	ServiceName   string        `yaml:"service_name"`   // service.name в ресурсе спанов, по умолчанию loadbalancer
+	BatchSize     int           `yaml:"batch_size"`     // спанов в одной отправке, по умолчанию 512
+	FlushInterval time.Duration `yaml:"flush_interval"` // отправлять неполную пачку не реже, по умолчанию 5s
+	QueueSize     int           `yaml:"queue_size"`     // сверх этого числа неотправленных спанов новые отбрасываются, по умолчанию 4096
+}
+
+// Metrics - эндпоинт с метриками в формате Prometheus на отдельном от балансировщика адресе
+type Metrics struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // адрес сервера метрик, по умолчанию 127.0.0.1:9100
+	Path    string `yaml:"path"`   // по умолчанию /metrics
+}
+
+// Headers - правила изменения заголовков. В значениях set/add доступны шаблоны ${client_ip}, ${backend},
+// ${request_id}, ${host}, ${method}, ${path}, ${scheme}
+type Headers struct {
+	Request         HeaderRules `yaml:"request"`          // заголовки запроса к бэкенду
+	Response        HeaderRules `yaml:"response"`         // заголовки ответа клиенту
+	Forwarded       bool        `yaml:"forwarded"`        // выставлять X-Forwarded-Proto, X-Forwarded-Host, X-Real-IP и Forwarded
+	BackendHeader   string      `yaml:"backend_header"`   // заголовок ответа с адресом выбранного сервера, например X-Backend
+	StripResponse   bool        `yaml:"strip_response"`   // убирать из ответа hop-by-hop и внутренние заголовки (Server, X-Powered-By...)
+	InternalHeaders []string    `yaml:"internal_headers"` // дополнительные внутренние заголовки для strip_response
+}
+
+// HeaderRules - правила для одного направления, применяются в порядке rename, remove, set, add
+type HeaderRules struct {
+	Rename map[string]string `yaml:"rename"` // старое имя -> новое
+	Remove []string          `yaml:"remove"`
+	Set    map[string]string `yaml:"set"` // заменить значение
+	Add    map[string]string `yaml:"add"` // добавить ещё одно значение
+}
+
+// Upstream - именованный пул серверов со своим методом балансировки и проверкой здоровья
+type Upstream struct {
+	Name        string       `yaml:"name"`
+	LBMethod    string       `yaml:"lb_method"`    // по умолчанию общий lb_method
+	Hash        *Hash        `yaml:"hash"`         // для CH, по умолчанию общий hash
+	Backends    []Backend    `yaml:"backends"`     // формат как у основного списка backends
+	HealthCheck *HealthCheck `yaml:"health_check"` // переопределяет общие настройки health_check для серверов пула
+}
+
+// Route - маршрут: условия на запрос и пул, куда он уходит. Все заданные условия должны совпасть
+type Route struct {
+	Name       string            `yaml:"name"`        // имя маршрута в логах и метриках ограничителя
+	Host       string            `yaml:"host"`        // заголовок Host: точное имя или *.example.com
+	PathPrefix string            `yaml:"path_prefix"` // начало пути по границе сегмента: /api - это /api и /api/..., но не /apiary
+	PathRegex  string            `yaml:"path_regex"`  // регулярное выражение для пути
+	Methods    []string          `yaml:"methods"`     // разрешённые методы, пусто - любые
+	Headers    map[string]string `yaml:"headers"`     // заголовок -> точное значение, пустое значение - заголовок просто есть
+
+	Upstream    string `yaml:"upstream"`     // имя пула из upstreams, пусто - основной пул backends
+	LBMethod    string `yaml:"lb_method"`    // метод балансировки маршрута, по умолчанию метод пула
+	StripPrefix bool   `yaml:"strip_prefix"` // убрать path_prefix из пути перед проксированием
+	Rewrite     string `yaml:"rewrite"`      // новый префикс вместо path_prefix или замена для path_regex ($1 - группы)
+	RateLimit   *Limit `yaml:"rate_limit"`   // свой лимит на каждый IP для этого маршрута, в дополнение к общему
+}
+
+// Backend - сервер для переадресации и его вес (доля трафика для lb-метода WRR)
+type Backend struct {
+	URL         string       `yaml:"url"`
+	Weight      int          `yaml:"weight"`
+	HealthCheck *HealthCheck `yaml:"health_check"` // переопределяет общие настройки health_check для этого сервера
+	TLS         *UpstreamTLS `yaml:"tls"`          // переопределяет общие настройки upstream_tls для этого сервера
+	Transport   *Transport   `yaml:"transport"`    // пул соединений и таймауты до этого сервера, nil - по умолчанию Go
+}
+
+// Transport - настройки соединений с сервером. Нулевые значения - значения http.DefaultTransport
+type Transport struct {
+	MaxIdleConns          int           `yaml:"max_idle_conns"`          // простаивающих keep-alive соединений с сервером, по умолчанию 2
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`       // через сколько закрывать простаивающее соединение, по умолчанию 90s
+	DisableKeepAlives     bool          `yaml:"disable_keep_alives"`     // новое соединение на каждый запрос
+	DialTimeout           time.Duration `yaml:"dial_timeout"`            // таймаут установки TCP-соединения, по умолчанию 30s
+	KeepAlive             time.Duration `yaml:"keep_alive"`              // период TCP keep-alive проб, по умолчанию 30s
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`   // по умолчанию 10s
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // ожидание заголовков ответа после отправки запроса, 0 - без ограничения
+	MaxConns              int           `yaml:"max_conns"`               // соединений с сервером одновременно, 0 - без ограничения
+}
+
+// UnmarshalYAML - помимо структуры {url, weight} принимает и старый формат - просто строку с адресом
+func (b *Backend) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var rawURL string
+	if err := unmarshal(&rawURL); err == nil {
+		*b = Backend{URL: rawURL, Weight: 1}
+		return nil
+	}
+
+	type plain Backend // без метода UnmarshalYAML, чтобы не уйти в рекурсию
+	var p plain
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.Weight < 0 {
+		return fmt.Errorf("backend %s: weight must not be negative, got %d", p.URL, p.Weight)
+	}
+	if p.Weight == 0 {
+		p.Weight = 1
+	}
+	*b = Backend(p)
+	return nil
+}
+
+// Hash - настройки консистентного хеширования (липкая привязка клиента к серверу)
+type Hash struct {
+	Key          string `yaml:"key"`           // ip | path | header:<имя> | cookie:<имя>, по умолчанию ip
+	VirtualNodes int    `yaml:"virtual_nodes"` // точек на кольце на единицу веса сервера, по умолчанию 160
+}
+
+// Retry - политика повтора запроса на другом сервере при ошибке бэкенда
+type Retry struct {
+	MaxAttempts        int      `yaml:"max_attempts"`         // всего попыток на запрос, 0|1 - без повторов
+	RetryOnStatus      []int    `yaml:"retry_on_status"`      // коды ответа бэкенда, после которых пробуем другой сервер
+	RetryOnErrors      []string `yaml:"retry_on_errors"`      // connect | reset | timeout, по умолчанию connect и reset
+	RetryNonIdempotent bool     `yaml:"retry_non_idempotent"` // повторять и POST/PATCH (по умолчанию только идемпотентные)
+	MaxBodyBytes       int64    `yaml:"max_body_bytes"`       // тело больше лимита не буферизуется и не повторяется, по умолчанию 64KB
+}
+
+// Reload - перезагрузка конфига без перезапуска: всегда по SIGHUP и, если включено, при изменении файла
+type Reload struct {
+	WatchFile bool          `yaml:"watch_file"` // следить за изменением config.yaml
+	Interval  time.Duration `yaml:"interval"`   // как часто проверять файл, по умолчанию 2s
+}
+
+// Admin - административный API для управления пулом серверов на лету
+type Admin struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    int    `yaml:"port"`  // отдельный от балансировщика порт, по умолчанию 9090
+	Bind    string `yaml:"bind"`  // адрес интерфейса, по умолчанию 127.0.0.1; "0.0.0.0" - все интерфейсы
+	Token   string `yaml:"token"` // обязателен: запросы передают его в заголовке Authorization: Bearer <token>
+}
+
+// HealthCheck - активная проверка здоровья: периодичный запрос к каждому серверу
+type HealthCheck struct {
+	Type               string        `yaml:"type"`                // http | tcp | grpc, по умолчанию http
+	GRPCService        string        `yaml:"grpc_service"`        // имя сервиса для grpc.health.v1, пусто - сервер целиком
+	Path               string        `yaml:"path"`                // по умолчанию /health
+	Method             string        `yaml:"method"`              // по умолчанию GET
+	Interval           time.Duration `yaml:"interval"`            // по умолчанию 3s
+	Timeout            time.Duration `yaml:"timeout"`             // по умолчанию 2s
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // успешных проверок подряд, чтобы вернуть сервер, по умолчанию 1
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // неудачных проверок подряд, чтобы убрать сервер, по умолчанию 1
+	ExpectedStatuses   []string      `yaml:"expected_statuses"`   // коды и диапазоны вида "200" или "200-299", по умолчанию 200
+	ExpectedBody       string        `yaml:"expected_body"`       // регулярное выражение для тела ответа, пусто - не проверяется
+}
+
+// Merge - накладывает заданные (ненулевые) поля override поверх общих настроек
+func (h HealthCheck) Merge(override *HealthCheck) HealthCheck {
+	if override == nil {
+		return h
+	}
+	if override.Type != "" {
+		h.Type = override.Type
+	}
+	if override.GRPCService != "" {
+		h.GRPCService = override.GRPCService
+	}
+	if override.Path != "" {
+		h.Path = override.Path
+	}
+	if override.Method != "" {
+		h.Method = override.Method
+	}
+	if override.Interval != 0 {
+		h.Interval = override.Interval
+	}
+	if override.Timeout != 0 {
+		h.Timeout = override.Timeout
+	}
+	if override.HealthyThreshold != 0 {
+		h.HealthyThreshold = override.HealthyThreshold
+	}
+	if override.UnhealthyThreshold != 0 {
+		h.UnhealthyThreshold = override.UnhealthyThreshold
+	}
+	if override.ExpectedStatuses != nil {
+		h.ExpectedStatuses = override.ExpectedStatuses
+	}
+	if override.ExpectedBody != "" {
+		h.ExpectedBody = override.ExpectedBody
+	}
+	return h
+}
+
+// OutlierDetection - исключение серверов, которые подряд отвечают ошибками на живой трафик
+type OutlierDetection struct {
+	Enabled                    bool          `yaml:"enabled"`
+	Consecutive5xx             int           `yaml:"consecutive_5xx"`              // подряд 5xx до исключения, по умолчанию 5
+	ConsecutiveGatewayFailures int           `yaml:"consecutive_gateway_failures"` // подряд 502/503/504 и ошибок соединения, по умолчанию 3
+	BaseEjectionTime           time.Duration `yaml:"base_ejection_time"`           // первое исключение, дальше удваивается, по умолчанию 30s
+	MaxEjectionTime            time.Duration `yaml:"max_ejection_time"`            // потолок длительности исключения, по умолчанию 5m
+	MaxEjectionPercent         int           `yaml:"max_ejection_percent"`         // не больше этой доли пула исключено одновременно, по умолчанию 50
+}
+
+// CircuitBreaker - автоматический выключатель: перестаёт отправлять запросы на сервер с большой
+// долей ошибок и через open_timeout проверяет его несколькими пробными запросами
+type CircuitBreaker struct {
+	Enabled             bool          `yaml:"enabled"`
+	Window              time.Duration `yaml:"window"`               // скользящее окно для доли ошибок, по умолчанию 10s
+	MinRequests         int           `yaml:"min_requests"`         // меньше запросов в окне - доля ошибок не считается, по умолчанию 20
+	ErrorRatePercent    int           `yaml:"error_rate_percent"`   // доля ошибок (5xx и ошибок соединения) для размыкания, по умолчанию 50
+	ConsecutiveFailures int           `yaml:"consecutive_failures"` // ошибок подряд для размыкания, по умолчанию 5
+	OpenTimeout         time.Duration `yaml:"open_timeout"`         // сколько выключатель разомкнут до пробных запросов, по умолчанию 30s
+	HalfOpenRequests    int           `yaml:"half_open_requests"`   // пробных запросов, которые должны пройти для замыкания, по умолчанию 3
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -38,3 +387,69 @@ func LoadConfig(filename string) (*Config, error) {
 	err = yaml.Unmarshal(data, &cfg)
 	return &cfg, err
 }
+
+// Summary - краткое описание конфига для журнала: порт, пулы, маршруты и включённые функции.
+// Секреты (admin.token, ключи JWT, пароль redis, секрет gossip) в него не попадают
+func (c *Config) Summary() string {
+	upstreams := make([]string, len(c.Upstreams))
+	for i, up := range c.Upstreams {
+		upstreams[i] = fmt.Sprintf("%s(%d)", up.Name, len(up.Backends))
+	}
+	var features []string
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"rate_limit", c.RateLimit.Enabled},
+		{"outlier_detection", c.OutlierDetection.Enabled},
+		{"circuit_breaker", c.CircuitBreaker.Enabled},
+		{"admin", c.Admin.Enabled},
+		{"metrics", c.Metrics.Enabled},
+		{"access_log", c.AccessLog.Enabled},
+		{"tracing", c.Tracing.Enabled},
+		{"tls", c.TLS.Enabled},
+	} {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	return fmt.Sprintf("port=%d lb_method=%s backends=%d upstreams=%v routes=%d features=%v",
+		c.Port, c.LBMethod, len(c.Backends), upstreams, len(c.Routes), features)
+}
+
+// Watch - периодично проверяет время изменения и размер файла и сообщает в канал, что файл изменился.
+// Канал закрывается после отмены ctx
+func Watch(ctx context.Context, filename string, interval time.Duration) <-chan struct{} {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last, _ := os.Stat(filename)
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			info, err := os.Stat(filename)
+			if err != nil { // файл могли заменить атомарным переименованием, дождёмся следующей проверки
+				continue
+			}
+			if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+				last = info
+				select {
+				case changes <- struct{}{}:
+				default: // изменение уже ждёт обработки
+				}
+			}
+		}
+	}()
+	return changes
+}
@@ -0,0 +1,240 @@
+package headers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"loadbalancer/internal/config"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// RequestIDHeader - заголовок с идентификатором запроса: берётся из запроса клиента или создаётся
+const RequestIDHeader = "X-Request-Id"
+
+// hopByHop - заголовки одного соединения (RFC 7230), не должны уходить дальше балансировщика
+var hopByHop = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// defaultInternal - заголовки, раскрывающие внутреннее устройство бэкенда
+var defaultInternal = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version", "X-Runtime"}
+
+// templateVars - переменные, доступные в значениях заголовков как ${имя}
+var templateVars = map[string]struct{}{
+	"client_ip": {}, "backend": {}, "request_id": {}, "host": {}, "method": {}, "path": {}, "scheme": {},
+}
+
+// Vars - значения переменных шаблонов для одного запроса
+type Vars struct {
+	ClientIP  string
+	Backend   string // адрес выбранного сервера
+	RequestID string
+	Host      string // Host исходного запроса
+	Method    string
+	Path      string // путь исходного запроса (до strip_prefix/rewrite)
+	Scheme    string // http | https
+	// TrustedPeer - прямой собеседник из client_ip.trusted_proxies: его заголовки X-Forwarded-* и Forwarded
+	// дополняются, у остальных клиентов заменяются
+	TrustedPeer bool
+}
+
+func (v Vars) lookup(name string) string {
+	switch name {
+	case "client_ip":
+		return v.ClientIP
+	case "backend":
+		return v.Backend
+	case "request_id":
+		return v.RequestID
+	case "host":
+		return v.Host
+	case "method":
+		return v.Method
+	case "path":
+		return v.Path
+	case "scheme":
+		return v.Scheme
+	}
+	return ""
+}
+
+// Rules - правила изменения заголовков запроса к бэкенду и ответа клиенту
+type Rules struct {
+	request       ruleSet
+	response      ruleSet
+	forwarded     bool
+	backendHeader string
+	strip         []string // удаляемые из ответа заголовки, nil - не удалять
+	needRequestID bool     // в шаблонах есть ${request_id}
+}
+
+// ruleSet - правила для одного направления, применяются в порядке rename, remove, set, add
+type ruleSet struct {
+	rename map[string]string
+	remove []string
+	set    map[string]string
+	add    map[string]string
+}
+
+// New - проверяет настройки headers (имена переменных в шаблонах) и строит правила
+func New(conf config.Headers) (*Rules, error) {
+	rules := &Rules{
+		forwarded:     conf.Forwarded,
+		backendHeader: conf.BackendHeader,
+	}
+	var err error
+	if rules.request, err = newRuleSet(conf.Request, &rules.needRequestID); err != nil {
+		return nil, fmt.Errorf("headers.request: %w", err)
+	}
+	if rules.response, err = newRuleSet(conf.Response, &rules.needRequestID); err != nil {
+		return nil, fmt.Errorf("headers.response: %w", err)
+	}
+	if conf.StripResponse {
+		rules.strip = append(append(append([]string(nil), hopByHop...), defaultInternal...), conf.InternalHeaders...)
+	}
+	return rules, nil
+}
+
+func newRuleSet(conf config.HeaderRules, needRequestID *bool) (ruleSet, error) {
+	rs := ruleSet{
+		rename: make(map[string]string, len(conf.Rename)),
+		set:    make(map[string]string, len(conf.Set)),
+		add:    make(map[string]string, len(conf.Add)),
+	}
+	for from, to := range conf.Rename {
+		rs.rename[http.CanonicalHeaderKey(from)] = http.CanonicalHeaderKey(to)
+	}
+	for _, name := range conf.Remove {
+		rs.remove = append(rs.remove, http.CanonicalHeaderKey(name))
+	}
+	for _, values := range []struct {
+		from map[string]string
+		to   map[string]string
+	}{{conf.Set, rs.set}, {conf.Add, rs.add}} {
+		for name, value := range values.from {
+			if err := checkTemplate(value, needRequestID); err != nil {
+				return rs, fmt.Errorf("%s: %w", name, err)
+			}
+			values.to[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return rs, nil
+}
+
+// checkTemplate - все ли переменные шаблона известны
+func checkTemplate(value string, needRequestID *bool) error {
+	var unknown string
+	os.Expand(value, func(name string) string {
+		if _, ok := templateVars[name]; !ok && unknown == "" {
+			unknown = name
+		}
+		if name == "request_id" {
+			*needRequestID = true
+		}
+		return ""
+	})
+	if unknown != "" {
+		return fmt.Errorf("unknown template variable ${%s}", unknown)
+	}
+	return nil
+}
+
+// apply - применяет правила к заголовкам
+func (rs *ruleSet) apply(header http.Header, vars Vars) {
+	for from, to := range rs.rename {
+		if values, ok := header[from]; ok {
+			delete(header, from)
+			header[to] = append(header[to], values...)
+		}
+	}
+	for _, name := range rs.remove {
+		header.Del(name)
+	}
+	for name, value := range rs.set {
+		header.Set(name, os.Expand(value, vars.lookup))
+	}
+	for name, value := range rs.add {
+		header.Add(name, os.Expand(value, vars.lookup))
+	}
+}
+
+// RequestID - идентификатор запроса из заголовка клиента; если его нет, а он нужен правилам, создаётся новый
+func (r *Rules) RequestID(req *http.Request) string {
+	if id := req.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	if !r.needRequestID {
+		return ""
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// ApplyRequest - правила для исходящего запроса к бэкенду (вызывается из ReverseProxy.Director)
+func (r *Rules) ApplyRequest(req *http.Request, vars Vars) {
+	if r.forwarded {
+		setForwarded(req.Header, vars)
+	}
+	r.request.apply(req.Header, vars)
+}
+
+// ApplyResponse - правила для ответа бэкенда перед отправкой клиенту (вызывается из ReverseProxy.ModifyResponse)
+func (r *Rules) ApplyResponse(resp *http.Response, vars Vars) {
+	for _, name := range r.strip {
+		resp.Header.Del(name)
+	}
+	r.ApplyError(resp.Header, vars)
+}
+
+// ApplyError - правила ответа для ошибок, которые балансировщик формирует сам (502, 503):
+// заголовок с адресом сервера (если сервер был выбран) и правила headers.response
+func (r *Rules) ApplyError(header http.Header, vars Vars) {
+	if r.backendHeader != "" && vars.Backend != "" {
+		header.Set(r.backendHeader, vars.Backend)
+	}
+	r.response.apply(header, vars)
+}
+
+// setForwarded - X-Forwarded-Proto, X-Forwarded-Host, X-Real-IP и Forwarded (RFC 7239).
+// Цепочку от доверенного прокси продолжаем, а его X-Forwarded-Proto/Host - исходные значения клиента.
+// От остальных клиентов такие заголовки не принимаются: их можно подделать. X-Forwarded-For дописывает сам ReverseProxy
+func setForwarded(header http.Header, vars Vars) {
+	if !vars.TrustedPeer {
+		for _, name := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"} {
+			header.Del(name)
+		}
+	}
+	if header.Get("X-Forwarded-Proto") == "" {
+		header.Set("X-Forwarded-Proto", vars.Scheme)
+	}
+	if header.Get("X-Forwarded-Host") == "" {
+		header.Set("X-Forwarded-Host", vars.Host)
+	}
+	if vars.ClientIP == "" {
+		return
+	}
+	header.Set("X-Real-Ip", vars.ClientIP)
+
+	node := vars.ClientIP
+	if ip := net.ParseIP(node); ip != nil && ip.To4() == nil {
+		node = `"[` + node + `]"` // IPv6 в кавычках и квадратных скобках
+	}
+	element := "for=" + node + ";host=" + quoteForwarded(vars.Host) + ";proto=" + vars.Scheme
+	if prior := header.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	header.Set("Forwarded", element)
+}
+
+// quoteForwarded - значение параметра Forwarded, в кавычках, если в нём есть не-token символы
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, ":[]\" ,;=") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
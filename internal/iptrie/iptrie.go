@@ -0,0 +1,104 @@
+package iptrie
+
+import "net/netip"
+
+// Trie - префиксное дерево подсетей для поиска самого длинного совпадающего префикса.
+// Узел на каждый бит адреса: поиск - не больше 32 (IPv4) или 128 (IPv6) шагов при любом числе записей.
+// Не потокобезопасно на запись: строится целиком до использования, а затем только читается
+type Trie[V any] struct {
+	v4, v6 *node[V]
+	size   int
+}
+
+type node[V any] struct {
+	children [2]*node[V]
+	value    V
+	set      bool // в узле заканчивается одна из подсетей
+}
+
+// New - пустое дерево
+func New[V any]() *Trie[V] {
+	return &Trie[V]{v4: &node[V]{}, v6: &node[V]{}}
+}
+
+// Insert - добавляет подсеть (адреса вне маски отбрасываются), повторная вставка заменяет значение.
+// IPv4-mapped IPv6 подсети сохраняются как IPv4
+func (t *Trie[V]) Insert(prefix netip.Prefix, value V) {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+	addr = addr.WithZone("")
+
+	n := t.root(addr)
+	raw, start := key(addr)
+	for i := start; i < start+bits; i++ {
+		b := bit(&raw, i)
+		if n.children[b] == nil {
+			n.children[b] = &node[V]{}
+		}
+		n = n.children[b]
+	}
+	if !n.set {
+		t.size++
+	}
+	n.value, n.set = value, true
+}
+
+// Lookup - значение самой узкой подсети, в которую входит адрес
+func (t *Trie[V]) Lookup(addr netip.Addr) (V, bool) {
+	var (
+		value V
+		found bool
+	)
+	if !addr.IsValid() {
+		return value, false
+	}
+	addr = addr.Unmap()
+
+	n := t.root(addr)
+	raw, i := key(addr)
+	for n != nil {
+		if n.set {
+			value, found = n.value, true
+		}
+		if i == 128 {
+			break
+		}
+		n = n.children[bit(&raw, i)]
+		i++
+	}
+	return value, found
+}
+
+// Contains - входит ли адрес хотя бы в одну подсеть
+func (t *Trie[V]) Contains(addr netip.Addr) bool {
+	_, ok := t.Lookup(addr)
+	return ok
+}
+
+// Len - количество подсетей в дереве
+func (t *Trie[V]) Len() int {
+	return t.size
+}
+
+func (t *Trie[V]) root(addr netip.Addr) *node[V] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// key - адрес в 16 байтах без выделения памяти и номер первого значимого бита (IPv4 - последние 32 бита)
+func key(addr netip.Addr) ([16]byte, int) {
+	if addr.Is4() {
+		return addr.As16(), 96
+	}
+	return addr.As16(), 0
+}
+
+// bit - i-й бит адреса, начиная со старшего
+func bit(raw *[16]byte, i int) int {
+	return int(raw[i/8]>>(7-i%8)) & 1
+}
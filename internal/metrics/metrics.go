@@ -0,0 +1,21 @@
+package metrics
+
+// Метрики балансировщика. Gauge-метрики пула и ограничителя регистрируются их владельцами
+// через NewGaugeFunc, потому что читают текущее состояние объектов
+var (
+	// RequestsTotal - ответы бэкендов по серверу и коду ответа (code="error" - ошибка соединения)
+	RequestsTotal = NewCounterVec("lb_requests_total",
+		"Upstream requests by backend and status code.", "backend", "code")
+
+	// RequestDuration - время ответа бэкендов
+	RequestDuration = NewHistogramVec("lb_request_duration_seconds",
+		"Upstream response time by backend and status code.", DefBuckets, "backend", "code")
+
+	// HealthChecksTotal - результаты активных проверок здоровья
+	HealthChecksTotal = NewCounterVec("lb_health_checks_total",
+		"Active health check results by backend.", "backend", "result")
+
+	// RateLimitTotal - решения ограничителя запросов по уровню лимита
+	RateLimitTotal = NewCounterVec("lb_rate_limit_requests_total",
+		"Rate limiter decisions by limit tier.", "tier", "decision")
+)
@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector - метрика, которая умеет записать себя в текстовом формате Prometheus
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// registry - все метрики процесса в порядке регистрации
+type registry struct {
+	mux        sync.RWMutex
+	collectors []collector
+}
+
+var defaultRegistry registry
+
+// register - добавляет метрику; метрика с тем же именем заменяется (повторная регистрация gauge-функции)
+func (r *registry) register(c collector) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for i, existing := range r.collectors {
+		if existing.name() == c.name() {
+			r.collectors[i] = c
+			return
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler - отдаёт все метрики в текстовом формате Prometheus (text/plain; version=0.0.4)
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		defaultRegistry.mux.RLock()
+		collectors := append([]collector(nil), defaultRegistry.collectors...)
+		defaultRegistry.mux.RUnlock()
+
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+// series - значения одной метрики по наборам значений меток
+type series[T any] struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mux    sync.RWMutex
+	values map[string]*T // ключ - значения меток через \xff
+}
+
+func newSeries[T any](name, help string, labels []string) series[T] {
+	return series[T]{metricName: name, help: help, labels: labels, values: make(map[string]*T)}
+}
+
+func (s *series[T]) name() string { return s.metricName }
+
+// get - значение для набора меток, создаётся при первом обращении
+func (s *series[T]) get(labelValues []string, init func() *T) *T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.metricName, len(s.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	s.mux.RLock()
+	v, ok := s.values[key]
+	s.mux.RUnlock()
+	if ok {
+		return v
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	v = init()
+	s.values[key] = v
+	return v
+}
+
+// sorted - снимок значений, отсортированный по меткам для стабильного вывода
+func (s *series[T]) sorted() (keys []string, values []*T) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	keys = make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values = make([]*T, len(keys))
+	for i, key := range keys {
+		values[i] = s.values[key]
+	}
+	return keys, values
+}
+
+// DeleteLabelValue - удаляет все значения, у которых метка label равна value (например, серии удалённого сервера).
+// Возвращает, сколько наборов меток удалено
+func (s *series[T]) DeleteLabelValue(label, value string) int {
+	index := -1
+	for i, name := range s.labels {
+		if name == label {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	deleted := 0
+	for key := range s.values {
+		if strings.Split(key, "\xff")[index] == value {
+			delete(s.values, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (s *series[T]) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.metricName, escapeHelp(s.help), s.metricName, kind)
+}
+
+// labelString - {a="x",b="y"} с дополнительной меткой (для le у гистограмм)
+func labelString(names []string, key string, extraName, extraValue string) string {
+	var values []string
+	if len(names) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+func escapeHelp(v string) string  { return helpEscaper.Replace(v) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// atomicFloat - float64 с атомарным сложением
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&f.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
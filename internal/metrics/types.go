@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefBuckets - границы гистограмм времени ответа в секундах
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// CounterVec - монотонно растущий счётчик с метками
+type CounterVec struct {
+	series[atomicFloat]
+}
+
+// NewCounterVec - создаёт и регистрирует счётчик
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{series: newSeries[atomicFloat](name, help, labels)}
+	defaultRegistry.register(c)
+	return c
+}
+
+// Inc - увеличивает счётчик для набора меток на 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add - увеличивает счётчик для набора меток
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.get(labelValues, func() *atomicFloat { return &atomicFloat{} }).add(delta)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+	keys, values := c.sorted()
+	for i, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labelString(c.labels, key, "", ""), formatFloat(values[i].load()))
+	}
+}
+
+// HistogramVec - распределение значений (времени ответа) по корзинам с метками
+type HistogramVec struct {
+	series[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // по корзинам, не накопительно
+	sum    atomicFloat
+	count  uint64
+}
+
+// NewHistogramVec - создаёт и регистрирует гистограмму с заданными границами корзин
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{series: newSeries[histogram](name, help, labels), buckets: buckets}
+	defaultRegistry.register(h)
+	return h
+}
+
+// Observe - учитывает значение для набора меток
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	hist := h.get(labelValues, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} })
+	i := sort.SearchFloat64s(h.buckets, value) // первая граница >= value
+	if i < len(h.buckets) {
+		atomic.AddUint64(&hist.counts[i], 1)
+	}
+	hist.sum.add(value)
+	atomic.AddUint64(&hist.count, 1)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	keys, values := h.sorted()
+	for i, key := range keys {
+		hist := values[i]
+		var cumulative uint64
+		for j, upper := range h.buckets {
+			cumulative += atomic.LoadUint64(&hist.counts[j])
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelString(h.labels, key, "le", formatFloat(upper)), cumulative)
+		}
+		count := atomic.LoadUint64(&hist.count)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelString(h.labels, key, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labelString(h.labels, key, "", ""), formatFloat(hist.sum.load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labelString(h.labels, key, "", ""), count)
+	}
+}
+
+// GaugeFunc - текущее значение, которое считывается в момент запроса /metrics
+type GaugeFunc struct {
+	metricName string
+	help       string
+	labels     []string
+	collect    func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc - создаёт и регистрирует gauge; collect вызывает emit для каждого набора меток.
+// Повторная регистрация с тем же именем заменяет предыдущую функцию
+func NewGaugeFunc(name, help string, labels []string, collect func(emit func(value float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, labels: labels, collect: collect}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.metricName, escapeHelp(g.help), g.metricName)
+	g.collect(func(value float64, labelValues ...string) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, labelString(g.labels, strings.Join(labelValues, "\xff"), "", ""), formatFloat(value))
+	})
+}
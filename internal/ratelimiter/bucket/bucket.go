@@ -1,51 +1,97 @@
 package bucket
 
 import (
+	"math"
 	"sync"
 	"time"
 )
 
+// TokenBucket - бакет на capacity токенов, пополняется со скоростью rate токенов в секунду.
+// Токены считаются дробными, поэтому при низкой скорости частые запросы не обнуляют пополнение
 type TokenBucket struct {
 	capacity      int
-	tokens        int // текущее кол-во
-	rate          int // скорость пополнения
+	tokens        float64 // текущее кол-во
+	rate          int     // скорость пополнения
 	lastCheckTime time.Time
 	mux           sync.Mutex
 }
 
 // NewTokenBucket - конструктор TokenBucket
 func NewTokenBucket(rate, burst int) *TokenBucket {
+	return newTokenBucket(rate, burst, time.Now())
+}
+
+func newTokenBucket(rate, burst int, now time.Time) *TokenBucket {
 	return &TokenBucket{
 		capacity:      burst,
-		tokens:        burst,
+		tokens:        float64(burst),
 		rate:          rate,
-		lastCheckTime: time.Now(),
+		lastCheckTime: now,
 	}
 }
 
 // Allow - проверяет и обновляет количество токенов для пропуска запроса
-func (tb *TokenBucket) Allow() bool {
+func (tb *TokenBucket) Allow() Decision {
+	return tb.AllowAt(time.Now())
+}
+
+// AllowAt - то же, что Allow, на момент now
+func (tb *TokenBucket) AllowAt(now time.Time) Decision {
 	tb.mux.Lock()
 	defer tb.mux.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(tb.lastCheckTime) // временная дельта с последней проверки
-	tb.lastCheckTime = now
-
-	tokensToAdd := int(elapsed.Seconds() * float64(tb.rate))
-	if tokensToAdd > 0 {
-		// следим за переполнением токенов в бакете
-		if tb.tokens > tb.capacity {
-			tb.tokens = tb.capacity
-		} else {
-			tb.tokens += tokensToAdd
-		}
+	tb.refill(now)
+	allowed := tb.tokens >= 1
+	if allowed {
+		tb.tokens--
+	}
+	return Decision{
+		Allowed:   allowed,
+		Limit:     tb.capacity,
+		Remaining: max(int(math.Floor(tb.tokens)), 0),
+		Reset:     tb.nextToken(),
 	}
+}
 
-	if tb.tokens > 0 {
-		tb.tokens--
-		return true
+// TakeAt - списывает n токенов за запросы, пропущенные другими репликами; бакет может уйти в долг
+func (tb *TokenBucket) TakeAt(n int, now time.Time) {
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+
+	tb.refill(now)
+	tb.tokens -= float64(n)
+}
+
+// nextToken - через сколько прибавится целый токен, а если их нет (бакет в долгу) - через сколько появится первый.
+// Вызывается под tb.mux
+func (tb *TokenBucket) nextToken() time.Duration {
+	if tb.rate <= 0 || tb.tokens >= float64(tb.capacity) {
+		return 0
+	}
+	need := math.Floor(tb.tokens) + 1 - tb.tokens
+	if tb.tokens < 0 {
+		need = 1 - tb.tokens
+	}
+	// вверх, чтобы через это время токен уже точно был
+	return time.Duration(math.Ceil(need / float64(tb.rate) * float64(time.Second)))
+}
+
+// refill - пополняет бакет на момент now, вызывается под tb.mux
+func (tb *TokenBucket) refill(now time.Time) {
+	// временная дельта с последней проверки; часы назад не пополняют бакет
+	if elapsed := now.Sub(tb.lastCheckTime); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * float64(tb.rate)
+		tb.lastCheckTime = now
+	}
+	// следим за переполнением токенов в бакете уже после пополнения
+	if capacity := float64(tb.capacity); tb.tokens > capacity {
+		tb.tokens = capacity
 	}
+}
 
-	return false
+// LastSeen - время последнего обращения к бакету
+func (tb *TokenBucket) LastSeen() time.Time {
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+	return tb.lastCheckTime
 }
@@ -0,0 +1,85 @@
+package bucket
+
+import (
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/key"
+	"log"
+	"net/http"
+)
+
+// keyPrefix - начало ключа бакета клиента с ключом rate_limit.key, не пересекается с IP
+const keyPrefix = "\x01"
+
+// Client - клиент для ограничителя: значение ключа rate_limit.key и IP.
+// Пустой Key - ключа нет (или rate_limit.key: ip), и клиент считается по IP
+type Client struct {
+	Key string
+	IP  string
+}
+
+// String - клиент для журнала: IP и начало ключа (ключ может быть секретом, например API-ключом)
+func (c Client) String() string {
+	if c.Key == "" {
+		return "IP: " + c.IP
+	}
+	masked := c.Key
+	if len(masked) > 4 {
+		masked = masked[:4] + "..."
+	}
+	return "IP: " + c.IP + ", key: " + masked
+}
+
+// newKeyExtractor - извлекатель ключа из rate_limit.key, nil - клиенты считаются по IP.
+// route - имя маршрута запроса для ключа route, nil - маршрут неизвестен
+func newKeyExtractor(cfg config.RateLimit, route func(*http.Request) string) (key.Extractor, error) {
+	if key.IsIP(cfg.Key) {
+		return nil, nil
+	}
+	if route == nil {
+		route = func(*http.Request) string { return "" }
+	}
+	return key.New(cfg.Key, key.Options{JWT: cfg.JWT, Route: route})
+}
+
+// newKeyExtractorOrWarn - как newKeyExtractor, но некорректный ключ заменяется на IP с предупреждением
+// (при запуске и перезагрузке конфиг заранее проверяется через Validate)
+func (bm *BucketManager) newKeyExtractorOrWarn(cfg *config.Config) key.Extractor {
+	extract, err := newKeyExtractor(cfg.RateLimit, bm.routeName)
+	if err != nil {
+		log.Printf("WARN: rate limiter - %v, clients are keyed by IP\n", err)
+	}
+	return extract
+}
+
+// SetRouteResolver - как узнать имя маршрута запроса для rate_limit.key: route (StartServer задаёт его сам)
+func (bm *BucketManager) SetRouteResolver(route func(*http.Request) string) {
+	bm.route.Store(&route)
+}
+
+// routeName - имя маршрута запроса, "" - маршруты не подключены
+func (bm *BucketManager) routeName(r *http.Request) string {
+	if route := bm.route.Load(); route != nil {
+		return (*route)(r)
+	}
+	return ""
+}
+
+// Identify - клиент запроса: IP и ключ по rate_limit.key. Если ключа в запросе нет, клиент считается по IP
+func (bm *BucketManager) Identify(r *http.Request) (Client, error) {
+	ip, err := clientip.Get(r)
+	if err != nil {
+		return Client{}, err
+	}
+
+	bm.mux.Lock()
+	extract := bm.key
+	bm.mux.Unlock()
+
+	if extract != nil {
+		if k, ok := extract(r); ok {
+			return Client{Key: k, IP: ip}, nil
+		}
+	}
+	return Client{IP: ip}, nil
+}
@@ -0,0 +1,76 @@
+package bucket
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRA - Generic Cell Rate Algorithm: вместо счётчика токенов хранится одно время - теоретическое время
+// прибытия (TAT) следующего запроса. Запрос проходит, если после него TAT уходит вперёд не больше чем
+// на burst интервалов. По поведению совпадает с бакетом на burst токенов, но без дробной арифметики
+type GCRA struct {
+	interval  time.Duration // интервал между запросами при скорости rate
+	tolerance time.Duration // на сколько TAT может опережать текущее время: burst интервалов
+	tat       time.Time
+	lastSeen  time.Time
+	mux       sync.Mutex
+}
+
+func newGCRA(rate, burst int, now time.Time) *GCRA {
+	interval := time.Duration(float64(time.Second) / float64(rate))
+	return &GCRA{
+		interval:  interval,
+		tolerance: interval * time.Duration(burst),
+		tat:       now,
+		lastSeen:  now,
+	}
+}
+
+// AllowAt - решение по запросу в момент now
+func (g *GCRA) AllowAt(now time.Time) Decision {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if now.After(g.lastSeen) {
+		g.lastSeen = now
+	}
+	tat := g.tat
+	if now.After(tat) {
+		tat = now
+	}
+	newTAT := tat.Add(g.interval)
+	allowed := newTAT.Sub(now) <= g.tolerance
+	if allowed {
+		g.tat = newTAT
+	}
+	remaining, reset := gcraState(g.tat.Sub(now), g.interval, g.tolerance)
+	return Decision{Allowed: allowed, Limit: int(g.tolerance / g.interval), Remaining: remaining, Reset: reset}
+}
+
+// gcraState - остаток и время до следующего запроса по тому, на сколько TAT опережает текущее время (ahead).
+// Запрос проходит, пока ahead+interval <= tolerance, и каждый interval ожидания добавляет один запрос
+func gcraState(ahead, interval, tolerance time.Duration) (remaining int, reset time.Duration) {
+	if ahead <= 0 {
+		return int(tolerance / interval), 0
+	}
+	remaining = max(int((tolerance-ahead)/interval), 0)
+	return remaining, ahead - (tolerance - time.Duration(remaining+1)*interval)
+}
+
+// TakeAt - сдвигает TAT на n интервалов за запросы, пропущенные другими репликами
+func (g *GCRA) TakeAt(n int, now time.Time) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if now.After(g.tat) {
+		g.tat = now
+	}
+	g.tat = g.tat.Add(time.Duration(n) * g.interval)
+}
+
+// LastSeen - время последнего обращения
+func (g *GCRA) LastSeen() time.Time {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.lastSeen
+}
@@ -0,0 +1,306 @@
+package bucket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"loadbalancer/internal/config"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Значения по умолчанию для rate_limit.store.gossip
+const (
+	defaultGossipInterval = time.Second
+	gossipPath            = "/ratelimit/gossip"
+	gossipSignature       = "X-Gossip-Signature"
+	maxGossipBody         = 8 << 20
+	maxGossipAge          = 30 * time.Second // сообщения старше (или из будущего дальше) отклоняются как повтор
+)
+
+// gossipMessage - сколько запросов реплика пропустила по каждому ключу с прошлой рассылки.
+// From, Seq и SentAt подписаны вместе со счётчиками: по ним получатель отклоняет повторы
+type gossipMessage struct {
+	From   string        `json:"from"`    // случайный id отправителя, новый при каждом запуске
+	Seq    uint64        `json:"seq"`     // номер рассылки отправителя, растёт
+	SentAt int64         `json:"sent_at"` // UnixNano отправки
+	Counts []gossipCount `json:"counts"`
+}
+
+// gossipCount - пропущенные запросы по ключу. Лимит ключа получатель берёт из своего конфига, а не из сообщения
+type gossipCount struct {
+	Key     string `json:"key"`
+	Allowed int    `json:"allowed"`
+}
+
+// gossipStore - бакеты в памяти каждой реплики, которые раз в interval рассылают остальным репликам
+// счётчики пропущенных запросов и списывают чужие запросы из своих бакетов. Между рассылками
+// клиент может получить больше лимита (до лимита на каждой реплике за interval), зато запросы
+// не ждут сети, а падение реплики не останавливает остальные
+type gossipStore struct {
+	*memoryStore
+	limitFor   func(key string) (limit, bool) // лимит ключа по конфигу этой реплики, false - ключ неизвестен
+	maxBuckets func() int                     // rate_limit.max_buckets этой реплики
+	id         string
+	peers      []string
+	secret     []byte
+	interval   time.Duration
+	client     *http.Client
+	server     *http.Server
+	warn       warnLimiter
+
+	pendingMux sync.Mutex
+	pending    map[string]int // пропущенные этой репликой с прошлой рассылки
+	seq        uint64
+
+	seenMux sync.Mutex
+	seen    map[string]seenSender // последние принятые сообщения по отправителям
+
+	done      chan struct{}
+	stopped   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// seenSender - последняя принятая рассылка отправителя
+type seenSender struct {
+	seq    uint64
+	sentAt time.Time
+}
+
+// newGossipStore - запускает приём и рассылку счётчиков. limitFor - лимит ключа по конфигу этой реплики,
+// maxBuckets - сколько бакетов можно завести
+func newGossipStore(conf config.GossipStore, limitFor func(key string) (limit, bool), maxBuckets func() int) (*gossipStore, error) {
+	if conf.Listen == "" {
+		return nil, fmt.Errorf("rate_limit.store.gossip.listen is required")
+	}
+	if conf.Secret == "" {
+		return nil, fmt.Errorf("rate_limit.store.gossip.secret is required")
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = defaultGossipInterval
+	}
+	ln, err := net.Listen("tcp", conf.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("rate_limit.store.gossip: %w", err)
+	}
+
+	s := &gossipStore{
+		memoryStore: newMemoryStore(),
+		limitFor:    limitFor,
+		maxBuckets:  maxBuckets,
+		id:          rand.Text(),
+		peers:       conf.Peers,
+		secret:      []byte(conf.Secret),
+		interval:    conf.Interval,
+		client:      &http.Client{Timeout: conf.Interval},
+		warn:        warnLimiter{interval: time.Minute},
+		pending:     make(map[string]int),
+		seen:        make(map[string]seenSender),
+		done:        make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+gossipPath, s.receive)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: conf.Interval}
+
+	s.stopped.Add(2)
+	go func() {
+		defer s.stopped.Done()
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("WARN: rate limiter - gossip listener stopped: %v\n", err)
+		}
+	}()
+	go s.sendLoop()
+	log.Printf("INFO: rate limiter gossip listening on %s, peers: %v\n", ln.Addr(), conf.Peers)
+	return s, nil
+}
+
+func (s *gossipStore) allow(key string, l limit, now time.Time) Decision {
+	decision := s.memoryStore.allow(key, l, now)
+	if !decision.Allowed {
+		return decision
+	}
+	s.pendingMux.Lock()
+	s.pending[key]++
+	s.pendingMux.Unlock()
+	return decision
+}
+
+// receive - принимает счётчики другой реплики и списывает их из своих бакетов по своим лимитам.
+// Неизвестные ключи пропускаются, а счётчик ключа не больше, чем реплика могла пропустить за рассылку.
+// Ключи клиентов выбирают сами клиенты, поэтому новые бакеты заводятся, как и для запросов, только до rate_limit.max_buckets
+func (s *gossipStore) receive(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(http.MaxBytesReader(w, r.Body, maxGossipBody)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.verify(body.Bytes(), r.Header.Get(gossipSignature)) {
+		s.warn.printf("WARN: rate limiter - gossip message from %s with bad signature dropped\n", r.RemoteAddr)
+		http.Error(w, "bad signature", http.StatusForbidden)
+		return
+	}
+	var msg gossipMessage
+	if err := json.Unmarshal(body.Bytes(), &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if !s.accept(msg, now) {
+		s.warn.printf("WARN: rate limiter - replayed or stale gossip message from %s dropped\n", r.RemoteAddr)
+		http.Error(w, "replayed message", http.StatusForbidden)
+		return
+	}
+
+	maxBuckets, skipped := s.maxBuckets(), 0
+	for _, c := range msg.Counts {
+		if c.Allowed <= 0 {
+			continue
+		}
+		l, ok := s.limitFor(c.Key)
+		if !ok {
+			continue
+		}
+		if !s.take(c.Key, l, min(c.Allowed, s.maxAllowed(l)), now, maxBuckets) {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		s.warn.printf("WARN: rate limiter - %d buckets reached rate_limit.max_buckets, %d keys from gossip of %s skipped\n",
+			maxBuckets, skipped, r.RemoteAddr)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accept - новое ли сообщение: не старше maxGossipAge и с номером больше последнего принятого от отправителя
+func (s *gossipStore) accept(msg gossipMessage, now time.Time) bool {
+	sentAt := time.Unix(0, msg.SentAt)
+	if msg.From == "" || now.Sub(sentAt).Abs() > maxGossipAge {
+		return false
+	}
+
+	s.seenMux.Lock()
+	defer s.seenMux.Unlock()
+
+	if last, ok := s.seen[msg.From]; ok && msg.Seq <= last.seq {
+		return false
+	}
+	s.seen[msg.From] = seenSender{seq: msg.Seq, sentAt: sentAt}
+	// повтор сообщения старше maxGossipAge отклонит проверка времени, такие отправители больше не нужны
+	for from, last := range s.seen {
+		if now.Sub(last.sentAt) > maxGossipAge {
+			delete(s.seen, from)
+		}
+	}
+	return true
+}
+
+// maxAllowed - сколько запросов по ключу с лимитом l реплика могла пропустить за одну рассылку
+func (s *gossipStore) maxAllowed(l limit) int {
+	return l.Burst + int(math.Ceil(float64(l.RequestsPerSec)*s.interval.Seconds()))
+}
+
+// sendLoop - раз в interval рассылает накопленные счётчики всем репликам
+func (s *gossipStore) sendLoop() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.broadcast()
+		case <-s.done:
+			s.broadcast() // не теряем последние счётчики при остановке
+			return
+		}
+	}
+}
+
+// broadcast - отправляет счётчики с прошлой рассылки; реплика, которая их не получила, получит только следующие
+func (s *gossipStore) broadcast() {
+	s.pendingMux.Lock()
+	pending := s.pending
+	s.pending = make(map[string]int, len(pending))
+	s.seq++
+	seq := s.seq
+	s.pendingMux.Unlock()
+
+	if len(pending) == 0 || len(s.peers) == 0 {
+		return
+	}
+	msg := gossipMessage{From: s.id, Seq: seq, SentAt: time.Now().UnixNano(), Counts: make([]gossipCount, 0, len(pending))}
+	for key, allowed := range pending {
+		msg.Counts = append(msg.Counts, gossipCount{Key: key, Allowed: allowed})
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("WARN: rate limiter - failed to encode gossip message: %v\n", err)
+		return
+	}
+	signature := s.sign(body)
+
+	var wg sync.WaitGroup
+	for _, peer := range s.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.send(peer, body, signature); err != nil {
+				s.warn.printf("WARN: rate limiter - gossip to %s failed: %v\n", peer, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *gossipStore) send(peer string, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, "http://"+peer+gossipPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(gossipSignature, signature)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// sign - HMAC-SHA256 тела по общему секрету
+func (s *gossipStore) sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify - подписано ли тело общим секретом
+func (s *gossipStore) verify(body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func (s *gossipStore) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.server.Close()
+		s.stopped.Wait()
+	})
+}
@@ -0,0 +1,109 @@
+package bucket
+
+import (
+	"errors"
+	"fmt"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/iptrie"
+	"net/netip"
+	"strconv"
+)
+
+// ipRules - правила ограничителя по клиенту: уровни лимитов по ключам и подсетям, allowlist и denylist.
+// Для каждого списка подсетей ищется самая узкая, в которую входит адрес
+type ipRules struct {
+	keys    map[string]limit // уровни лимитов по значению ключа rate_limit.key
+	special *iptrie.Trie[ipLimit]
+	allow   *iptrie.Trie[struct{}]
+	deny    *iptrie.Trie[struct{}]
+}
+
+// ipLimit - индивидуальный лимит и длина подсети, для которой он задан
+type ipLimit struct {
+	limit
+	bits int
+}
+
+// newIPRules - строит правила из rate_limit. Некорректные записи пропускаются и возвращаются ошибкой вместе с остальными правилами
+func newIPRules(cfg config.RateLimit) (*ipRules, error) {
+	rules := &ipRules{
+		keys:    make(map[string]limit),
+		special: iptrie.New[ipLimit](),
+		allow:   iptrie.New[struct{}](),
+		deny:    iptrie.New[struct{}](),
+	}
+	var errs []error
+
+	for _, tiers := range []struct {
+		name   string
+		prefix string // префикс имени уровня по умолчанию
+		tiers  []config.Tier
+	}{
+		{"tiers", "tier_", cfg.Tiers},
+		{"special_limits", "special_", cfg.SpecialLimits},
+	} {
+		for i, t := range tiers.tiers {
+			name := t.Name
+			if name == "" {
+				name = tiers.prefix + strconv.Itoa(i)
+			}
+			l := newLimit(name, t.Limit, cfg)
+			for _, k := range t.Keys {
+				rules.keys[k] = l
+			}
+			for _, s := range t.IPs {
+				prefix, err := clientip.ParsePrefix(s)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("rate_limit.%s[%s]: %w", tiers.name, l.Tier, err))
+					continue
+				}
+				rules.special.Insert(prefix, ipLimit{limit: l, bits: prefix.Bits()})
+			}
+		}
+	}
+	for _, list := range []struct {
+		name string
+		ips  []string
+		trie *iptrie.Trie[struct{}]
+	}{
+		{"allowlist", cfg.Allowlist, rules.allow},
+		{"denylist", cfg.Denylist, rules.deny},
+	} {
+		for _, s := range list.ips {
+			prefix, err := clientip.ParsePrefix(s)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rate_limit.%s: %w", list.name, err))
+				continue
+			}
+			list.trie.Insert(prefix, struct{}{})
+		}
+	}
+	return rules, errors.Join(errs...)
+}
+
+// Validate - проверяет rate_limit.key, алгоритмы лимитов, хранилище, адреса и подсети в tiers, special_limits, allowlist и denylist
+func Validate(cfg *config.Config) error {
+	if _, err := newKeyExtractor(cfg.RateLimit, nil); err != nil {
+		return err
+	}
+	for _, algorithm := range limitAlgorithms(cfg) {
+		if err := validateAlgorithm(algorithm); err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+	}
+	if err := validateSlidingLogMemory(cfg); err != nil {
+		return err
+	}
+	if err := validateStore(cfg); err != nil {
+		return err
+	}
+	_, err := newIPRules(cfg.RateLimit)
+	return err
+}
+
+// parseIP - адрес клиента для поиска в правилах, некорректный не входит ни в одну подсеть
+func parseIP(ip string) netip.Addr {
+	addr, _ := netip.ParseAddr(ip)
+	return addr
+}
@@ -0,0 +1,116 @@
+package bucket
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Decision - решение ограничителя по запросу: пропустить ли его и сколько запросов осталось
+type Decision struct {
+	Allowed   bool
+	Limit     int           // сколько запросов можно сделать подряд (burst), 0 - лимит не действует
+	Remaining int           // сколько запросов ещё пройдёт прямо сейчас
+	Reset     time.Duration // через сколько прибавится следующий запрос (токен), 0 - лимит уже полон
+}
+
+// SetHeaders - пишет заголовки RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset (черновик IETF, секунды)
+// и Retry-After при отказе. Если заголовки уже записал другой лимит (общий и маршрута), пропущенный
+// запрос оставляет их от более строгого - с меньшим остатком
+func (d Decision) SetHeaders(h http.Header) {
+	if d.Limit <= 0 {
+		return
+	}
+	if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && d.Allowed && prev <= d.Remaining {
+		return
+	}
+	reset := seconds(d.Reset)
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	if !d.Allowed && d.Reset > 0 { // без пополнения повторять бесполезно
+		h.Set("Retry-After", strconv.Itoa(max(reset, 1)))
+	}
+}
+
+// stricter - решение более строгого из двух лимитов: отказ, а если оба пропускают - с меньшим остатком
+func stricter(a, b Decision) Decision {
+	switch {
+	case !a.Allowed:
+		return a
+	case !b.Allowed:
+		return b
+	case b.Remaining < a.Remaining:
+		return b
+	}
+	return a
+}
+
+// seconds - длительность в целых секундах с округлением вверх, чтобы клиент не пришёл раньше времени
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Limiter - алгоритм ограничения запросов одного клиента
+type Limiter interface {
+	// AllowAt - решение по запросу в момент now
+	AllowAt(now time.Time) Decision
+	// TakeAt - учесть n запросов, которые в момент now уже пропустила другая реплика (без проверки лимита)
+	TakeAt(n int, now time.Time)
+	// LastSeen - время последнего обращения, по нему удаляются старые бакеты
+	LastSeen() time.Time
+}
+
+// Алгоритмы ограничения для rate_limit.algorithm и limit.algorithm
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmGCRA          = "gcra"
+	AlgorithmSlidingLog    = "sliding_log"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+// NewLimiter - ограничитель клиента по алгоритму (пустая строка - token_bucket), созданный в момент now
+func NewLimiter(algorithm string, rate, burst int, now time.Time) (Limiter, error) {
+	if err := validateAlgorithm(algorithm); err != nil {
+		return nil, err
+	}
+	return newLimiter(limit{RequestsPerSec: rate, Burst: burst, Algorithm: algorithm}, now), nil
+}
+
+// newLimiter - ограничитель по алгоритму лимита. Все алгоритмы дают в среднем requests_per_sec запросов в секунду
+// и всплеск до burst: token_bucket и gcra - как бакет на burst токенов, sliding_log и sliding_window -
+// не больше burst запросов в любом окне burst/requests_per_sec секунд.
+// Без пополнения (requests_per_sec <= 0) любой алгоритм пропускает только первые burst запросов
+func newLimiter(l limit, now time.Time) Limiter {
+	if l.RequestsPerSec <= 0 || l.Burst <= 0 {
+		return newTokenBucket(l.RequestsPerSec, l.Burst, now)
+	}
+	switch l.Algorithm {
+	case AlgorithmGCRA:
+		return newGCRA(l.RequestsPerSec, l.Burst, now)
+	case AlgorithmSlidingLog:
+		return newSlidingLog(l.RequestsPerSec, l.Burst, now)
+	case AlgorithmSlidingWindow:
+		return newSlidingWindow(l.RequestsPerSec, l.Burst, now)
+	default:
+		return newTokenBucket(l.RequestsPerSec, l.Burst, now)
+	}
+}
+
+// validateAlgorithm - известен ли алгоритм, пустая строка - алгоритм по умолчанию
+func validateAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingLog, AlgorithmSlidingWindow:
+		return nil
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q, expected %s|%s|%s|%s", algorithm,
+			AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingLog, AlgorithmSlidingWindow)
+	}
+}
+
+// window - окно скользящих алгоритмов: за него при полной скорости набирается burst запросов
+func window(rate, burst int) time.Duration {
+	return time.Duration(float64(burst) / float64(rate) * float64(time.Second))
+}
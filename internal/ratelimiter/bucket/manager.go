@@ -2,62 +2,154 @@ package bucket
 
 import (
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/metrics"
+	"loadbalancer/internal/ratelimiter/key"
+	"log"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type BucketManager struct {
-	config        *config.Config
-	mux           sync.Mutex
-	buckets       map[string]*TokenBucket
-	stopCleanup   chan struct{} // канал для остановки горутины отчистки
-	ipToRateLimit map[string]struct {
-		RequestsPerSec int
-		Burst          int
+	config      *config.Config
+	mux         sync.Mutex
+	store       store            // бакеты клиентов: в памяти, в redis или в памяти с рассылкой по репликам; запросы спрашивают его не под mux
+	stopCleanup chan struct{}    // канал для остановки горутины отчистки, nil - горутина не запущена
+	rules       *ipRules         // уровни лимитов по ключам и подсетям, allowlist и denylist
+	routeLimits map[string]limit // лимиты маршрутов с rate_limit, по имени маршрута
+	key         key.Extractor    // ключ клиента из rate_limit.key, nil - по IP
+	keyByClient bool             // значение ключа выбирает сам клиент (header, query, cookie, jwt)
+	warn        warnLimiter
+	route       atomic.Pointer[func(*http.Request) string]
+}
+
+// limit - лимит запросов для клиента
+type limit struct {
+	Tier           string // default или имя индивидуального лимита, для метрик
+	RequestsPerSec int
+	Burst          int
+	Algorithm      string // алгоритм ограничения, пустая строка - token_bucket
+}
+
+// newLimit - лимит уровня tier из конфига; без своего algorithm действует rate_limit.algorithm
+func newLimit(tier string, l config.Limit, cfg config.RateLimit) limit {
+	algorithm := l.Algorithm
+	if algorithm == "" {
+		algorithm = cfg.Algorithm
 	}
+	return limit{Tier: tier, RequestsPerSec: l.RequestsPerSec, Burst: l.Burst, Algorithm: algorithm}
+}
+
+// sameAs - совпадают ли параметры лимитов (имя уровня не важно)
+func (l limit) sameAs(other limit) bool {
+	l.Tier = other.Tier
+	return l == other
+}
+
+// limiterEntry - ограничитель клиента и лимит, по которому он создан
+type limiterEntry struct {
+	Limiter
+	limit limit
 }
 
 // NewBucketManager - конструктор BucketManager
 func NewBucketManager(cfg *config.Config) *BucketManager {
 	bm := &BucketManager{
 		config:      cfg,
-		buckets:     make(map[string]*TokenBucket),
-		stopCleanup: make(chan struct{}),
-		ipToRateLimit: make(map[string]struct {
-			RequestsPerSec int
-			Burst          int
-		}),
-	}
-
-	// заполняем экземпляр бакет менеджера
-	for _, specialLimit := range cfg.RateLimit.SpecialLimits {
-		for _, ip := range specialLimit.IPs {
-			bm.ipToRateLimit[ip] = struct {
-				RequestsPerSec int
-				Burst          int
-			}{
-				RequestsPerSec: specialLimit.Limit.RequestsPerSec,
-				Burst:          specialLimit.Limit.Burst,
-			}
-		}
+		rules:       newIPRulesOrWarn(cfg),
+		routeLimits: newRouteLimits(cfg),
 	}
+	bm.key = bm.newKeyExtractorOrWarn(cfg)
+	bm.keyByClient = bm.key != nil && key.ClientControlled(cfg.RateLimit.Key)
+	bm.warn = warnLimiter{interval: time.Minute}
+	bm.store = newStoreOrWarn(cfg, bm.lockedLimitForKey, bm.lockedMaxBuckets)
 
 	if cfg.RateLimit.Enabled {
 		bm.startCleanupRoutine()
 	}
+	warnIPv6Prefix(cfg)
+	registerManagerMetrics(bm)
 
 	return bm
 }
 
+// newRouteLimits - лимиты маршрутов, у которых задан rate_limit
+func newRouteLimits(cfg *config.Config) map[string]limit {
+	routeLimits := make(map[string]limit)
+	for _, route := range cfg.Routes {
+		if route.RateLimit == nil {
+			continue
+		}
+		routeLimits[route.Name] = newLimit("route:"+route.Name, *route.RateLimit, cfg.RateLimit)
+	}
+	return routeLimits
+}
+
+// routeKey - ключ бакета клиента на маршруте, не пересекается с ключами общего лимита
+func routeKey(route, client string) string {
+	return route + "\x00" + client
+}
+
+// newIPRulesOrWarn - правила по адресам; некорректные записи пропускаются с предупреждением
+// (при запуске и перезагрузке конфиг заранее проверяется через Validate)
+func newIPRulesOrWarn(cfg *config.Config) *ipRules {
+	rules, err := newIPRules(cfg.RateLimit)
+	if err != nil {
+		log.Printf("WARN: rate limiter - invalid entries skipped: %v\n", err)
+	}
+	return rules
+}
+
+// warnIPv6Prefix - предупреждает о некорректном rate_limit.ipv6_prefix, такое значение не группирует адреса
+func warnIPv6Prefix(cfg *config.Config) {
+	if p := cfg.RateLimit.IPv6Prefix; p < 0 || p > 128 {
+		log.Printf("WARN: rate_limit.ipv6_prefix %d out of range 0-128, IPv6 addresses are not grouped\n", p)
+	}
+}
+
+// Reload - применяет новые лимиты из перезагруженного конфига. Бакеты, у которых лимит
+// не изменился, сохраняют накопленные токены, остальные создаются заново при следующем запросе.
+// Хранилище rate_limit.store меняется только перезапуском
+func (bm *BucketManager) Reload(cfg *config.Config) {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	if !reflect.DeepEqual(cfg.RateLimit.Store, bm.config.RateLimit.Store) {
+		log.Printf("WARN: rate_limit.store changes require a restart, keeping the current store\n")
+	}
+	bm.config = cfg
+	bm.rules = newIPRulesOrWarn(cfg)
+	bm.routeLimits = newRouteLimits(cfg)
+	bm.key = bm.newKeyExtractorOrWarn(cfg)
+	bm.keyByClient = bm.key != nil && key.ClientControlled(cfg.RateLimit.Key)
+	warnIPv6Prefix(cfg)
+
+	kept := bm.store.reload(bm.limitForKey)
+	log.Printf("INFO: rate limiter reloaded, kept %d buckets with unchanged limits\n", kept)
+
+	if cfg.RateLimit.Enabled && bm.stopCleanup == nil {
+		bm.startCleanupRoutine()
+	} else if !cfg.RateLimit.Enabled && bm.stopCleanup != nil {
+		close(bm.stopCleanup)
+		bm.stopCleanup = nil
+	}
+}
+
 // startCleanupRoutine - горутина для запуска отчистки старых бакетов
 func (bm *BucketManager) startCleanupRoutine() {
+	stop := make(chan struct{})
+	bm.stopCleanup = stop
 	ticker := time.NewTicker(bm.config.RateLimit.CleanupInterval * time.Second)
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				bm.cleanupOldBuckets()
-			case <-bm.stopCleanup:
+			case <-stop:
 				ticker.Stop()
 				return
 			}
@@ -65,11 +157,17 @@ func (bm *BucketManager) startCleanupRoutine() {
 	}()
 }
 
-// Stop - останавливает горутину с отчисткой бакетов
+// Stop - останавливает горутину с отчисткой бакетов и закрывает хранилище
 func (bm *BucketManager) Stop() {
-	if bm.config.RateLimit.Enabled {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	if bm.stopCleanup != nil {
 		close(bm.stopCleanup)
+		bm.stopCleanup = nil
 	}
+	bm.store.close()
+	unregisterManagerMetrics(bm)
 }
 
 // cleanupOldBuckets - удаляет бакеты с временем последнего обращения старше чем cleanupInterval
@@ -78,41 +176,224 @@ func (bm *BucketManager) cleanupOldBuckets() {
 	defer bm.mux.Unlock()
 
 	minusInterval := -bm.config.RateLimit.CleanupInterval * time.Second
-	cutoff := time.Now().Add(minusInterval)
-	for ip, bucket := range bm.buckets {
-		bucket.mux.Lock()
-		if bucket.lastCheckTime.Before(cutoff) {
-			delete(bm.buckets, ip)
-		}
-		bucket.mux.Unlock()
+	bm.store.cleanup(time.Now().Add(minusInterval))
+}
+
+// limitFor - лимит клиента: уровень по ключу, если есть, иначе уровень самой узкой подсети с его адресом, иначе по умолчанию.
+// bits - длина подсети уровня, -1 - лимит не по подсети. Вызывается под bm.mux
+func (bm *BucketManager) limitFor(clientKey string, addr netip.Addr) (l limit, bits int) {
+	if l, ok := bm.rules.keys[clientKey]; ok && clientKey != "" {
+		return l, -1
+	}
+	if rule, ok := bm.rules.special.Lookup(addr); ok {
+		return rule.limit, rule.bits
+	}
+	return newLimit("default", bm.config.RateLimit.Default, bm.config.RateLimit), -1
+}
+
+// limitForKey - лимит для ключа бакета (IP, подсеть IPv6, ключ клиента или маршрут+клиент), false - маршрута больше нет.
+// У бакетов по ключу клиента IP неизвестен, и если их лимит шёл от подсети, при перезагрузке они создаются заново.
+// Вызывается под bm.mux
+func (bm *BucketManager) limitForKey(key string) (limit, bool) {
+	if route, _, ok := strings.Cut(key, "\x00"); ok {
+		l, ok := bm.routeLimits[route]
+		return l, ok
+	}
+	if clientKey, ok := strings.CutPrefix(key, keyPrefix); ok {
+		l, _ := bm.limitFor(clientKey, netip.Addr{})
+		return l, true
 	}
+	addr := parseIP(key)
+	if prefix, err := netip.ParsePrefix(key); err == nil {
+		addr = prefix.Addr()
+	}
+	l, _ := bm.limitFor("", addr)
+	return l, true
+}
+
+// lockedLimitForKey - limitForKey для хранилища, которое вызывает его не под bm.mux
+func (bm *BucketManager) lockedLimitForKey(key string) (limit, bool) {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+	return bm.limitForKey(key)
 }
 
-// Allow -
-func (bm *BucketManager) Allow(ip string) bool {
+// clientKey - ключ бакета клиента: по ключу rate_limit.key, если он есть, иначе по IP. Вызывается под bm.mux
+func (bm *BucketManager) clientKey(c Client, addr netip.Addr, limitBits int) string {
+	if c.Key != "" {
+		return keyPrefix + c.Key
+	}
+	return bm.bucketKey(c.IP, addr, limitBits)
+}
+
+// bucketKey - ключ бакета для IP. IPv6 делят бакет на подсеть длины rate_limit.ipv6_prefix:
+// клиенту обычно выдаётся целая /64, и адреса в ней ничего не стоят. Адреса с индивидуальным лимитом
+// для подсети уже этой длины сохраняют свой бакет. Вызывается под bm.mux
+func (bm *BucketManager) bucketKey(ip string, addr netip.Addr, limitBits int) string {
+	bits := bm.config.RateLimit.IPv6Prefix
+	if bits <= 0 || bits >= 128 || !addr.Is6() || limitBits > bits {
+		return ip
+	}
+	return netip.PrefixFrom(addr, bits).Masked().String()
+}
+
+// Denied - входит ли IP в rate_limit.denylist. Denylist действует и при выключенном ограничителе
+func (bm *BucketManager) Denied(ip string) bool {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	denied := bm.rules.deny.Contains(parseIP(ip))
+	if denied {
+		metrics.RateLimitTotal.Inc("denylist", "deny")
+	}
+	return denied
+}
+
+// defaultMaxBuckets - сколько бакетов держать в памяти, если rate_limit.max_buckets не задан
+const defaultMaxBuckets = 100000
+
+// unlimited - решение без лимита: ограничитель выключен, клиент в allowlist или у маршрута нет своего лимита
+var unlimited = Decision{Allowed: true}
+
+// Allow - решение ограничителя по очередному запросу клиента. Адреса из allowlist не ограничиваются
+func (bm *BucketManager) Allow(c Client) Decision {
+	ch, limited := bm.clientCheck(c)
+	if !limited {
+		return unlimited
+	}
+	return ch.run()
+}
+
+// clientCheck - проверка общего лимита клиента по текущему конфигу, false - клиент не ограничивается
+func (bm *BucketManager) clientCheck(c Client) (check, bool) {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
 	// если ограничитель выключен, то всегда даём добро на все запросы
 	if !bm.config.RateLimit.Enabled {
-		return true
+		return check{}, false
 	}
+	addr := parseIP(c.IP)
+	if bm.rules.allow.Contains(addr) {
+		metrics.RateLimitTotal.Inc("allowlist", "allow")
+		return check{}, false
+	}
+	l, bits := bm.limitFor(c.Key, addr)
+	if bm.unknownKey(c.Key) {
+		ipLimit, ipBits := bm.limitFor("", addr)
+		return bm.newCheck(keyPrefix+c.Key, l).withinIP(bm.bucketKey(c.IP, addr, ipBits), ipLimit), true
+	}
+	return bm.newCheck(bm.clientKey(c, addr, bits), l), true
+}
 
-	// получаем дефолтные лимиты
-	requestsPerSec := bm.config.RateLimit.Default.RequestsPerSec
-	burst := bm.config.RateLimit.Default.Burst
+// AllowRoute - решение лимита маршрута по очередному запросу клиента. Маршруты без rate_limit не ограничиваются.
+// Лимиты маршрутов действуют, только если ограничитель включён (rate_limit.enabled)
+func (bm *BucketManager) AllowRoute(route string, c Client) Decision {
+	ch, limited := bm.routeCheck(route, c)
+	if !limited {
+		return unlimited
+	}
+	return ch.run()
+}
 
-	// получаем лимиты для IP, если есть
-	if limit, ok := bm.ipToRateLimit[ip]; ok {
-		requestsPerSec = limit.RequestsPerSec
-		burst = limit.Burst
+// routeCheck - проверка лимита маршрута по текущему конфигу, false - запрос не ограничивается
+func (bm *BucketManager) routeCheck(route string, c Client) (check, bool) {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	l, ok := bm.routeLimits[route]
+	if !bm.config.RateLimit.Enabled || !ok {
+		return check{}, false
+	}
+	addr := parseIP(c.IP)
+	if bm.rules.allow.Contains(addr) {
+		return check{}, false
+	}
+	if bm.unknownKey(c.Key) {
+		return bm.newCheck(routeKey(route, keyPrefix+c.Key), l).withinIP(routeKey(route, bm.bucketKey(c.IP, addr, -1)), l), true
+	}
+	return bm.newCheck(routeKey(route, bm.clientKey(c, addr, -1)), l), true
+}
+
+// unknownKey - ключ, значение которого придумал клиент и которого нет в tiers. Вызывается под bm.mux
+func (bm *BucketManager) unknownKey(clientKey string) bool {
+	if !bm.keyByClient || clientKey == "" {
+		return false
+	}
+	_, ok := bm.rules.keys[clientKey]
+	return !ok
+}
+
+// maxBuckets - rate_limit.max_buckets или значение по умолчанию. Вызывается под bm.mux
+func (bm *BucketManager) maxBuckets() int {
+	if n := bm.config.RateLimit.MaxBuckets; n > 0 {
+		return n
 	}
+	return defaultMaxBuckets
+}
 
+// lockedMaxBuckets - maxBuckets для хранилища, которое вызывает его не под bm.mux
+func (bm *BucketManager) lockedMaxBuckets() int {
 	bm.mux.Lock()
 	defer bm.mux.Unlock()
+	return bm.maxBuckets()
+}
 
-	bucket, exists := bm.buckets[ip]
-	if !exists { // новый IP
-		bucket = NewTokenBucket(requestsPerSec, burst)
-		bm.buckets[ip] = bucket
+// check - что спросить у хранилища по запросу. Собирается под bm.mux, а выполняется без него:
+// хранилище само защищает свои бакеты, и запрос к redis не задерживает проверки других клиентов
+type check struct {
+	store      store
+	warn       *warnLimiter
+	maxBuckets int
+	key        string // бакет клиента
+	limit      limit
+	ipKey      string // непустой - ключ клиента не из tiers, сначала проверяется бакет его IP
+	ipLimit    limit
+}
+
+// newCheck - проверка бакета key с лимитом l. Вызывается под bm.mux
+func (bm *BucketManager) newCheck(key string, l limit) check {
+	return check{store: bm.store, warn: &bm.warn, maxBuckets: bm.maxBuckets(), key: key, limit: l}
+}
+
+// withinIP - проверка ключа, которого нет в tiers, внутри бакета IP клиента ipKey
+func (ch check) withinIP(ipKey string, ipLimit limit) check {
+	ch.ipKey, ch.ipLimit = ipKey, ipLimit
+	return ch
+}
+
+// run - решение по проверке
+func (ch check) run() Decision {
+	if ch.ipKey == "" {
+		return ch.allow(ch.key, ch.limit)
 	}
+	return ch.allowWithinIP()
+}
+
+// allowWithinIP - решение для ключа, которого нет в tiers: запрос сначала проходит бакет IP клиента
+// (общий с запросами без ключа), и новые значения ключа не дают обойти лимит по IP. Новый бакет ключа
+// создаётся, только если IP пропущен и бакетов меньше rate_limit.max_buckets, иначе действует один лимит IP
+func (ch check) allowWithinIP() Decision {
+	outer := ch.store.allow(ch.ipKey, ch.ipLimit, time.Now())
+	if !outer.Allowed {
+		metrics.RateLimitTotal.Inc(ch.ipLimit.Tier, "deny")
+		return outer
+	}
+	if ch.store.size() >= ch.maxBuckets && !ch.store.contains(ch.key) {
+		ch.warn.printf("WARN: rate limiter - %d buckets reached rate_limit.max_buckets, new client keys are limited by IP only\n", ch.maxBuckets)
+		metrics.RateLimitTotal.Inc(ch.ipLimit.Tier, "allow")
+		return outer
+	}
+	return stricter(outer, ch.allow(ch.key, ch.limit))
+}
 
-	return bucket.Allow()
+// allow - спрашивает ограничитель ключа в хранилище по алгоритму лимита
+func (ch check) allow(key string, l limit) Decision {
+	decision := ch.store.allow(key, l, time.Now())
+	if decision.Allowed {
+		metrics.RateLimitTotal.Inc(l.Tier, "allow")
+	} else {
+		metrics.RateLimitTotal.Inc(l.Tier, "deny")
+	}
+	return decision
 }
@@ -0,0 +1,42 @@
+package bucket
+
+import (
+	"loadbalancer/internal/metrics"
+	"sync"
+)
+
+// metricManagers - работающие ограничители, бакеты которых выводятся в /metrics. Stop убирает менеджер отсюда,
+// поэтому остановленные менеджеры не держатся gauge-функцией
+var (
+	metricManagers    = make(map[*BucketManager]struct{})
+	metricManagersMux sync.Mutex
+	registerMetrics   sync.Once
+)
+
+// registerManagerMetrics - добавляет бакеты менеджера в gauge lb_rate_limit_buckets
+func registerManagerMetrics(bm *BucketManager) {
+	metricManagersMux.Lock()
+	metricManagers[bm] = struct{}{}
+	metricManagersMux.Unlock()
+
+	registerMetrics.Do(func() {
+		metrics.NewGaugeFunc("lb_rate_limit_buckets", "Live token buckets in the rate limiter.", nil,
+			func(emit func(float64, ...string)) {
+				metricManagersMux.Lock()
+				defer metricManagersMux.Unlock()
+
+				total := 0
+				for bm := range metricManagers {
+					total += bm.store.size()
+				}
+				emit(float64(total))
+			})
+	})
+}
+
+// unregisterManagerMetrics - убирает бакеты остановленного менеджера из /metrics
+func unregisterManagerMetrics(bm *BucketManager) {
+	metricManagersMux.Lock()
+	delete(metricManagers, bm)
+	metricManagersMux.Unlock()
+}
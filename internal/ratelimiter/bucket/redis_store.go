@@ -0,0 +1,196 @@
+package bucket
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/redis"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Значения по умолчанию для rate_limit.store.redis
+const (
+	defaultRedisPrefix  = "lb:rl:"
+	defaultRedisTimeout = 100 * time.Millisecond
+	redisMinBackoff     = 500 * time.Millisecond // первая пауза после ошибки redis
+	redisMaxBackoff     = 30 * time.Second
+)
+
+// GCRAScript - GCRA в redis: атомарно проверяет и сдвигает TAT ключа. Время берётся у самого redis,
+// поэтому расхождение часов реплик не влияет на лимит. TAT хранится в микросекундах и живёт,
+// пока опережает текущее время, после этого ключ ничем не отличается от отсутствующего.
+// KEYS[1] - ключ клиента, ARGV[1] - интервал между запросами, ARGV[2] - допуск (burst интервалов), в микросекундах.
+// Возвращает {1 - пропустить или 0 - отклонить, остаток запросов, микросекунд до следующего запроса} - как gcraState
+const GCRAScript = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+  tat = now
+end
+local allowed = 0
+if tat + interval - now <= tolerance then
+  allowed = 1
+  tat = tat + interval
+  redis.call('SET', KEYS[1], string.format('%d', tat), 'PX', math.ceil((tat - now) / 1000))
+end
+local ahead = tat - now
+if ahead <= 0 then
+  return {allowed, math.floor(tolerance / interval), 0}
+end
+local remaining = math.max(math.floor((tolerance - ahead) / interval), 0)
+return {allowed, remaining, ahead - (tolerance - (remaining + 1) * interval)}
+`
+
+var gcraScript = redis.NewScript(GCRAScript)
+
+// redisStore - лимиты в общем redis, один на все реплики. Пока redis недоступен, реплика
+// ограничивает клиентов сама по бакетам в памяти, чтобы не пропускать всех и не отклонять всех.
+// После ошибки redis не спрашивается паузу (от 0.5s, удваивается до 30s), затем его проверяет один запрос,
+// чтобы запросы не ждали таймаута подключения к лежащему серверу
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	local  *memoryStore
+	warn   warnLimiter
+
+	retryAt    atomic.Int64 // UnixNano, до которого redis не спрашиваем, 0 - redis доступен
+	backoffMux sync.Mutex
+	backoff    time.Duration
+}
+
+func newRedisStore(conf config.RedisStore) (*redisStore, error) {
+	if conf.Addr == "" {
+		return nil, fmt.Errorf("rate_limit.store.redis.addr is required")
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = defaultRedisPrefix
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultRedisTimeout
+	}
+	client := redis.New(redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+		Timeout:  conf.Timeout,
+		PoolSize: conf.PoolSize,
+	})
+	return &redisStore{client: client, prefix: conf.Prefix, local: newMemoryStore(), warn: warnLimiter{interval: 10 * time.Second}}, nil
+}
+
+func (s *redisStore) allow(key string, l limit, now time.Time) Decision {
+	// без пополнения GCRA не определён: такой лимит пропускает только первые burst запросов, считаем их локально
+	if l.RequestsPerSec <= 0 || l.Burst <= 0 {
+		return s.local.allow(key, l, now)
+	}
+	if !s.available(now) {
+		return s.local.allow(key, l, now)
+	}
+	interval := int64(time.Second/time.Microsecond) / int64(l.RequestsPerSec)
+	interval = max(interval, 1)
+	// лимит входит в ключ: после его изменения клиент начинает с полным бакетом, как и в памяти
+	redisKey := s.prefix + strconv.Itoa(l.RequestsPerSec) + ":" + strconv.Itoa(l.Burst) + ":" + key
+
+	reply, err := gcraScript.Run(s.client, []string{redisKey},
+		strconv.FormatInt(interval, 10), strconv.FormatInt(interval*int64(l.Burst), 10))
+	if err != nil {
+		backoff := s.markDown(now)
+		s.warn.printf("WARN: rate limiter - redis unavailable, limiting in memory of this replica for %v: %v\n", backoff, err)
+		return s.local.allow(key, l, now)
+	}
+	s.markUp()
+	decision, ok := parseGCRAReply(reply, l.Burst)
+	if !ok {
+		s.warn.printf("WARN: rate limiter - unexpected redis reply %v, limiting in memory of this replica\n", reply)
+		return s.local.allow(key, l, now)
+	}
+	return decision
+}
+
+// available - спрашивать ли redis. Когда пауза после ошибки истекла, проверить redis достаётся одному запросу,
+// остальные до его ответа считаются в памяти
+func (s *redisStore) available(now time.Time) bool {
+	retryAt := s.retryAt.Load()
+	if retryAt == 0 {
+		return true
+	}
+	if now.UnixNano() < retryAt {
+		return false
+	}
+	s.backoffMux.Lock()
+	backoff := s.backoff
+	s.backoffMux.Unlock()
+	return s.retryAt.CompareAndSwap(retryAt, now.Add(backoff).UnixNano())
+}
+
+// markDown - ошибка redis: удваивает паузу и возвращает её
+func (s *redisStore) markDown(now time.Time) time.Duration {
+	s.backoffMux.Lock()
+	defer s.backoffMux.Unlock()
+
+	s.backoff = min(max(s.backoff*2, redisMinBackoff), redisMaxBackoff)
+	s.retryAt.Store(now.Add(s.backoff).UnixNano())
+	return s.backoff
+}
+
+// markUp - redis ответил: пауза сбрасывается
+func (s *redisStore) markUp() {
+	if s.retryAt.Load() == 0 {
+		return
+	}
+	s.backoffMux.Lock()
+	defer s.backoffMux.Unlock()
+
+	if s.retryAt.Swap(0) != 0 {
+		s.backoff = 0
+		log.Printf("INFO: rate limiter - redis is available again\n")
+	}
+}
+
+// parseGCRAReply - решение из ответа GCRAScript
+func parseGCRAReply(reply any, burst int) (Decision, bool) {
+	items, ok := reply.([]any)
+	if !ok || len(items) != 3 {
+		return Decision{}, false
+	}
+	values := make([]int64, len(items))
+	for i, item := range items {
+		if values[i], ok = item.(int64); !ok {
+			return Decision{}, false
+		}
+	}
+	return Decision{
+		Allowed:   values[0] == 1,
+		Limit:     burst,
+		Remaining: int(values[1]),
+		Reset:     time.Duration(values[2]) * time.Microsecond,
+	}, true
+}
+
+// reload - ключи в redis сами истекают, а с новым лимитом получают новое имя; в памяти - только запасные бакеты
+func (s *redisStore) reload(limitFor func(key string) (limit, bool)) int {
+	return s.local.reload(limitFor)
+}
+
+func (s *redisStore) cleanup(cutoff time.Time) {
+	s.local.cleanup(cutoff)
+}
+
+func (s *redisStore) size() int {
+	return s.local.size()
+}
+
+// contains - ключи в redis не занимают память процесса, ограничивать их создание не нужно
+func (s *redisStore) contains(key string) bool {
+	return true
+}
+
+func (s *redisStore) close() {
+	s.client.Close()
+}
@@ -0,0 +1,231 @@
+package bucket
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"math"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const (
+	slidingLogInitial    = 16                                // на сколько отметок журнал выделяется сразу
+	slidingLogEntryBytes = int64(unsafe.Sizeof(time.Time{})) // память на одну отметку
+	maxSlidingLogBytes   = 1 << 30                           // предел памяти журналов всех бакетов при max_buckets
+)
+
+// SlidingLog - скользящее окно по журналу: хранит время каждого пропущенного запроса за последнее окно
+// и пропускает запрос, только если их меньше limit. Точный, но память - до limit отметок времени на клиента
+// (24 байта на отметку): журнал растёт вдвое по мере запросов, поэтому редкие клиенты занимают мало
+type SlidingLog struct {
+	limit    int
+	window   time.Duration
+	log      []time.Time // кольцевой буфер до limit отметок, start - самая старая
+	start    int
+	count    int
+	lastSeen time.Time
+	mux      sync.Mutex
+}
+
+func newSlidingLog(rate, burst int, now time.Time) *SlidingLog {
+	return &SlidingLog{
+		limit:    burst,
+		window:   window(rate, burst),
+		log:      make([]time.Time, min(max(burst, 0), slidingLogInitial)),
+		lastSeen: now,
+	}
+}
+
+// validateSlidingLogMemory - отклоняет лимиты sliding_log, журналы которых при rate_limit.max_buckets
+// заполненных бакетах заняли бы больше maxSlidingLogBytes
+func validateSlidingLogMemory(cfg *config.Config) error {
+	maxBuckets := cfg.RateLimit.MaxBuckets
+	if maxBuckets <= 0 {
+		maxBuckets = defaultMaxBuckets
+	}
+	for _, l := range configLimits(cfg) {
+		algorithm := l.Algorithm
+		if algorithm == "" {
+			algorithm = cfg.RateLimit.Algorithm
+		}
+		if algorithm != AlgorithmSlidingLog {
+			continue
+		}
+		if size := int64(l.Burst) * int64(maxBuckets) * slidingLogEntryBytes; size > maxSlidingLogBytes {
+			return fmt.Errorf("rate_limit: sliding_log with burst %d keeps up to %d MB for max_buckets %d, more than %d MB; "+
+				"lower burst or max_buckets or use %s", l.Burst, size>>20, maxBuckets, maxSlidingLogBytes>>20, AlgorithmSlidingWindow)
+		}
+	}
+	return nil
+}
+
+// AllowAt - решение по запросу в момент now
+func (s *SlidingLog) AllowAt(now time.Time) Decision {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.expire(now)
+	allowed := s.count < s.limit
+	if allowed {
+		s.push(now)
+	}
+	// следующее место освободится, когда из окна выйдет самая старая отметка
+	var reset time.Duration
+	if s.count > 0 {
+		reset = s.log[s.start].Add(s.window).Sub(now)
+	}
+	return Decision{Allowed: allowed, Limit: s.limit, Remaining: s.limit - s.count, Reset: reset}
+}
+
+// TakeAt - записывает n запросов, пропущенных другими репликами; журнал хранит не больше limit последних
+func (s *SlidingLog) TakeAt(n int, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.expire(now)
+	for range min(n, s.limit) {
+		if s.count == s.limit {
+			s.start = (s.start + 1) % len(s.log)
+			s.count--
+		}
+		s.push(now)
+	}
+}
+
+// expire - выбрасывает отметки, вышедшие из окна (now - window, now], вызывается под s.mux
+func (s *SlidingLog) expire(now time.Time) {
+	if now.After(s.lastSeen) {
+		s.lastSeen = now
+	}
+	cutoff := now.Add(-s.window)
+	for s.count > 0 && !s.log[s.start].After(cutoff) {
+		s.start = (s.start + 1) % len(s.log)
+		s.count--
+	}
+}
+
+// push - добавляет отметку в конец журнала, отметок должно быть меньше limit. Вызывается под s.mux
+func (s *SlidingLog) push(at time.Time) {
+	if s.count == len(s.log) {
+		s.grow()
+	}
+	s.log[(s.start+s.count)%len(s.log)] = at
+	s.count++
+}
+
+// grow - увеличивает заполненный журнал вдвое, но не больше limit, самая старая отметка переезжает в начало.
+// Вызывается под s.mux
+func (s *SlidingLog) grow() {
+	log := make([]time.Time, min(max(2*len(s.log), 1), s.limit))
+	n := copy(log, s.log[s.start:])
+	copy(log[n:], s.log[:s.start])
+	s.log, s.start = log, 0
+}
+
+// LastSeen - время последнего обращения
+func (s *SlidingLog) LastSeen() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.lastSeen
+}
+
+// SlidingWindow - скользящее окно по счётчикам: считает запросы в текущем и предыдущем фиксированных окнах
+// и оценивает число запросов за последнее окно, взвешивая предыдущее по доле, которая ещё в него попадает.
+// Два счётчика на клиента вместо журнала ценой небольшой погрешности при неравномерном трафике
+type SlidingWindow struct {
+	limit       int
+	window      time.Duration
+	windowStart time.Time // начало текущего фиксированного окна
+	current     int
+	previous    int
+	lastSeen    time.Time
+	mux         sync.Mutex
+}
+
+func newSlidingWindow(rate, burst int, now time.Time) *SlidingWindow {
+	return &SlidingWindow{
+		limit:       burst,
+		window:      window(rate, burst),
+		windowStart: now,
+		lastSeen:    now,
+	}
+}
+
+// AllowAt - решение по запросу в момент now
+func (s *SlidingWindow) AllowAt(now time.Time) Decision {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.advance(now)
+	allowed := s.estimate(now) < float64(s.limit)
+	if allowed {
+		s.current++
+	}
+	estimate := s.estimate(now)
+	remaining := max(int(math.Floor(float64(s.limit)-estimate)), 0)
+	return Decision{Allowed: allowed, Limit: s.limit, Remaining: remaining, Reset: s.nextSlot(now, remaining)}
+}
+
+// estimate - оценка числа запросов за последнее окно: предыдущее окно берётся с весом доли,
+// которая ещё попадает в последнее окно. Вызывается под s.mux
+func (s *SlidingWindow) estimate(now time.Time) float64 {
+	weight := 1 - float64(now.Sub(s.windowStart))/float64(s.window)
+	weight = min(max(weight, 0), 1)
+	return float64(s.previous)*weight + float64(s.current)
+}
+
+// nextSlot - через сколько без новых запросов оценка упадёт так, что остаток станет remaining+1.
+// Оценка убывает линейно: до конца текущего окна за счёт previous, затем за счёт current. Вызывается под s.mux
+func (s *SlidingWindow) nextSlot(now time.Time, remaining int) time.Duration {
+	if remaining >= s.limit {
+		return 0
+	}
+	target := float64(s.limit - remaining - 1)
+	at := s.windowStart
+	switch {
+	case float64(s.current) <= target && s.previous > 0:
+		// успеваем в текущем окне: previous*(1-x) + current = target
+		at = at.Add(time.Duration(math.Ceil((1 - (target-float64(s.current))/float64(s.previous)) * float64(s.window))))
+	case float64(s.current) <= target:
+		return 0
+	default:
+		// в следующем окне current станет previous: current*(1-y) = target
+		at = at.Add(s.window + time.Duration(math.Ceil((1-target/float64(s.current))*float64(s.window))))
+	}
+	return max(at.Sub(now), 0)
+}
+
+// TakeAt - добавляет в текущее окно n запросов, пропущенных другими репликами
+func (s *SlidingWindow) TakeAt(n int, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.advance(now)
+	s.current += n
+}
+
+// advance - сдвигает фиксированные окна к моменту now, вызывается под s.mux
+func (s *SlidingWindow) advance(now time.Time) {
+	if now.After(s.lastSeen) {
+		s.lastSeen = now
+	}
+	// если прошло два окна и больше - оба счётчика устарели
+	if elapsed := now.Sub(s.windowStart); elapsed >= s.window {
+		windows := elapsed / s.window
+		if windows == 1 {
+			s.previous = s.current
+		} else {
+			s.previous = 0
+		}
+		s.current = 0
+		s.windowStart = s.windowStart.Add(windows * s.window)
+	}
+}
+
+// LastSeen - время последнего обращения
+func (s *SlidingWindow) LastSeen() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.lastSeen
+}
@@ -0,0 +1,207 @@
+package bucket
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Хранилища состояния ограничителя для rate_limit.store.type
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+	StoreGossip = "gossip"
+)
+
+// store - где хранится состояние ограничителей клиентов
+type store interface {
+	// allow - решение по запросу для ключа key с лимитом l в момент now
+	allow(key string, l limit, now time.Time) Decision
+	// reload - оставляет состояние ключей, лимит которых не изменился: limitFor отдаёт новый лимит ключа,
+	// false - ключ больше не нужен. Возвращает, сколько ключей осталось
+	reload(limitFor func(key string) (limit, bool)) int
+	// cleanup - удаляет ключи без обращений с момента cutoff
+	cleanup(cutoff time.Time)
+	// size - сколько ключей хранится в памяти процесса
+	size() int
+	// contains - есть ли у ключа состояние в памяти процесса
+	contains(key string) bool
+	// close - освобождает соединения и останавливает фоновые горутины
+	close()
+}
+
+// newStore - хранилище по rate_limit.store. limitFor - лимит ключа по текущему конфигу, maxBuckets - rate_limit.max_buckets,
+// оба для счётчиков других реплик
+func newStore(cfg config.RateLimit, limitFor func(key string) (limit, bool), maxBuckets func() int) (store, error) {
+	switch cfg.Store.Type {
+	case "", StoreMemory:
+		return newMemoryStore(), nil
+	case StoreRedis:
+		return newRedisStore(cfg.Store.Redis)
+	case StoreGossip:
+		return newGossipStore(cfg.Store.Gossip, limitFor, maxBuckets)
+	default:
+		return nil, fmt.Errorf("rate_limit.store: unknown type %q, expected %s|%s|%s", cfg.Store.Type, StoreMemory, StoreRedis, StoreGossip)
+	}
+}
+
+// newStoreOrWarn - хранилище по rate_limit.store, при ошибке - память процесса с предупреждением
+func newStoreOrWarn(cfg *config.Config, limitFor func(key string) (limit, bool), maxBuckets func() int) store {
+	s, err := newStore(cfg.RateLimit, limitFor, maxBuckets)
+	if err != nil {
+		log.Printf("WARN: rate limiter - %v, buckets are kept in memory of this replica\n", err)
+		return newMemoryStore()
+	}
+	return s
+}
+
+// validateStore - проверяет rate_limit.store: тип, обязательные поля и что redis умеет алгоритмы лимитов
+func validateStore(cfg *config.Config) error {
+	conf := cfg.RateLimit.Store
+	switch conf.Type {
+	case "", StoreMemory:
+		return nil
+	case StoreRedis:
+		if conf.Redis.Addr == "" {
+			return fmt.Errorf("rate_limit.store.redis.addr is required")
+		}
+		for _, algorithm := range limitAlgorithms(cfg) {
+			if algorithm != "" && algorithm != AlgorithmTokenBucket && algorithm != AlgorithmGCRA {
+				return fmt.Errorf("rate_limit.store redis supports %s and %s algorithms only, got %s",
+					AlgorithmTokenBucket, AlgorithmGCRA, algorithm)
+			}
+		}
+		return nil
+	case StoreGossip:
+		if conf.Gossip.Listen == "" {
+			return fmt.Errorf("rate_limit.store.gossip.listen is required")
+		}
+		// без подписи любой, кто достучится до listen, может списывать чужие лимиты
+		if conf.Gossip.Secret == "" {
+			return fmt.Errorf("rate_limit.store.gossip.secret is required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("rate_limit.store: unknown type %q, expected %s|%s|%s", conf.Type, StoreMemory, StoreRedis, StoreGossip)
+	}
+}
+
+// limitAlgorithms - алгоритмы всех лимитов конфига: общий, по умолчанию, уровней и маршрутов
+func limitAlgorithms(cfg *config.Config) []string {
+	algorithms := []string{cfg.RateLimit.Algorithm}
+	for _, l := range configLimits(cfg) {
+		algorithms = append(algorithms, l.Algorithm)
+	}
+	return algorithms
+}
+
+// configLimits - все лимиты конфига: по умолчанию, уровней и маршрутов
+func configLimits(cfg *config.Config) []config.Limit {
+	limits := []config.Limit{cfg.RateLimit.Default}
+	for _, t := range slices.Concat(cfg.RateLimit.Tiers, cfg.RateLimit.SpecialLimits) {
+		limits = append(limits, t.Limit)
+	}
+	for _, route := range cfg.Routes {
+		if route.RateLimit != nil {
+			limits = append(limits, *route.RateLimit)
+		}
+	}
+	return limits
+}
+
+// memoryStore - ограничители клиентов в памяти процесса, хранилище по умолчанию
+type memoryStore struct {
+	mux      sync.Mutex
+	limiters map[string]*limiterEntry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{limiters: make(map[string]*limiterEntry)}
+}
+
+// entry - ограничитель ключа, новый клиент получает его по лимиту l. Вызывается под m.mux
+func (m *memoryStore) entry(key string, l limit, now time.Time) *limiterEntry {
+	entry, exists := m.limiters[key]
+	if !exists { // новый клиент
+		entry = &limiterEntry{Limiter: newLimiter(l, now), limit: l}
+		m.limiters[key] = entry
+	}
+	return entry
+}
+
+func (m *memoryStore) allow(key string, l limit, now time.Time) Decision {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.entry(key, l, now).AllowAt(now)
+}
+
+// take - списывает n запросов, пропущенных другой репликой. Новый ключ заводится, только если ключей меньше maxKeys,
+// false - ключ пропущен
+func (m *memoryStore) take(key string, l limit, n int, now time.Time, maxKeys int) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, exists := m.limiters[key]; !exists && len(m.limiters) >= maxKeys {
+		return false
+	}
+	m.entry(key, l, now).TakeAt(n, now)
+	return true
+}
+
+func (m *memoryStore) reload(limitFor func(key string) (limit, bool)) int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for key, entry := range m.limiters {
+		if l, ok := limitFor(key); !ok || !entry.limit.sameAs(l) {
+			delete(m.limiters, key)
+		}
+	}
+	return len(m.limiters)
+}
+
+func (m *memoryStore) cleanup(cutoff time.Time) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for key, entry := range m.limiters {
+		if entry.LastSeen().Before(cutoff) {
+			delete(m.limiters, key)
+		}
+	}
+}
+
+func (m *memoryStore) size() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return len(m.limiters)
+}
+
+func (m *memoryStore) contains(key string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	_, ok := m.limiters[key]
+	return ok
+}
+
+func (m *memoryStore) close() {}
+
+// warnLimiter - пишет предупреждение не чаще раза в interval, чтобы недоступный redis или реплика
+// не засыпали журнал сообщением на каждый запрос
+type warnLimiter struct {
+	interval time.Duration
+	last     atomic.Int64 // UnixNano последнего предупреждения
+}
+
+func (w *warnLimiter) printf(format string, args ...any) {
+	now := time.Now().UnixNano()
+	last := w.last.Load()
+	if now-last < int64(w.interval) || !w.last.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf(format, args...)
+}
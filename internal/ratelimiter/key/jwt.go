@@ -0,0 +1,182 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"loadbalancer/internal/config"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtKey - проверка подписи токена для jwt_verified
+type jwtKey struct {
+	secret []byte           // HS256/384/512
+	public crypto.PublicKey // RS256/384/512 или ES256/384/512
+}
+
+// newJWTKey - ключ по claim sub из токена в заголовке (Authorization: Bearer <token> по умолчанию).
+// verify - проверять подпись и сроки exp/nbf; без проверки sub берётся как есть, что годится только
+// если токен уже проверен перед балансировщиком
+func newJWTKey(conf config.JWT, verify bool) (Extractor, error) {
+	header := conf.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	header = http.CanonicalHeaderKey(header)
+
+	var k *jwtKey
+	if verify {
+		var err error
+		if k, err = loadJWTKey(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(r *http.Request) (string, bool) {
+		token := r.Header.Get(header)
+		if scheme, rest, ok := strings.Cut(token, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(rest)
+		}
+		sub, err := jwtSubject(token, k)
+		if err != nil {
+			return "", false
+		}
+		return nonEmpty(sub)
+	}, nil
+}
+
+func loadJWTKey(conf config.JWT) (*jwtKey, error) {
+	switch {
+	case conf.Secret != "" && conf.PublicKeyFile != "":
+		return nil, fmt.Errorf("jwt: secret and public_key_file are mutually exclusive")
+	case conf.Secret != "":
+		return &jwtKey{secret: []byte(conf.Secret)}, nil
+	case conf.PublicKeyFile != "":
+		data, err := os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("jwt: no PEM block in %s", conf.PublicKeyFile)
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		switch public.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("jwt: unsupported public key type %T", public)
+		}
+		return &jwtKey{public: public}, nil
+	default:
+		return nil, fmt.Errorf("jwt_verified needs rate_limit.jwt.secret or rate_limit.jwt.public_key_file")
+	}
+}
+
+// jwtSubject - claim sub из компактного JWT, k == nil - без проверки подписи и сроков
+func jwtSubject(token string, k *jwtKey) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	var claims struct {
+		Sub string   `json:"sub"`
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", err
+	}
+	if k == nil {
+		return claims.Sub, nil
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return "", err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	if err := k.verify(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	now := float64(time.Now().Unix())
+	if claims.Exp != nil && now >= *claims.Exp {
+		return "", fmt.Errorf("token expired")
+	}
+	if claims.Nbf != nil && now < *claims.Nbf {
+		return "", fmt.Errorf("token not valid yet")
+	}
+	return claims.Sub, nil
+}
+
+// verify - проверка подписи; алгоритм из токена должен подходить к настроенному ключу (alg=none не принимается)
+func (k *jwtKey) verify(alg, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch public := k.public.(type) {
+	case nil:
+		if !strings.HasPrefix(alg, "HS") {
+			return fmt.Errorf("alg %q does not match secret", alg)
+		}
+		mac := hmac.New(hash.New, k.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("alg %q does not match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(public, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("alg %q does not match ECDSA key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(public, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+	return nil
+}
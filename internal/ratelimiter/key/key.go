@@ -0,0 +1,129 @@
+package key
+
+import (
+	"fmt"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"net/http"
+	"strings"
+)
+
+// Extractor - достаёт из запроса ключ клиента для ограничителя. false - ключа в запросе нет,
+// и клиент ограничивается по IP
+type Extractor func(r *http.Request) (string, bool)
+
+// Options - то, что нужно извлекателям кроме самого запроса
+type Options struct {
+	JWT   config.JWT
+	Route func(r *http.Request) string // имя маршрута запроса, nil - ключ route недоступен
+}
+
+// compositeSep - разделитель частей составного ключа в rate_limit.key и в значении ключа
+const compositeSep = "+"
+
+// New - разбирает rate_limit.key: ip | header:<имя> | query:<имя> | cookie:<имя> | route | jwt | jwt_verified,
+// или несколько через "+" (например, route+header:X-API-Key). Пустая строка - ip
+func New(spec string, opts Options) (Extractor, error) {
+	if spec == "" {
+		spec = "ip"
+	}
+	parts := strings.Split(spec, compositeSep)
+	extractors := make([]Extractor, len(parts))
+	for i, part := range parts {
+		e, err := newPart(strings.TrimSpace(part), opts)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limit.key %q: %w", spec, err)
+		}
+		extractors[i] = e
+	}
+	if len(extractors) == 1 {
+		return extractors[0], nil
+	}
+	return composite(extractors), nil
+}
+
+// IsIP - ключ по IP клиента: тогда работают группировка IPv6 и подсети в tiers
+func IsIP(spec string) bool {
+	return spec == "" || spec == "ip"
+}
+
+// ClientControlled - может ли клиент подставить в ключ любое значение: header, query, cookie или jwt без проверки подписи.
+// ip, route и jwt_verified клиент не выбирает
+func ClientControlled(spec string) bool {
+	for _, part := range strings.Split(spec, compositeSep) {
+		kind, _, _ := strings.Cut(strings.TrimSpace(part), ":")
+		switch kind {
+		case "header", "query", "cookie", "jwt":
+			return true
+		}
+	}
+	return false
+}
+
+func newPart(spec string, opts Options) (Extractor, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "ip":
+		return ipKey, nil
+	case "route":
+		if opts.Route == nil {
+			return nil, fmt.Errorf("route key is not available")
+		}
+		return func(r *http.Request) (string, bool) { return nonEmpty(opts.Route(r)) }, nil
+	case "header":
+		if name == "" {
+			return nil, fmt.Errorf("header name is empty")
+		}
+		name = http.CanonicalHeaderKey(name)
+		return func(r *http.Request) (string, bool) { return nonEmpty(r.Header.Get(name)) }, nil
+	case "query":
+		if name == "" {
+			return nil, fmt.Errorf("query parameter name is empty")
+		}
+		return func(r *http.Request) (string, bool) { return nonEmpty(r.URL.Query().Get(name)) }, nil
+	case "cookie":
+		if name == "" {
+			return nil, fmt.Errorf("cookie name is empty")
+		}
+		return func(r *http.Request) (string, bool) {
+			c, err := r.Cookie(name)
+			if err != nil {
+				return "", false
+			}
+			return nonEmpty(c.Value)
+		}, nil
+	case "jwt":
+		return newJWTKey(opts.JWT, false)
+	case "jwt_verified":
+		return newJWTKey(opts.JWT, true)
+	default:
+		return nil, fmt.Errorf("unknown key %q, expected ip|header:<name>|query:<name>|cookie:<name>|route|jwt|jwt_verified", spec)
+	}
+}
+
+// composite - ключ из нескольких частей; если хоть одной части нет, ключа нет
+func composite(extractors []Extractor) Extractor {
+	return func(r *http.Request) (string, bool) {
+		values := make([]string, len(extractors))
+		for i, e := range extractors {
+			v, ok := e(r)
+			if !ok {
+				return "", false
+			}
+			values[i] = v
+		}
+		return strings.Join(values, compositeSep), true
+	}
+}
+
+func ipKey(r *http.Request) (string, bool) {
+	ip, err := clientip.Get(r)
+	if err != nil {
+		return "", false
+	}
+	return ip, true
+}
+
+func nonEmpty(v string) (string, bool) {
+	return v, v != ""
+}
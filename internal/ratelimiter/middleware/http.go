@@ -3,24 +3,49 @@ package middleware
 import (
 	"loadbalancer/internal/errors"
 	"loadbalancer/internal/ratelimiter/bucket"
+	"loadbalancer/internal/reqinfo"
+	"loadbalancer/internal/tracing"
 	"log"
-	"net"
 	"net/http"
-	"strings"
 )
 
 // RateLimitMiddleware - возвращает новый http.Handler
 func RateLimitMiddleware(bm *bucket.BucketManager, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, err := getIP(r)
+		client, err := bm.Identify(r)
 		if err != nil {
 			log.Printf("WARN: http.go - Internal Server Error: %v\n", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if !bm.Allow(ip) {
-			log.Printf("WARN: http.go - IP: %s send too many requests\n", ip)
+		_, span := tracing.Start(r.Context(), "rate_limit", tracing.KindInternal)
+		denied := bm.Denied(client.IP)
+		var decision bucket.Decision
+		if !denied {
+			decision = bm.Allow(client)
+		}
+		allowed := !denied && decision.Allowed
+		span.SetAttr("client.address", client.IP)
+		span.SetAttr("rate_limit.allowed", allowed)
+		span.End()
+
+		// RateLimit-* на каждый ответ, чтобы клиент знал свой остаток, и Retry-After на 429
+		decision.SetHeaders(w.Header())
+
+		if denied {
+			reqinfo.From(r.Context()).RateLimited = true
+			log.Printf("WARN: http.go - IP: %s is in denylist\n", client.IP)
+			err := errors.NewAPIError(http.StatusForbidden, "Forbidden")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.Code)
+			w.Write(err.ToJSON())
+			return
+		}
+
+		if !allowed {
+			reqinfo.From(r.Context()).RateLimited = true
+			log.Printf("WARN: http.go - %s send too many requests\n", client)
 			err := errors.NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded")
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(err.Code)
@@ -31,15 +56,3 @@ func RateLimitMiddleware(bm *bucket.BucketManager, next http.Handler) http.Handl
 		next.ServeHTTP(w, r)
 	})
 }
-
-// getIP - возвращает реальный IP клиента, если тот использует прокси
-func getIP(r *http.Request) (string, error) {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return strings.Split(xff, ",")[0], nil
-	}
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "", err
-	}
-	return ip, nil
-}
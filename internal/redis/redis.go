@@ -0,0 +1,252 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Значения по умолчанию для Options
+const (
+	defaultTimeout  = time.Second
+	defaultPoolSize = 16
+)
+
+// Error - ошибка, которую вернул сам сервер (ответ -ERR ...). Соединение после неё остаётся рабочим
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Options - куда и как подключаться
+type Options struct {
+	Addr     string        // host:port
+	Password string        // для AUTH, пусто - без авторизации
+	DB       int           // номер базы для SELECT
+	Timeout  time.Duration // на подключение и на каждую команду, по умолчанию 1s
+	PoolSize int           // сколько свободных соединений держать, по умолчанию 16
+}
+
+// Client - минимальный клиент протокола Redis (RESP2) с пулом соединений.
+// Ответы: string (простые строки и bulk), int64, []any (массивы), nil (null), Error (ошибки сервера)
+type Client struct {
+	opts Options
+	idle chan *conn
+
+	mux    sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// New - клиент с настройками opts, соединения открываются при первых командах
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	return &Client{opts: opts, idle: make(chan *conn, opts.PoolSize)}
+}
+
+// Do - выполняет команду и возвращает ответ сервера
+func (c *Client) Do(args ...string) (any, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(c.opts.Timeout, args)
+	var serverErr Error
+	if err != nil && !errors.As(err, &serverErr) {
+		// сетевая ошибка или сбой протокола - состояние соединения неизвестно
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Close - закрывает свободные соединения, занятые закрываются по возвращении
+func (c *Client) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.idle)
+		for cn := range c.idle {
+			cn.Close()
+		}
+	}
+	return nil
+}
+
+// get - свободное соединение из пула или новое
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn, ok := <-c.idle:
+		if ok {
+			return cn, nil
+		}
+		return nil, errors.New("redis: client is closed")
+	default:
+	}
+	return c.dial()
+}
+
+// put - возвращает соединение в пул, лишние закрываются
+func (c *Client) put(cn *conn) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		cn.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// dial - новое соединение с AUTH и SELECT по настройкам
+func (c *Client) dial() (*conn, error) {
+	nc, err := net.DialTimeout("tcp", c.opts.Addr, c.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.opts.Password != "" {
+		if _, err := cn.do(c.opts.Timeout, []string{"AUTH", c.opts.Password}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: auth: %w", err)
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.do(c.opts.Timeout, []string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: select %d: %w", c.opts.DB, err)
+		}
+	}
+	return cn, nil
+}
+
+// do - отправляет команду массивом bulk-строк и читает ответ
+func (cn *conn) do(timeout time.Duration, args []string) (any, error) {
+	if err := cn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// readReply - читает один ответ RESP2
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply line")
+	}
+	payload := line[1:]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad integer %q", payload)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: bad bulk length %q", payload)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: bad array length %q", payload)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			// ошибка элемента не портит поток, поэтому возвращаем её как значение
+			item, err := readReply(r)
+			var serverErr Error
+			if errors.As(err, &serverErr) {
+				item = serverErr
+			} else if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+// Script - Lua-скрипт: выполняется по хешу через EVALSHA, а если сервер его ещё не знает - через EVAL,
+// после чего сервер кеширует его сам
+type Script struct {
+	src string
+	sha string
+}
+
+// NewScript - скрипт с исходным кодом src
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, sha: hex.EncodeToString(sum[:])}
+}
+
+// Run - выполняет скрипт атомарно на сервере с ключами keys и аргументами args
+func (s *Script) Run(c *Client, keys []string, args ...string) (any, error) {
+	params := make([]string, 0, len(keys)+len(args)+1)
+	params = append(params, strconv.Itoa(len(keys)))
+	params = append(params, keys...)
+	params = append(params, args...)
+
+	reply, err := c.Do(append([]string{"EVALSHA", s.sha}, params...)...)
+	var serverErr Error
+	if errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "NOSCRIPT") {
+		return c.Do(append([]string{"EVAL", s.src}, params...)...)
+	}
+	return reply, err
+}
@@ -0,0 +1,27 @@
+package reqinfo
+
+import "context"
+
+// Info - сведения о запросе, которые собирают разные слои балансировщика
+// (ограничитель, распределитель) для журнала доступа
+type Info struct {
+	Backend     string // адрес сервера, который обработал запрос (последняя попытка)
+	Retries     int    // сколько раз запрос повторялся на другом сервере
+	RateLimited bool   // запрос отклонён ограничителем
+}
+
+type infoKey struct{}
+
+// New - кладёт в контекст пустой Info и возвращает его для заполнения
+func New(ctx context.Context) (context.Context, *Info) {
+	info := &Info{}
+	return context.WithValue(ctx, infoKey{}, info), info
+}
+
+// From - Info запроса; если журнал доступа выключен, возвращается заглушка, запись в которую ни на что не влияет
+func From(ctx context.Context) *Info {
+	if info, ok := ctx.Value(infoKey{}).(*Info); ok {
+		return info
+	}
+	return &Info{}
+}
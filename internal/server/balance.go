@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/errors"
+	"loadbalancer/internal/headers"
+	"loadbalancer/internal/metrics"
+	"loadbalancer/internal/reqinfo"
+	"loadbalancer/internal/tracing"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BalanceRequest - распределитель запросов по серверам выбранной стратегией (lb_method).
+// При ошибке бэкенда запрос повторяется на ещё не опробованном сервере согласно политике retry
+func (lb *LoadBalancer) BalanceRequest(w http.ResponseWriter, r *http.Request) {
+	bal := lb.balancing.Load()
+	rt := bal.route(r)
+	if rt == nil {
+		writeAPIError(w, errors.NewAPIError(http.StatusNotFound, "No route for the request"))
+		return
+	}
+	info := reqinfo.From(r.Context())
+	if rt.rateLimited && !lb.allowRoute(rt, w, r) {
+		info.RateLimited = true
+		writeAPIError(w, errors.NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded"))
+		return
+	}
+	vars := headerVars(bal.headers, r)
+	r = rt.rewritePath(r)
+
+	attempts := bal.retry.attemptsFor(r)
+
+	var body []byte
+	if attempts > 1 {
+		var replayable bool
+		var err error
+		body, replayable, err = bufferBody(r, bal.retry.maxBodyBytes)
+		if err != nil {
+			writeAPIError(w, errors.NewAPIError(http.StatusBadRequest, "Failed to read request body"))
+			return
+		}
+		if !replayable {
+			attempts = 1
+		}
+	}
+
+	tried := make(map[*backend.Backend]struct{}, attempts)
+	for i := 0; i < attempts; i++ {
+		_, span := tracing.Start(r.Context(), "select_backend", tracing.KindInternal)
+		peer, candidates, err := selectBackend(r, rt, tried)
+		span.SetAttr("lb.route", rt.name)
+		span.SetAttr("lb.attempt", i+1)
+		span.SetAttr("lb.candidates", len(candidates))
+		if peer != nil {
+			span.SetAttr("lb.backend", peer.URL.String())
+		}
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			if rules := bal.headers; rules != nil {
+				rules.ApplyError(w.Header(), vars)
+			}
+			if i == 0 { // все мертвы
+				log.Printf("FATAL-ERROR: ALL BACKEND-SERVERS ARE DOWN!💀 (%v)", err)
+				writeAPIError(w, errors.NewAPIError(http.StatusServiceUnavailable, "Sorry, the service is currently unavailable. Please try again later."))
+			} else {
+				writeAPIError(w, errors.NewAPIError(http.StatusBadGateway, "Bad gateway"))
+			}
+			return
+		}
+		info.Backend, info.Retries = peer.URL.String(), i
+
+		// последняя попытка (или последний сервер) отдаёт клиенту всё как есть
+		attempt := &backend.Attempt{}
+		if i < attempts-1 && len(candidates) > 1 {
+			attempt.RetryStatus = bal.retry.retryStatus
+			attempt.RetryError = bal.retry.retryError
+		}
+		if rules := bal.headers; rules != nil {
+			vars.Backend = peer.URL.String()
+			attemptVars := vars
+			attempt.Director = func(req *http.Request) { rules.ApplyRequest(req, attemptVars) }
+			attempt.ModifyResponse = func(resp *http.Response) { rules.ApplyResponse(resp, attemptVars) }
+			attempt.ModifyError = func(header http.Header) { rules.ApplyError(header, attemptVars) }
+		}
+
+		req := r.WithContext(backend.WithAttempt(r.Context(), attempt))
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+
+		lb.serveBackend(peer, w, req, attempt)
+		if !attempt.Retry {
+			return
+		}
+		log.Printf("WARN: %s %s on %s failed (%v), retrying on another server (attempt %d/%d)",
+			r.Method, r.URL.Path, peer.URL, attempt.Err, i+2, attempts)
+	}
+}
+
+// selectBackend - выбирает сервер пула маршрута среди ещё не опробованных и отмечает его опробованным.
+// Если выключатель выбранного сервера не пропускает запрос (пробные запросы уже разобраны), выбор повторяется без него
+func selectBackend(r *http.Request, rt *route, tried map[*backend.Backend]struct{}) (*backend.Backend, []*backend.Backend, error) {
+	for {
+		candidates := untried(rt.pool.AliveBackends(), tried)
+		peer, err := balancer.Select(rt.strategy, r, rt.pool, candidates)
+		if err != nil {
+			return nil, candidates, err
+		}
+		tried[peer] = struct{}{}
+		if peer.AllowRequest() {
+			return peer, candidates, nil
+		}
+	}
+}
+
+// headerVars - значения переменных для шаблонов заголовков, nil rules - правил нет
+func headerVars(rules *headers.Rules, r *http.Request) headers.Vars {
+	if rules == nil {
+		return headers.Vars{}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	ip, _ := clientip.Get(r)
+	return headers.Vars{
+		ClientIP:    ip,
+		RequestID:   rules.RequestID(r),
+		Host:        r.Host,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Scheme:      scheme,
+		TrustedPeer: clientip.TrustedPeer(r),
+	}
+}
+
+// allowRoute - проверка собственного лимита маршрута для клиента. Заголовки RateLimit-* ответа
+// остаются от более строгого из общего лимита и лимита маршрута
+func (lb *LoadBalancer) allowRoute(rt *route, w http.ResponseWriter, r *http.Request) bool {
+	bm := lb.bm.Load()
+	if bm == nil {
+		return true
+	}
+	client, err := bm.Identify(r)
+	if err != nil {
+		return true // общий ограничитель уже отклонил бы такой запрос
+	}
+	decision := bm.AllowRoute(rt.name, client)
+	decision.SetHeaders(w.Header())
+	if !decision.Allowed {
+		log.Printf("WARN: route %s - %s send too many requests\n", rt.name, client)
+		return false
+	}
+	return true
+}
+
+// serveBackend - проксирует запрос на выбранный бэкенд, считая подключения, время ответа и метрики
+func (lb *LoadBalancer) serveBackend(peer *backend.Backend, w http.ResponseWriter, r *http.Request, attempt *backend.Attempt) {
+	peer.IncrementConn()
+	defer peer.DecrementConn()
+
+	// спан запроса к бэкенду становится родителем для спанов самого бэкенда
+	ctx, span := tracing.Start(r.Context(), "upstream", tracing.KindClient)
+	if span != nil {
+		r = r.WithContext(ctx)
+		r.Header = r.Header.Clone() // заголовки общие у всех попыток, не портим исходный запрос
+		tracing.Inject(span, r.Header)
+		span.SetAttr("server.address", peer.URL.String())
+	}
+
+	start := time.Now()
+	peer.ReverseProxy.ServeHTTP(w, r)
+	elapsed := time.Since(start)
+	peer.ObserveLatency(elapsed)
+
+	if attempt.Status != 0 {
+		span.SetAttr("http.response.status_code", attempt.Status)
+	}
+	span.SetError(attempt.Err)
+	span.End()
+
+	code := "error"
+	if attempt.Status != 0 {
+		code = strconv.Itoa(attempt.Status)
+	}
+	metrics.RequestsTotal.Inc(peer.URL.String(), code)
+	metrics.RequestDuration.Observe(elapsed.Seconds(), peer.URL.String(), code)
+}
+
+// untried - кандидаты, на которых запрос ещё не пробовали
+func untried(candidates []*backend.Backend, tried map[*backend.Backend]struct{}) []*backend.Backend {
+	if len(tried) == 0 {
+		return candidates
+	}
+	rest := candidates[:0]
+	for _, b := range candidates {
+		if _, ok := tried[b]; !ok {
+			rest = append(rest, b)
+		}
+	}
+	return rest
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr *errors.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	w.Write(apiErr.ToJSON())
+}
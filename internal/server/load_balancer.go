@@ -2,19 +2,110 @@ package server
 
 import (
 	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/headers"
+	"loadbalancer/internal/ratelimiter/bucket"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
 type LoadBalancer struct {
-	port   int // порт балансировщика (по дефолту 8080)
-	pool   *backend.Pool
-	server *http.Server // для shutdown
+	port          int                                  // порт балансировщика (по дефолту 8080)
+	pool          *backend.Pool                        // основной пул backends
+	upstreams     map[string]*backend.Pool             // именованные пулы upstreams, задаются до запуска
+	balancing     atomic.Pointer[balancing]            // метод балансировки и повторы, заменяются целиком при перезагрузке конфига
+	bm            atomic.Pointer[bucket.BucketManager] // ограничитель запросов, появляется в StartServer
+	reloadMux     sync.Mutex                           // перезагрузки конфига выполняются по одной
+	poolSettings  *poolSettings                        // настройки пулов при запуске, меняются только перезапуском
+	server        *http.Server                         // для shutdown
+	tlsServer     *http.Server                         // HTTPS, nil - tls выключен
+	metricsServer *http.Server                         // /metrics, nil - метрики выключены
+}
+
+// balancing - настройки балансировки, которые читаются на каждом запросе
+type balancing struct {
+	retry    *RetryPolicy   // повтор запроса на другом сервере, nil - без повторов
+	routes   []*route       // таблица маршрутов, проверяется по порядку
+	fallback *route         // основной пул с методом из lb_method - для запросов без подходящего маршрута
+	headers  *headers.Rules // правила заголовков, nil - заголовки проксируются как есть
 }
 
 // NewLoadBalancer - конструктор для объекта LoadBalancer
-func NewLoadBalancer(port int, pool *backend.Pool) *LoadBalancer {
-	return &LoadBalancer{
-		port: port,
-		pool: pool,
+func NewLoadBalancer(port int, pool *backend.Pool, strategy balancer.Strategy, retry *RetryPolicy) *LoadBalancer {
+	lb := &LoadBalancer{
+		port:      port,
+		pool:      pool,
+		upstreams: make(map[string]*backend.Pool),
+	}
+	lb.balancing.Store(&balancing{retry: retry, fallback: lb.defaultRoute(strategy)})
+	return lb
+}
+
+// defaultRoute - маршрут на основной пул
+func (lb *LoadBalancer) defaultRoute(strategy balancer.Strategy) *route {
+	return &route{name: defaultRoute, pool: lb.pool, strategy: strategy}
+}
+
+// AddUpstream - добавляет именованный пул для маршрутов, вызывается до ConfigureRoutes и запуска сервера
+func (lb *LoadBalancer) AddUpstream(name string, pool *backend.Pool) {
+	lb.upstreams[name] = pool
+}
+
+// SetBucketManager - ограничитель запросов для лимитов маршрутов и ключа route (StartServer задаёт его сам)
+func (lb *LoadBalancer) SetBucketManager(bm *bucket.BucketManager) {
+	bm.SetRouteResolver(lb.routeName)
+	lb.bm.Store(bm)
+}
+
+// ConfigureRoutes - проверяет и включает таблицу маршрутов из конфига. Стратегия основного пула из NewLoadBalancer
+// считается построенной по conf.LBMethod и conf.Hash, чтобы перезагрузка с теми же настройками её не пересоздавала,
+// а пулы - по настройкам conf, чтобы перезагрузка предупреждала о разделах, которые меняются только перезапуском
+func (lb *LoadBalancer) ConfigureRoutes(conf *config.Config) error {
+	routes, err := newRoutes(conf, lb.pool, lb.upstreams)
+	if err != nil {
+		return err
+	}
+	lb.poolSettings = newPoolSettings(conf)
+	bal := *lb.balancing.Load()
+	bal.routes = routes
+	fallback := *bal.fallback
+	fallback.lbMethod, fallback.hash = conf.LBMethod, conf.Hash
+	bal.fallback = &fallback
+	lb.balancing.Store(&bal)
+	return nil
+}
+
+// ConfigureHeaders - проверяет и включает правила изменения заголовков
+func (lb *LoadBalancer) ConfigureHeaders(conf config.Headers) error {
+	rules, err := headers.New(conf)
+	if err != nil {
+		return err
+	}
+	bal := *lb.balancing.Load()
+	bal.headers = rules
+	lb.balancing.Store(&bal)
+	return nil
+}
+
+// routeName - имя маршрута запроса (default - основной пул), "" - подходящего маршрута нет
+func (lb *LoadBalancer) routeName(r *http.Request) string {
+	if rt := lb.balancing.Load().route(r); rt != nil {
+		return rt.name
+	}
+	return ""
+}
+
+// route - первый подходящий маршрут; без подходящего - основной пул, если в нём есть сервера
+func (bal *balancing) route(r *http.Request) *route {
+	for _, rt := range bal.routes {
+		if rt.matches(r) {
+			return rt
+		}
+	}
+	if len(bal.routes) == 0 || bal.fallback.pool.GetLenBackends() > 0 {
+		return bal.fallback
 	}
+	return nil
 }
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/headers"
+	"loadbalancer/internal/ratelimiter/bucket"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Reload - применяет новый конфиг на лету, не разрывая соединений: списки серверов основного пула
+// и upstreams, lb_method, маршруты, правила заголовков, доверенные прокси, retry и лимиты rate_limit. Сначала всё проверяется, и только потом применяется,
+// поэтому некорректный конфиг возвращает ошибку и оставляет в силе старый. Изменения разделов, которые применяются
+// к пулам только при запуске (outlier_detection, circuit_breaker, health_check, upstream_tls), пропускаются с предупреждением
+func (lb *LoadBalancer) Reload(conf *config.Config) error {
+	lb.reloadMux.Lock()
+	defer lb.reloadMux.Unlock()
+
+	// пулы upstreams создаются при запуске (со своими проверками здоровья), на лету меняются только их сервера.
+	// Набор пулов проверяется до маршрутов, чтобы маршрут на удалённый пул не скрыл настоящую причину
+	if len(conf.Upstreams) != len(lb.upstreams) {
+		return fmt.Errorf("upstreams: adding or removing upstreams requires a restart")
+	}
+	for _, up := range conf.Upstreams {
+		pool, ok := lb.upstreams[up.Name]
+		if !ok {
+			return fmt.Errorf("upstreams: adding or removing upstreams requires a restart (%s)", up.Name)
+		}
+		if err := pool.ValidateBackends(up.Backends); err != nil {
+			return fmt.Errorf("upstream %s: %w", up.Name, err)
+		}
+	}
+
+	fallback, err := lb.newDefaultRoute(conf)
+	if err != nil {
+		return err
+	}
+	retry, err := NewRetryPolicy(conf.Retry)
+	if err != nil {
+		return err
+	}
+	routes, err := newRoutes(conf, lb.pool, lb.upstreams)
+	if err != nil {
+		return err
+	}
+	headerRules, err := headers.New(conf.Headers)
+	if err != nil {
+		return err
+	}
+	resolver, err := clientip.New(conf.ClientIP)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Validate(conf); err != nil {
+		return err
+	}
+
+	if err := lb.pool.ValidateBackends(conf.Backends); err != nil {
+		return fmt.Errorf("backends: %w", err)
+	}
+
+	// списки серверов всех пулов уже проверены. SyncBackends может отказать, только если файлы сертификатов
+	// пропали после проверки: тогда этот пул остаётся со старыми серверами, а остальной конфиг всё равно применяется,
+	// чтобы пулы не остались наполовину в старом конфиге, наполовину в новом без ошибки в ответе
+	if err := lb.pool.SyncBackends(conf.Backends); err != nil {
+		log.Printf("WARN: backends: %v, keeping the current backends\n", err)
+	}
+	for _, up := range conf.Upstreams {
+		if err := lb.upstreams[up.Name].SyncBackends(up.Backends); err != nil {
+			log.Printf("WARN: upstream %s: %v, keeping the current backends\n", up.Name, err)
+		}
+	}
+	if ignored := lb.poolSettings.changed(conf); len(ignored) > 0 {
+		log.Printf("WARN: %s changes require a restart, keeping the current settings\n", strings.Join(ignored, ", "))
+	}
+	keepStrategies(lb.balancing.Load(), slices.Concat(routes, []*route{fallback}))
+	lb.balancing.Store(&balancing{retry: retry, routes: routes, fallback: fallback, headers: headerRules})
+	clientip.SetDefault(resolver)
+	if bm := lb.bm.Load(); bm != nil {
+		bm.Reload(conf)
+	}
+
+	log.Printf("INFO: config reloaded: lb_method=%s, backends=%d, routes=%d\n", conf.LBMethod, len(conf.Backends), len(routes))
+	return nil
+}
+
+// newDefaultRoute - маршрут на основной пул с методом lb_method
+func (lb *LoadBalancer) newDefaultRoute(conf *config.Config) (*route, error) {
+	strategy, err := balancer.New(conf.LBMethod, balancer.Options{Hash: conf.Hash})
+	if err != nil {
+		return nil, err
+	}
+	rt := lb.defaultRoute(strategy)
+	rt.lbMethod, rt.hash = conf.LBMethod, conf.Hash
+	return rt, nil
+}
+
+// keepStrategies - маршруты, у которых не изменились имя, пул, lb_method и hash, продолжают со стратегией
+// из prev: перезагрузка не сбрасывает очередь RR, веса WRR и кольцо CH
+func keepStrategies(prev *balancing, routes []*route) {
+	old := make(map[string]*route, len(prev.routes)+1)
+	for _, rt := range slices.Concat(prev.routes, []*route{prev.fallback}) {
+		old[rt.name] = rt
+	}
+	for _, rt := range routes {
+		if o, ok := old[rt.name]; ok && o.lbMethod != "" && o.pool == rt.pool && o.lbMethod == rt.lbMethod && o.hash == rt.hash {
+			rt.strategy = o.strategy
+		}
+	}
+}
+
+// poolSettings - разделы конфига, с которыми пулы созданы при запуске; перезагрузка их не меняет
+type poolSettings struct {
+	outlierDetection config.OutlierDetection
+	circuitBreaker   config.CircuitBreaker
+	healthCheck      config.HealthCheck
+	upstreamTLS      config.UpstreamTLS
+	upstreamHealth   map[string]*config.HealthCheck // health_check upstreams по имени
+}
+
+func newPoolSettings(conf *config.Config) *poolSettings {
+	s := &poolSettings{
+		outlierDetection: conf.OutlierDetection,
+		circuitBreaker:   conf.CircuitBreaker,
+		healthCheck:      conf.HealthCheck,
+		upstreamTLS:      conf.UpstreamTLS,
+		upstreamHealth:   make(map[string]*config.HealthCheck, len(conf.Upstreams)),
+	}
+	for _, up := range conf.Upstreams {
+		s.upstreamHealth[up.Name] = up.HealthCheck
+	}
+	return s
+}
+
+// changed - разделы conf, которые отличаются от настроек пулов при запуске; nil s - настройки неизвестны
+func (s *poolSettings) changed(conf *config.Config) []string {
+	if s == nil {
+		return nil
+	}
+	var changed []string
+	for _, section := range []struct {
+		name       string
+		start, now any
+	}{
+		{"outlier_detection", s.outlierDetection, conf.OutlierDetection},
+		{"circuit_breaker", s.circuitBreaker, conf.CircuitBreaker},
+		{"health_check", s.healthCheck, conf.HealthCheck},
+		{"upstream_tls", s.upstreamTLS, conf.UpstreamTLS},
+	} {
+		if !reflect.DeepEqual(section.start, section.now) {
+			changed = append(changed, section.name)
+		}
+	}
+	for _, up := range conf.Upstreams {
+		if !reflect.DeepEqual(s.upstreamHealth[up.Name], up.HealthCheck) {
+			changed = append(changed, "upstreams."+up.Name+".health_check")
+		}
+	}
+	return changed
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"loadbalancer/internal/config"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// defaultMaxBodyBytes - сколько тела запроса буферизуется для повтора, если max_body_bytes не задан
+const defaultMaxBodyBytes = 64 << 10
+
+// RetryPolicy - когда и сколько раз повторять запрос на другом сервере пула
+type RetryPolicy struct {
+	maxAttempts        int
+	statuses           map[int]struct{}
+	errorClasses       map[string]struct{}
+	retryNonIdempotent bool
+	maxBodyBytes       int64
+}
+
+// NewRetryPolicy - конструктор RetryPolicy, проверяет настройки retry из конфига
+func NewRetryPolicy(conf config.Retry) (*RetryPolicy, error) {
+	p := &RetryPolicy{
+		maxAttempts:        conf.MaxAttempts,
+		statuses:           make(map[int]struct{}),
+		errorClasses:       make(map[string]struct{}),
+		retryNonIdempotent: conf.RetryNonIdempotent,
+		maxBodyBytes:       conf.MaxBodyBytes,
+	}
+	if p.maxAttempts < 1 {
+		p.maxAttempts = 1
+	}
+	if p.maxBodyBytes <= 0 {
+		p.maxBodyBytes = defaultMaxBodyBytes
+	}
+
+	for _, code := range conf.RetryOnStatus {
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("retry: invalid status code %d", code)
+		}
+		p.statuses[code] = struct{}{}
+	}
+
+	errorClasses := conf.RetryOnErrors
+	if errorClasses == nil {
+		errorClasses = []string{"connect", "reset"}
+	}
+	for _, class := range errorClasses {
+		switch class {
+		case "connect", "reset", "timeout":
+			p.errorClasses[class] = struct{}{}
+		default:
+			return nil, fmt.Errorf("retry: unknown error class %q, expected connect|reset|timeout", class)
+		}
+	}
+	return p, nil
+}
+
+// attemptsFor - сколько попыток разрешено для запроса
+func (p *RetryPolicy) attemptsFor(r *http.Request) int {
+	if p == nil {
+		return 1
+	}
+	if !p.retryNonIdempotent && !isIdempotent(r.Method) {
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// retryStatus - стоит ли повторять запрос после такого кода ответа
+func (p *RetryPolicy) retryStatus(status int) bool {
+	_, ok := p.statuses[status]
+	return ok
+}
+
+// retryError - стоит ли повторять запрос после такой ошибки транспорта
+func (p *RetryPolicy) retryError(err error) bool {
+	// клиент сам ушёл - повторять некому
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	class := classifyError(err)
+	_, ok := p.errorClasses[class]
+	return ok
+}
+
+// classifyError - относит ошибку транспорта к одному из классов retry_on_errors
+func classifyError(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "reset"
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return ""
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// bufferBody - читает тело запроса в память, чтобы отправить его повторно на другой сервер.
+// Если тело больше лимита, возвращает false, а r.Body остаётся пригодным для одной попытки
+func bufferBody(r *http.Request, limit int64) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(buf)) > limit {
+		// склеиваем прочитанное с остатком, чтобы не потерять тело
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false, nil
+	}
+	r.Body.Close()
+	return buf, true, nil
+}
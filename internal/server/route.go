@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// defaultRoute - имя маршрута на основной пул backends
+const defaultRoute = "default"
+
+// route - маршрут из таблицы routes: условия на запрос, пул серверов с методом балансировки
+// и преобразование пути перед проксированием
+type route struct {
+	name string
+
+	host       string // в нижнем регистре, *.example.com - любой поддомен
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]struct{}
+	headers    map[string]string
+
+	pool        *backend.Pool
+	strategy    balancer.Strategy
+	lbMethod    string      // из чего построена strategy: если при перезагрузке они не изменились,
+	hash        config.Hash // маршрут продолжает со старой стратегией и её состоянием
+	stripPrefix bool
+	rewrite     *string // nil - путь не переписывается
+	rateLimited bool    // у маршрута свой rate_limit
+}
+
+// newRoutes - проверяет таблицу маршрутов и строит её. upstreams - пулы из конфига по имени,
+// для маршрутов без upstream используется основной пул pool
+func newRoutes(conf *config.Config, pool *backend.Pool, upstreams map[string]*backend.Pool) ([]*route, error) {
+	upstreamConf := make(map[string]config.Upstream, len(conf.Upstreams))
+	for _, up := range conf.Upstreams {
+		upstreamConf[up.Name] = up
+	}
+
+	routes := make([]*route, 0, len(conf.Routes))
+	names := make(map[string]struct{}, len(conf.Routes))
+	for i, rc := range conf.Routes {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("routes[%d]: name is required", i)
+		}
+		if _, dup := names[rc.Name]; dup || rc.Name == defaultRoute {
+			return nil, fmt.Errorf("route %s: duplicate name", rc.Name)
+		}
+		names[rc.Name] = struct{}{}
+
+		rt, err := newRoute(conf, rc, pool, upstreams, upstreamConf)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rc.Name, err)
+		}
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+func newRoute(conf *config.Config, rc config.Route, pool *backend.Pool, upstreams map[string]*backend.Pool,
+	upstreamConf map[string]config.Upstream) (*route, error) {
+	rt := &route{
+		name:        rc.Name,
+		host:        strings.ToLower(rc.Host),
+		pathPrefix:  rc.PathPrefix,
+		headers:     rc.Headers,
+		stripPrefix: rc.StripPrefix,
+		rateLimited: rc.RateLimit != nil,
+	}
+
+	if rc.PathRegex != "" {
+		re, err := regexp.Compile(rc.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex: %w", err)
+		}
+		rt.pathRegex = re
+	}
+	if len(rc.Methods) > 0 {
+		rt.methods = make(map[string]struct{}, len(rc.Methods))
+		for _, method := range rc.Methods {
+			rt.methods[strings.ToUpper(method)] = struct{}{}
+		}
+	}
+
+	if rc.StripPrefix && rc.PathPrefix == "" {
+		return nil, fmt.Errorf("strip_prefix requires path_prefix")
+	}
+	if rc.Rewrite != "" {
+		if rc.PathPrefix == "" && rc.PathRegex == "" {
+			return nil, fmt.Errorf("rewrite requires path_prefix or path_regex")
+		}
+		if rc.PathPrefix != "" && rc.PathRegex != "" {
+			return nil, fmt.Errorf("rewrite is ambiguous with both path_prefix and path_regex")
+		}
+		rewrite := rc.Rewrite
+		rt.rewrite = &rewrite
+	}
+	if rc.RateLimit != nil && (rc.RateLimit.RequestsPerSec <= 0 || rc.RateLimit.Burst <= 0) {
+		return nil, fmt.Errorf("rate_limit: requests_per_sec and burst must be positive")
+	}
+
+	// пул и метод балансировки: метод маршрута, иначе метод пула, иначе общий lb_method
+	lbMethod, hash := conf.LBMethod, conf.Hash
+	rt.pool = pool
+	if rc.Upstream != "" {
+		up, ok := upstreamConf[rc.Upstream]
+		if !ok || upstreams[rc.Upstream] == nil {
+			return nil, fmt.Errorf("unknown upstream %q", rc.Upstream)
+		}
+		rt.pool = upstreams[rc.Upstream]
+		if up.LBMethod != "" {
+			lbMethod = up.LBMethod
+		}
+		if up.Hash != nil {
+			hash = *up.Hash
+		}
+	}
+	if rc.LBMethod != "" {
+		lbMethod = rc.LBMethod
+	}
+	strategy, err := balancer.New(lbMethod, balancer.Options{Hash: hash})
+	if err != nil {
+		return nil, err
+	}
+	rt.strategy, rt.lbMethod, rt.hash = strategy, lbMethod, hash
+	return rt, nil
+}
+
+// matches - совпадают ли все заданные условия маршрута с запросом
+func (rt *route) matches(r *http.Request) bool {
+	if rt.host != "" && !matchHost(rt.host, r.Host) {
+		return false
+	}
+	if rt.pathPrefix != "" && !hasPathPrefix(r.URL.Path, rt.pathPrefix) {
+		return false
+	}
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if rt.methods != nil {
+		if _, ok := rt.methods[r.Method]; !ok {
+			return false
+		}
+	}
+	for name, value := range rt.headers {
+		got, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok || (value != "" && got[0] != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPathPrefix - начинается ли путь с prefix по границе сегмента: /api подходит для /api и /api/users,
+// но не для /apiary. Префикс со слешем на конце (/api/) сравнивается как есть
+func hasPathPrefix(path, prefix string) bool {
+	rest, ok := strings.CutPrefix(path, prefix)
+	return ok && (rest == "" || rest[0] == '/' || strings.HasSuffix(prefix, "/"))
+}
+
+// matchHost - Host без порта против точного имени или шаблона *.example.com
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// rewritePath - запрос с путём после strip_prefix/rewrite, исходный запрос не меняется
+func (rt *route) rewritePath(r *http.Request) *http.Request {
+	if !rt.stripPrefix && rt.rewrite == nil {
+		return r
+	}
+
+	path := r.URL.Path
+	switch {
+	case rt.rewrite != nil && rt.pathRegex != nil:
+		path = rt.pathRegex.ReplaceAllString(path, *rt.rewrite)
+	case rt.rewrite != nil:
+		path = *rt.rewrite + strings.TrimPrefix(path, rt.pathPrefix)
+	default:
+		path = strings.TrimPrefix(path, rt.pathPrefix)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	u := *r.URL
+	u.Path, u.RawPath = path, ""
+	req := r.WithContext(r.Context())
+	req.URL = &u
+	return req
+}
@@ -2,11 +2,16 @@ package server
 
 import (
 	"context"
+	"loadbalancer/internal/accesslog"
+	"loadbalancer/internal/clientip"
 	"loadbalancer/internal/config"
 	"loadbalancer/internal/errors/errors_middleware"
+	"loadbalancer/internal/metrics"
 	"loadbalancer/internal/ratelimiter/bucket"
 	"loadbalancer/internal/ratelimiter/middleware"
+	"loadbalancer/internal/tracing"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,31 +20,52 @@ import (
 	"time"
 )
 
+// defaultMetricsListen - адрес сервера метрик по умолчанию: только с этой машины
+const defaultMetricsListen = "127.0.0.1:9100"
+
 // StartServer - запускает сервер с балансировщиком
 func (lb *LoadBalancer) StartServer(conf *config.Config) error {
 
 	// Инициализирую бакет менеджер для Rate Limiter
 	bm := bucket.NewBucketManager(conf)
 	defer bm.Stop()
-
-	// BalanceMethod - спец. тип чтобы можно было передать метод балансировки из конфига
-	type BalanceMethod func(w http.ResponseWriter, r *http.Request)
-	var balanceMethod BalanceMethod
-	if conf.LBMethod == "RR" {
-		balanceMethod = lb.BalanceRequestRoundRobin
-	} else if conf.LBMethod == "LC" {
-		balanceMethod = lb.BalanceRequestLeastConns
-	}
+	lb.SetBucketManager(bm)
 
 	// Создаем мультиплексор и добавляем обработчики
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", balanceMethod)
+	mux.HandleFunc("/", lb.BalanceRequest)
 	mux.HandleFunc("/health", lb.healthCheckHandler)
 
 	// заворачиваем балансировщик в ограничитель и сверху ещё обработчик ошибок
 	handler := errors_middleware.ErrorHandler(
 		middleware.RateLimitMiddleware(bm, mux))
 
+	// корневой спан запроса охватывает ограничитель, выбор сервера и запрос к бэкенду
+	if conf.Tracing.Enabled {
+		tracer, err := tracing.New(conf.Tracing)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Shutdown(ctx); err != nil {
+				log.Printf("WARN: tracing - shutdown: %v\n", err)
+			}
+		}()
+		handler = tracer.Middleware(handler)
+	}
+
+	// журнал доступа снаружи всей цепочки, чтобы видеть и отклонённые ограничителем запросы
+	if conf.AccessLog.Enabled {
+		accessLog, err := accesslog.New(conf.AccessLog)
+		if err != nil {
+			return err
+		}
+		defer accessLog.Close()
+		handler = accessLog.Middleware(handler)
+	}
+
 	// инит сервера с выбором метода loadBalancer'а
 	lb.server = &http.Server{
 		Addr: ":" + strconv.Itoa(lb.port),
@@ -52,10 +78,57 @@ func (lb *LoadBalancer) StartServer(conf *config.Config) error {
 	// настраиваем прослушивание сигналов завершения в этот канал
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM) // SIGINT|SIGTERM
 
+	// HTTPS на отдельном порту с той же цепочкой обработчиков
+	if conf.TLS.Enabled {
+		tlsServer, certs, err := newTLSServer(conf.TLS, handler)
+		if err != nil {
+			return err
+		}
+		lb.tlsServer = tlsServer
+		if conf.TLS.RedirectHTTP {
+			lb.server.Handler = RedirectToHTTPS(tlsPort(conf.TLS), handler)
+		}
+
+		// сертификаты перечитываются при изменении файлов до остановки сервера
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go certs.Watch(watchCtx, conf.TLS.ReloadInterval)
+
+		tlsListener, err := listen(tlsServer.Addr, conf.ClientIP.ProxyProtocol)
+		if err != nil {
+			return err
+		}
+		go func() {
+			log.Printf("LoadBalancer (TLS) started on %s\n", tlsServer.Addr)
+			if err := tlsServer.ServeTLS(tlsListener, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("TLS server error: %v", err)
+			}
+		}()
+	}
+
+	// метрики на своём адресе, чтобы не открывать их клиентам балансировщика
+	if conf.Metrics.Enabled {
+		lb.metricsServer = newMetricsServer(conf.Metrics)
+		metricsListener, err := net.Listen("tcp", lb.metricsServer.Addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			log.Printf("Metrics started on %s\n", lb.metricsServer.Addr)
+			if err := lb.metricsServer.Serve(metricsListener); err != nil && err != http.ErrServerClosed {
+				log.Printf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
 	// Запуск сервера в горутине
+	listener, err := listen(lb.server.Addr, conf.ClientIP.ProxyProtocol)
+	if err != nil {
+		return err
+	}
 	go func() {
 		log.Printf("LoadBalancer started on :%d\n", lb.port)
-		if err := lb.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := lb.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
@@ -69,15 +142,51 @@ func (lb *LoadBalancer) StartServer(conf *config.Config) error {
 	defer cancel()
 
 	// server stop
+	if lb.tlsServer != nil {
+		if err := lb.tlsServer.Shutdown(ctx); err != nil {
+			log.Printf("TLS server shutdown error: %v", err)
+			return err
+		}
+	}
 	if err := lb.server.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 		return err
 	}
+	if lb.metricsServer != nil {
+		if err := lb.metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("Metrics server shutdown error: %v", err)
+		}
+	}
 
 	log.Println("Server gracefully stopped.")
 	return nil
 }
 
+// newMetricsServer - сервер /metrics на metrics.listen (по умолчанию 127.0.0.1:9100)
+func newMetricsServer(conf config.Metrics) *http.Server {
+	if conf.Listen == "" {
+		conf.Listen = defaultMetricsListen
+	}
+	if conf.Path == "" {
+		conf.Path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(conf.Path, metrics.Handler())
+	return &http.Server{Addr: conf.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
+
+// listen - TCP-слушатель порта; с proxy_protocol соединения доверенных прокси могут начинаться с заголовка PROXY protocol
+func listen(addr string, proxyProtocol bool) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyProtocol {
+		ln = clientip.ProxyListener(ln)
+	}
+	return ln, nil
+}
+
 func (lb *LoadBalancer) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/tlsutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultTLSPort - порт HTTPS, если tls.port не задан
+const defaultTLSPort = 8443
+
+// newTLSServer - HTTPS-сервер с той же цепочкой обработчиков, что и на основном порту
+func newTLSServer(conf config.TLS, handler http.Handler) (*http.Server, *tlsutil.CertStore, error) {
+	store, err := tlsutil.NewCertStore(conf.Certificates)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig, err := tlsutil.ServerConfig(conf, store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// HTTP/2 согласуется через ALPN, только если включён в настройках
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(conf.HTTP2)
+
+	srv := &http.Server{
+		Addr:      ":" + strconv.Itoa(tlsPort(conf)),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+		Protocols: protocols,
+	}
+	return srv, store, nil
+}
+
+func tlsPort(conf config.TLS) int {
+	if conf.Port == 0 {
+		return defaultTLSPort
+	}
+	return conf.Port
+}
+
+// acmeChallengePrefix - путь проверки ACME HTTP-01: удостоверяющий центр ходит за ним только по http
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// RedirectToHTTPS - отвечает на запросы по http постоянным редиректом на тот же адрес по https.
+// /health и пути проверки ACME остаются на http и передаются в next: проверки здоровья и выпуск
+// сертификата не должны зависеть от работающего HTTPS
+func RedirectToHTTPS(port int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6-адрес без порта
+		}
+		// 308, а не 301: клиент повторит тот же метод с тем же телом
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,144 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"loadbalancer/internal/config"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CertStore - набор сертификатов балансировщика, сертификат выбирается по SNI клиента.
+// Файлы перечитываются при изменении (Watch), без перезапуска сервера
+type CertStore struct {
+	files []config.Certificate
+	certs atomic.Pointer[certSet]
+}
+
+// certSet - загруженные сертификаты и индекс по именам из SAN/CN
+type certSet struct {
+	byName  map[string]*tls.Certificate // точные имена и шаблоны вида *.example.com
+	first   *tls.Certificate            // для клиентов без SNI или с незнакомым именем
+	modTime map[string]time.Time        // время изменения файлов на момент загрузки
+}
+
+// NewCertStore - загружает все пары сертификат/ключ, ошибка в любой из них - ошибка конфигурации
+func NewCertStore(files []config.Certificate) (*CertStore, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("tls: at least one certificate is required")
+	}
+	s := &CertStore{files: files}
+	set, err := loadCertSet(files)
+	if err != nil {
+		return nil, err
+	}
+	s.certs.Store(set)
+	return s, nil
+}
+
+func loadCertSet(files []config.Certificate) (*certSet, error) {
+	set := &certSet{
+		byName:  make(map[string]*tls.Certificate),
+		modTime: make(map[string]time.Time),
+	}
+	for _, f := range files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load %s: %w", f.CertFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("tls: parse %s: %w", f.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, dup := set.byName[name]; !dup { // при совпадении имён побеждает сертификат, указанный раньше
+				set.byName[name] = &cert
+			}
+		}
+		if set.first == nil {
+			set.first = &cert
+		}
+		for _, path := range []string{f.CertFile, f.KeyFile} {
+			if info, err := os.Stat(path); err == nil {
+				set.modTime[path] = info.ModTime()
+			}
+		}
+	}
+	return set, nil
+}
+
+// GetCertificate - выбор сертификата по SNI для tls.Config: точное имя, затем шаблон *.домен,
+// иначе первый сертификат из списка
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.certs.Load()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := set.byName[name]; ok {
+			return cert, nil
+		}
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if cert, ok := set.byName["*."+parent]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return set.first, nil
+}
+
+// Watch - периодично проверяет файлы сертификатов и перезагружает их при изменении.
+// Если новые файлы не загружаются (например, записан только сертификат без ключа), остаются старые
+func (s *CertStore) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if !s.changed() {
+			continue
+		}
+		set, err := loadCertSet(s.files)
+		if err != nil {
+			log.Printf("WARN: tls - certificate reload failed, keeping the current ones: %v\n", err)
+			continue
+		}
+		s.certs.Store(set)
+		log.Println("INFO: tls - certificates reloaded")
+	}
+}
+
+// changed - изменился ли какой-нибудь файл с момента последней загрузки
+func (s *CertStore) changed() bool {
+	loaded := s.certs.Load().modTime
+	for _, f := range s.files {
+		for _, path := range []string{f.CertFile, f.KeyFile} {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // файл могли заменить атомарным переименованием, дождёмся следующей проверки
+			}
+			if !info.ModTime().Equal(loaded[path]) {
+				return true
+			}
+		}
+	}
+	return false
+}
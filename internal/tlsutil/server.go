@@ -0,0 +1,71 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"loadbalancer/internal/config"
+)
+
+// ServerConfig - tls.Config для входящих соединений: сертификаты по SNI из store,
+// минимальная версия и разрешённые наборы шифров из настроек tls
+func ServerConfig(conf config.TLS, store *CertStore) (*tls.Config, error) {
+	minVersion, err := ParseVersion(conf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := ParseCipherSuites(conf.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+	}, nil
+}
+
+// ParseVersion - "1.0" | "1.1" | "1.2" | "1.3", по умолчанию 1.2
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tls: unknown min_version %q, expected 1.0|1.1|1.2|1.3", version)
+	}
+}
+
+// ParseCipherSuites - имена наборов шифров в формате Go (например TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).
+// Пустой список - наборы Go по умолчанию. Для TLS 1.3 список не применяется, там набор фиксирован.
+// Наборы из tls.InsecureCipherSuites (RC4, 3DES, CBC_SHA256) не принимаются
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		if insecure[name] {
+			return nil, fmt.Errorf("tls: cipher suite %q is insecure", name)
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
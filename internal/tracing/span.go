@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"time"
+)
+
+// Виды спанов в OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Span - одна операция в трассировке. Все методы безопасно вызывать на nil (трассировка выключена)
+type Span struct {
+	tracer   *Tracer
+	context  SpanContext
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []attribute
+	err      error
+}
+
+type attribute struct {
+	key   string
+	value any // string | int | bool
+}
+
+type spanKey struct{}
+
+// SpanFrom - текущий спан запроса, nil - трассировка выключена
+func SpanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start - начинает дочерний спан текущего спана из ctx. Если в ctx нет спана, возвращает nil
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := SpanFrom(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:   parent.tracer,
+		context:  SpanContext{TraceID: parent.context.TraceID, SpanID: newSpanID(), Sampled: parent.context.Sampled},
+		parentID: parent.context.SpanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttr - добавляет атрибут спана (string, int или bool)
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError - помечает спан ошибкой
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err
+}
+
+// End - завершает спан и отправляет его на экспорт (если трассировка сэмплирована)
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	if s.context.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"loadbalancer/internal/config"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Значения по умолчанию для tracing
+const (
+	defaultServiceName   = "loadbalancer"
+	defaultBatchSize     = 512
+	defaultQueueSize     = 4096
+	defaultFlushInterval = 5 * time.Second
+	exportTimeout        = 10 * time.Second
+)
+
+// Tracer - создаёт корневые спаны запросов и в фоне пачками отправляет завершённые спаны
+// в коллектор по OTLP/HTTP (JSON). Отправка никогда не блокирует запросы: если очередь
+// заполнена (коллектор недоступен или не успевает), спаны отбрасываются
+type Tracer struct {
+	endpoint      string
+	serviceName   string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	queue   chan *Span
+	done    chan struct{}
+	stopped sync.WaitGroup
+	dropped atomic.Uint64 // спанов отброшено из-за переполненной очереди
+}
+
+// New - создаёт трассировщик по настройкам tracing и запускает фоновую отправку
+func New(conf config.Tracing) (*Tracer, error) {
+	if conf.CollectorURL == "" {
+		return nil, fmt.Errorf("tracing: collector_url is required")
+	}
+	t := &Tracer{
+		endpoint:      conf.CollectorURL,
+		serviceName:   conf.ServiceName,
+		batchSize:     conf.BatchSize,
+		flushInterval: conf.FlushInterval,
+		client:        &http.Client{Timeout: exportTimeout},
+		done:          make(chan struct{}),
+	}
+	if t.serviceName == "" {
+		t.serviceName = defaultServiceName
+	}
+	if t.batchSize <= 0 {
+		t.batchSize = defaultBatchSize
+	}
+	if t.flushInterval <= 0 {
+		t.flushInterval = defaultFlushInterval
+	}
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	t.queue = make(chan *Span, queueSize)
+
+	t.stopped.Add(1)
+	go t.exportLoop()
+	return t, nil
+}
+
+// Middleware - начинает корневой спан запроса, продолжая трассировку из входящего traceparent
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := &Span{tracer: t, name: "lb.request", kind: KindServer, start: time.Now()}
+		if remote, ok := parseTraceparent(r.Header.Get("Traceparent")); ok {
+			span.context = SpanContext{TraceID: remote.TraceID, SpanID: newSpanID(), Sampled: remote.Sampled}
+			span.parentID = remote.SpanID
+		} else {
+			// начинаем новую трассировку, чужой tracestate к ней не относится
+			span.context = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+			r.Header.Del("Tracestate")
+		}
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), spanKey{}, span)))
+
+		span.SetAttr("http.response.status_code", rw.status)
+		if rw.status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("status %d", rw.status))
+		}
+		span.End()
+	})
+}
+
+// enqueue - ставит спан в очередь на отправку, не блокируясь
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Shutdown - отправляет оставшиеся спаны и останавливает фоновую отправку
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	close(t.done)
+	finished := make(chan struct{})
+	go func() {
+		t.stopped.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) exportLoop() {
+	defer t.stopped.Done()
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			log.Printf("WARN: tracing - failed to export %d spans (dropped before: %d): %v\n", len(batch), t.dropped.Load(), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export - POST пачки спанов в коллектор в формате OTLP/HTTP JSON
+func (t *Tracer) export(batch []*Span) error {
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = toOTLP(s)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{stringAttr("service.name", t.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "loadbalancer"},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// statusWriter - запоминает код ответа для атрибута корневого спана
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// formatNanos - время в наносекундах строкой, как требует OTLP JSON для uint64
+func formatNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,136 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+)
+
+// newPool - пул из n серверов с весом 1
+func newPool(n int) *backend.Pool {
+	backends := make([]config.Backend, n)
+	for i := range backends {
+		backends[i] = config.Backend{URL: "http://10.0.0." + strconv.Itoa(i+1) + ":8000", Weight: 1}
+	}
+	return backend.NewPool(backends)
+}
+
+// assign - сервер пула для каждого из keys ключей (заголовок X-User) при данных кандидатах
+func assign(t *testing.T, strategy balancer.Strategy, pool *backend.Pool, candidates []*backend.Backend, keys int) []*backend.Backend {
+	t.Helper()
+	chosen := make([]*backend.Backend, keys)
+	for i := range chosen {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User", "user-"+strconv.Itoa(i))
+		b, err := balancer.Select(strategy, req, pool, candidates)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		chosen[i] = b
+	}
+	return chosen
+}
+
+func TestConsistentHashMovesOnlyKeysOfDeadBackend(t *testing.T) {
+	const keys = 10000
+	strategy, err := balancer.New("CH", balancer.Options{Hash: config.Hash{Key: "header:X-User"}})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	pool := newPool(5)
+	all := pool.AliveBackends()
+	before := assign(t, strategy, pool, all, keys)
+
+	// тот же набор кандидатов - те же сервера
+	if again := assign(t, strategy, pool, all, keys); !sameAssignment(before, again) {
+		t.Fatal("Expected the same key to map to the same backend")
+	}
+
+	// сервер умирает и выпадает из кандидатов
+	dead := all[2]
+	dead.SetAlive(false)
+	after := assign(t, strategy, pool, pool.AliveBackends(), keys)
+
+	moved, owned := 0, 0
+	for i := range before {
+		if before[i] == dead {
+			owned++
+			if after[i] == dead {
+				t.Fatalf("Key %d still maps to the dead backend", i)
+			}
+			continue
+		}
+		if after[i] != before[i] {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Errorf("Expected only keys of the dead backend to move, %d other keys moved", moved)
+	}
+	// виртуальные узлы дают каждому серверу примерно пятую часть ключей
+	if owned < keys/10 || owned > keys*3/10 {
+		t.Errorf("Expected the dead backend to own about 1/5 of %d keys, got %d", keys, owned)
+	}
+
+	// сервер вернулся - ключи возвращаются к нему, остальные на месте
+	dead.SetAlive(true)
+	if back := assign(t, strategy, pool, pool.AliveBackends(), keys); !sameAssignment(before, back) {
+		t.Error("Expected keys to return to the backend after it comes back")
+	}
+}
+
+func TestConsistentHashRetryKeepsMapping(t *testing.T) {
+	const keys = 10000
+	strategy, err := balancer.New("CH", balancer.Options{Hash: config.Hash{Key: "header:X-User"}})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	pool := newPool(5)
+	all := pool.AliveBackends()
+	before := assign(t, strategy, pool, all, keys)
+
+	// повтор без уже опробованного сервера: его ключи уходят на следующий сервер по кольцу,
+	// как если бы он умер, остальные ключи остаются на своих серверах
+	tried := all[1]
+	retry := assign(t, strategy, pool, without(all, tried), keys)
+	tried.SetAlive(false)
+	dead := assign(t, strategy, pool, pool.AliveBackends(), keys)
+	tried.SetAlive(true)
+	for i := range before {
+		if before[i] != tried && retry[i] != before[i] {
+			t.Fatalf("Key %d moved from %s to %s on retry", i, before[i].URL, retry[i].URL)
+		}
+		if retry[i] == tried || retry[i] != dead[i] {
+			t.Fatalf("Key %d: expected retry to pick the next backend on the ring %s, got %s", i, dead[i].URL, retry[i].URL)
+		}
+	}
+
+	// повторы не сбивают выбор для всего пула
+	if again := assign(t, strategy, pool, all, keys); !sameAssignment(before, again) {
+		t.Error("Expected retries not to change the mapping of the whole pool")
+	}
+}
+
+// without - кандидаты без сервера b
+func without(candidates []*backend.Backend, b *backend.Backend) []*backend.Backend {
+	rest := make([]*backend.Backend, 0, len(candidates))
+	for _, c := range candidates {
+		if c != b {
+			rest = append(rest, c)
+		}
+	}
+	return rest
+}
+
+func sameAssignment(a, b []*backend.Backend) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
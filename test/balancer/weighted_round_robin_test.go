@@ -0,0 +1,152 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+)
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	strategy, err := balancer.New("WRR", balancer.Options{})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	pool := backend.NewPool([]config.Backend{
+		{URL: "http://a:8000", Weight: 5},
+		{URL: "http://b:8000", Weight: 1},
+		{URL: "http://c:8000", Weight: 1},
+	})
+	candidates := pool.AliveBackends()
+	pick := func() string {
+		b, err := strategy.Select(httptest.NewRequest("GET", "/", nil), candidates)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		return b.URL.Host[:1]
+	}
+
+	// плавный WRR перемешивает тяжёлый сервер с лёгкими, а не отдаёт ему 5 запросов подряд
+	var round []string
+	for i := 0; i < 7; i++ {
+		round = append(round, pick())
+	}
+	if got := strings.Join(round, " "); got != "a a b a c a a" {
+		t.Errorf("Expected smooth order a a b a c a a, got %s", got)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 700; i++ {
+		counts[pick()]++
+	}
+	if counts["a"] != 500 || counts["b"] != 100 || counts["c"] != 100 {
+		t.Errorf("Expected requests split 5:1:1 (500/100/100), got %v", counts)
+	}
+
+	// сервер выпал из кандидатов - его доля делится между оставшимися по весам
+	candidates = candidates[:2]
+	counts = make(map[string]int)
+	for i := 0; i < 600; i++ {
+		counts[pick()]++
+	}
+	if counts["a"] != 500 || counts["b"] != 100 || counts["c"] != 0 {
+		t.Errorf("Expected requests split 5:1 without c (500/100/0), got %v", counts)
+	}
+}
+
+func TestWeightedRoundRobinRetryKeepsState(t *testing.T) {
+	strategy, err := balancer.New("WRR", balancer.Options{})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	pool := backend.NewPool([]config.Backend{
+		{URL: "http://a:8000", Weight: 5},
+		{URL: "http://b:8000", Weight: 1},
+		{URL: "http://c:8000", Weight: 1},
+	})
+	all := pool.AliveBackends()
+	pick := func(candidates []*backend.Backend) *backend.Backend {
+		b, err := balancer.Select(strategy, httptest.NewRequest("GET", "/", nil), pool, candidates)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		return b
+	}
+
+	// каждый запрос на a падает и повторяется на другом сервере: a на время повтора выпадает из кандидатов,
+	// но сохраняет набранный вес, поэтому первые попытки по-прежнему идут плавно и делятся 5:1:1
+	counts := make(map[string]int)
+	streak, longest := 0, 0
+	for i := 0; i < 700; i++ {
+		first := pick(all)
+		counts[first.URL.Host[:1]]++
+		if first != all[0] {
+			streak = 0
+			continue
+		}
+		streak++
+		longest = max(longest, streak)
+		pick(without(all, first))
+	}
+	if counts["a"] != 500 || counts["b"] != 100 || counts["c"] != 100 {
+		t.Errorf("Expected first attempts split 5:1:1 (500/100/100), got %v", counts)
+	}
+	if longest > 3 {
+		t.Errorf("Expected retries not to reset the smooth order, a was picked %d times in a row", longest)
+	}
+}
+
+func TestBackendsLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `lb_method: WRR
+backends:
+  - http://127.0.0.1:8001
+  - url: http://127.0.0.1:8002
+    weight: 3
+  - url: http://127.0.0.1:8003
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	// строка - старый формат, вес по умолчанию 1, как и у структуры без weight
+	want := []config.Backend{
+		{URL: "http://127.0.0.1:8001", Weight: 1},
+		{URL: "http://127.0.0.1:8002", Weight: 3},
+		{URL: "http://127.0.0.1:8003", Weight: 1},
+	}
+	if len(cfg.Backends) != len(want) {
+		t.Fatalf("Expected %d backends, got %d", len(want), len(cfg.Backends))
+	}
+	for i, b := range want {
+		if cfg.Backends[i].URL != b.URL || cfg.Backends[i].Weight != b.Weight {
+			t.Errorf("Backend %d: expected %s weight %d, got %s weight %d",
+				i, b.URL, b.Weight, cfg.Backends[i].URL, cfg.Backends[i].Weight)
+		}
+	}
+
+	// config.yaml из репозитория использует старый формат
+	cfg, err = config.LoadConfig("../../config.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config.yaml: %v", err)
+	}
+	if len(cfg.Backends) == 0 || cfg.Backends[0].Weight != 1 {
+		t.Errorf("Expected string backends of config.yaml to load with weight 1, got %+v", cfg.Backends)
+	}
+
+	if err := os.WriteFile(path, []byte("backends:\n  - url: http://127.0.0.1:8001\n    weight: -1\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := config.LoadConfig(path); err == nil {
+		t.Error("Expected negative weight to be rejected")
+	}
+}
@@ -0,0 +1,86 @@
+package benchmark
+
+import (
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/iptrie"
+	"loadbalancer/internal/ratelimiter/bucket"
+)
+
+// benchIPs - n разных IPv4 адресов из 10.0.0.0/8
+func benchIPs(n int) []string {
+	ips := make([]string, n)
+	for i := range ips {
+		ips[i] = "10." + strconv.Itoa(i>>16&0xff) + "." + strconv.Itoa(i>>8&0xff) + "." + strconv.Itoa(i&0xff)
+	}
+	return ips
+}
+
+// BenchmarkSpecialLimitLookup - поиск индивидуального лимита: точная карта строк (как было до CIDR)
+// против префиксного дерева, с разбором адреса и без, на списках разного размера
+func BenchmarkSpecialLimitLookup(b *testing.B) {
+	for _, size := range []int{10, 1000, 10000} {
+		ips := benchIPs(size)
+		exact := make(map[string]int, size)
+		trie := iptrie.New[int]()
+		addrs := make([]netip.Addr, size)
+		for i, ip := range ips {
+			exact[ip] = i
+			addrs[i] = netip.MustParseAddr(ip)
+			trie.Insert(netip.PrefixFrom(addrs[i], 32), i)
+		}
+		suffix := "/entries=" + strconv.Itoa(size)
+
+		b.Run("map"+suffix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = exact[ips[i%size]]
+			}
+		})
+		b.Run("trie"+suffix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				trie.Lookup(addrs[i%size])
+			}
+		})
+		b.Run("trie+parse"+suffix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				addr, _ := netip.ParseAddr(ips[i%size])
+				trie.Lookup(addr)
+			}
+		})
+	}
+}
+
+// BenchmarkBucketManagerAllow - полный путь ограничителя с тысячами подсетей в special_limits, allowlist и denylist
+func BenchmarkBucketManagerAllow(b *testing.B) {
+	ips := benchIPs(10000)
+	cidrs := make([]string, 0, len(ips)/256)
+	for i := 0; i < len(ips); i += 256 {
+		cidrs = append(cidrs, ips[i]+"/24")
+	}
+	cfg := &config.Config{
+		RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 60,
+			Default:         config.Limit{RequestsPerSec: 1 << 20, Burst: 1 << 20},
+			SpecialLimits: []config.Tier{
+				{IPs: ips[:5000], Limit: config.Limit{RequestsPerSec: 1 << 20, Burst: 1 << 20}},
+				{IPs: cidrs, Limit: config.Limit{RequestsPerSec: 1 << 20, Burst: 1 << 20}},
+			},
+			Allowlist: ips[5000:7000],
+			Denylist:  ips[7000:9000],
+		},
+	}
+	bm := bucket.NewBucketManager(cfg)
+	defer bm.Stop()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ip := ips[i%len(ips)]
+		if !bm.Denied(ip) {
+			bm.Allow(bucket.Client{IP: ip})
+		}
+	}
+}
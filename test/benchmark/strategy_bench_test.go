@@ -0,0 +1,117 @@
+package benchmark
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+)
+
+// newBenchPool - пул из n серверов с разной нагрузкой и временем ответа
+func newBenchPool(n int) *backend.Pool {
+	backends := make([]config.Backend, n)
+	for i := range backends {
+		backends[i] = config.Backend{URL: "http://10.0.0." + strconv.Itoa(i) + ":8000", Weight: 1 + i%4}
+	}
+	pool := backend.NewPool(backends)
+	for i, b := range pool.AliveBackends() {
+		for c := 0; c < i%7; c++ {
+			b.IncrementConn()
+		}
+		b.ObserveLatency(time.Duration(1+i%5) * time.Millisecond)
+	}
+	return pool
+}
+
+// BenchmarkStrategies - сравнение стоимости выбора сервера у всех lb-методов на пулах разного размера
+func BenchmarkStrategies(b *testing.B) {
+	for _, size := range []int{3, 100, 1000} {
+		pool := newBenchPool(size)
+		candidates := pool.AliveBackends()
+		req := httptest.NewRequest("GET", "/", nil)
+
+		for _, name := range balancer.Names() {
+			strategy, err := balancer.New(name, balancer.Options{})
+			if err != nil {
+				b.Fatalf("Failed to create strategy %s: %v", name, err)
+			}
+			b.Run(name+"/backends="+strconv.Itoa(size), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, err := strategy.Select(req, candidates); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			})
+		}
+
+		// исходный проход по пулу под блокировкой, который заменяет P2C
+		b.Run("Pool.GetLeastBusyBackend/backends="+strconv.Itoa(size), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if pool.GetLeastBusyBackend() == nil {
+						b.Fatal("no backend")
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStrategiesWithCandidates - выбор сервера вместе со снимком живых серверов, как на каждом запросе:
+// проход AliveBackends по пулу стоит O(n) для любого lb-метода, включая P2C
+func BenchmarkStrategiesWithCandidates(b *testing.B) {
+	for _, size := range []int{3, 100, 1000} {
+		pool := newBenchPool(size)
+		req := httptest.NewRequest("GET", "/", nil)
+
+		for _, name := range []string{"RR", "LC", "P2C"} {
+			strategy, err := balancer.New(name, balancer.Options{})
+			if err != nil {
+				b.Fatalf("Failed to create strategy %s: %v", name, err)
+			}
+			b.Run(name+"/backends="+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, err := strategy.Select(req, pool.AliveBackends()); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkConsistentHashRetry - выбор CH при повторах: кандидаты каждый раз без другого опробованного сервера,
+// а кольцо строится один раз по всем серверам пула
+func BenchmarkConsistentHashRetry(b *testing.B) {
+	for _, size := range []int{3, 100} {
+		pool := newBenchPool(size)
+		all := pool.AliveBackends()
+		subsets := make([][]*backend.Backend, len(all))
+		for i := range all {
+			subsets[i] = append(append([]*backend.Backend(nil), all[:i]...), all[i+1:]...)
+		}
+		strategy, err := balancer.New("CH", balancer.Options{})
+		if err != nil {
+			b.Fatalf("Failed to create strategy CH: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+
+		b.Run("CH/backends="+strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := balancer.Select(strategy, req, pool, subsets[i%len(subsets)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+)
+
+// runHealthCheck - запускает периодичные проверки пула и останавливает их в конце теста
+func runHealthCheck(t *testing.T, pool *backend.Pool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.HealthCheck(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitUntil - ждёт выполнения условия не дольше timeout
+func waitUntil(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func TestHealthCheckThresholds(t *testing.T) {
+	// ответы проверок по порядку: неудача прерывает серию успехов и наоборот
+	results := []bool{false, false, true, false, false, false, true, true, true}
+	// aliveBefore[i] - состояние сервера к моменту проверки i, то есть после обработки проверки i-1
+	aliveBefore := make([]bool, len(results)+1)
+
+	var b atomic.Pointer[backend.Backend]
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(hits.Add(1)) - 1
+		if i < len(aliveBefore) {
+			aliveBefore[i] = b.Load().IsAlive()
+		}
+		if i < len(results) && !results[i] {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: srv.URL}})
+	if err := pool.ConfigureHealthCheck(config.HealthCheck{
+		Interval:           10 * time.Millisecond,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	}); err != nil {
+		t.Fatalf("Failed to configure health check: %v", err)
+	}
+	b.Store(pool.Backends()[0])
+	runHealthCheck(t, pool)
+
+	// проверки сервера идут по очереди: к (n+2)-й проверке запись (n+1)-й уже завершена
+	if !waitUntil(2*time.Second, func() bool { return hits.Load() > int32(len(results)+1) }) {
+		t.Fatalf("Expected %d probes, got %d", len(results)+2, hits.Load())
+	}
+	// F F S F F F S S S: сервер падает после третьей неудачи подряд (6-я проверка)
+	// и возвращается после второго успеха подряд (8-я проверка)
+	want := []bool{true, true, true, true, true, true, false, false, true, true}
+	for i := 1; i < len(want); i++ {
+		if aliveBefore[i] != want[i] {
+			t.Errorf("After probe %d: expected alive=%v, got %v", i, want[i], aliveBefore[i])
+		}
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	hc := config.HealthCheck{Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if err := probe(t, srv.URL, hc); err == nil {
+		t.Fatal("Expected probe of a hanging server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected probe to give up after the 50ms timeout, took %v", elapsed)
+	}
+
+	hc.Type = "tcp"
+	hc.Timeout = 50 * time.Millisecond
+	// tcp-проверка только устанавливает соединение, сервер успевает
+	if err := probe(t, srv.URL, hc); err != nil {
+		t.Errorf("Expected tcp probe to succeed, got %v", err)
+	}
+}
+
+func TestHealthCheckManyBackendsConcurrently(t *testing.T) {
+	// каждая проверка длится 100ms: последовательно 50 серверов проверялись бы 5 секунд
+	const n = 50
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	backends := make([]config.Backend, n)
+	for i := range backends {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		backends[i] = config.Backend{URL: srv.URL}
+	}
+
+	pool := backend.NewPool(backends)
+	if err := pool.ConfigureHealthCheck(config.HealthCheck{Interval: 200 * time.Millisecond, Timeout: time.Second}); err != nil {
+		t.Fatalf("Failed to configure health check: %v", err)
+	}
+	start := time.Now()
+	runHealthCheck(t, pool)
+
+	if !waitUntil(3*time.Second, func() bool { return len(pool.AliveBackends()) == 0 }) {
+		t.Fatalf("Expected all backends to be marked down, %d still alive", len(pool.AliveBackends()))
+	}
+	// первая проверка в пределах interval от старта плюс время ответа
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected backends to be probed concurrently, marking all down took %v", elapsed)
+	}
+}
+
+func TestHealthCheckNewBackend(t *testing.T) {
+	var hits sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Store(r.Host, true)
+	}))
+	defer srv.Close()
+
+	pool := backend.NewPool(nil)
+	if err := pool.ConfigureHealthCheck(config.HealthCheck{Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Failed to configure health check: %v", err)
+	}
+	runHealthCheck(t, pool)
+
+	// сервер из административного API проверяется без перезапуска проверок
+	if _, err := pool.AddBackend(config.Backend{URL: srv.URL}); err != nil {
+		t.Fatalf("AddBackend failed: %v", err)
+	}
+	if !waitUntil(time.Second, func() bool { _, ok := hits.Load(srv.Listener.Addr().String()); return ok }) {
+		t.Error("Expected backend added at runtime to be probed")
+	}
+}
@@ -0,0 +1,132 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+)
+
+// probe - одна проверка бэкенда с заданными настройками health_check
+func probe(t *testing.T, url string, hc config.HealthCheck) error {
+	t.Helper()
+	pool := backend.NewPool([]config.Backend{{URL: url}})
+	if err := pool.ConfigureHealthCheck(hc); err != nil {
+		t.Fatalf("Failed to configure health check: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return pool.Backends()[0].Probe(ctx)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := probe(t, srv.URL, config.HealthCheck{Path: "/ready", ExpectedStatuses: []string{"200-299"}}); err != nil {
+		t.Errorf("Expected healthy backend, got %v", err)
+	}
+	if err := probe(t, srv.URL, config.HealthCheck{}); err == nil {
+		t.Error("Expected /health to fail with 404")
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	url := "http://" + ln.Addr().String()
+
+	if err := probe(t, url, config.HealthCheck{Type: "tcp"}); err != nil {
+		t.Errorf("Expected healthy backend, got %v", err)
+	}
+
+	ln.Close()
+	if err := probe(t, url, config.HealthCheck{Type: "tcp"}); err == nil {
+		t.Error("Expected closed listener to fail the probe")
+	}
+}
+
+func TestGRPCProbe(t *testing.T) {
+	// тела HealthCheckResponse по сервисам, status (поле 1): 1 - SERVING, 2 - NOT_SERVING
+	responses := map[string][]byte{
+		"":         {0x08, 1},
+		"payments": {0x08, 2},
+		// перед status поля более новой версии сообщения: fixed64 (2), fixed32 (3), строка (4) и varint (5)
+		"extended": {
+			0x11, 1, 2, 3, 4, 5, 6, 7, 8,
+			0x1d, 1, 2, 3, 4,
+			0x22, 2, 'o', 'k',
+			0x28, 0x96, 0x01,
+			0x08, 1,
+		},
+		// fixed32 обрывается на середине
+		"truncated": {0x1d, 1, 2},
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" || r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		frame, _ := io.ReadAll(r.Body)
+		service := ""
+		if len(frame) > 7 { // 5 байт заголовка фрейма + тег + длина
+			service = string(frame[7:])
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		msg, ok := responses[service]
+		if !ok {
+			w.Header().Set("Grpc-Status", "5") // NOT_FOUND, ответ без тела
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+		w.Write(append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = protocols
+	srv.Start()
+	defer srv.Close()
+
+	if err := probe(t, srv.URL, config.HealthCheck{Type: "grpc"}); err != nil {
+		t.Errorf("Expected SERVING server, got %v", err)
+	}
+	if err := probe(t, srv.URL, config.HealthCheck{Type: "grpc", GRPCService: "payments"}); err == nil {
+		t.Error("Expected NOT_SERVING service to fail the probe")
+	}
+	if err := probe(t, srv.URL, config.HealthCheck{Type: "grpc", GRPCService: "extended"}); err != nil {
+		t.Errorf("Expected unknown fields of every wire type to be skipped, got %v", err)
+	}
+	if err := probe(t, srv.URL, config.HealthCheck{Type: "grpc", GRPCService: "truncated"}); err == nil {
+		t.Error("Expected truncated fixed32 field to fail the probe")
+	}
+	if err := probe(t, srv.URL, config.HealthCheck{Type: "grpc", GRPCService: "unknown"}); err == nil {
+		t.Error("Expected unknown service to fail the probe")
+	}
+}
@@ -0,0 +1,87 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+)
+
+// TestHTTPSProbeUsesUpstreamTLS - проверка здоровья https:// сервера с приватным CA идёт через настройки upstream_tls
+func TestHTTPSProbeUsesUpstreamTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+
+	pool := backend.NewPool([]config.Backend{{URL: srv.URL}})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := pool.Backends()[0].Probe(ctx); err == nil {
+		t.Fatal("Expected probe to fail: server certificate is signed by an unknown CA")
+	}
+	if err := pool.ConfigureUpstreamTLS(config.UpstreamTLS{CAFile: caFile}); err != nil {
+		t.Fatalf("Failed to configure upstream TLS: %v", err)
+	}
+	if err := pool.Backends()[0].Probe(ctx); err != nil {
+		t.Errorf("Expected healthy backend with trusted CA, got %v", err)
+	}
+}
+
+// TestHTTPSProbeClientCertificate - сервер требует клиентский сертификат (mTLS), заданный в tls сервера
+func TestHTTPSProbeClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// сертификат тестового сервера подходит и как клиентский
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	cert := srv.TLS.Certificates[0]
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, localhostKeyPEM(t, cert), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	withoutCert := backend.NewPool([]config.Backend{{URL: srv.URL, TLS: &config.UpstreamTLS{InsecureSkipVerify: true}}})
+	if err := withoutCert.Backends()[0].Probe(ctx); err == nil {
+		t.Fatal("Expected probe without client certificate to fail")
+	}
+
+	withCert := backend.NewPool([]config.Backend{{URL: srv.URL, TLS: &config.UpstreamTLS{
+		InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile,
+	}}})
+	if err := withCert.Backends()[0].Probe(ctx); err != nil {
+		t.Errorf("Expected healthy backend with client certificate, got %v", err)
+	}
+}
+
+// localhostKeyPEM - ключ сертификата тестового сервера в PEM
+func localhostKeyPEM(t *testing.T, cert tls.Certificate) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
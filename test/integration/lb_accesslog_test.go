@@ -0,0 +1,215 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"loadbalancer/internal/accesslog"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+// newAccessLog - журнал в файл во временном каталоге поверх балансировщика с одним сервером.
+// Возвращает обработчик, адрес сервера и функцию чтения строк журнала
+func newAccessLog(t *testing.T, conf config.AccessLog) (http.Handler, string, func() []string) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	conf.Output = filepath.Join(t.TempDir(), "access.log")
+	logger, err := accesslog.New(conf)
+	if err != nil {
+		t.Fatalf("accesslog.New failed: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, backend.NewPool([]config.Backend{{URL: upstream.URL}}), strategy, nil)
+	read := func() []string {
+		t.Helper()
+		data, err := os.ReadFile(conf.Output)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	return logger.Middleware(http.HandlerFunc(lb.BalanceRequest)), upstream.URL, read
+}
+
+// logRequest - GET path от клиента 203.0.113.7
+func logRequest(handler http.Handler, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "203.0.113.7:40000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	handler, upstream, read := newAccessLog(t, config.AccessLog{})
+	logRequest(handler, "/users?id=1")
+
+	lines := read()
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d: %v", len(lines), lines)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected valid JSON, got %q: %v", lines[0], err)
+	}
+	want := map[string]any{
+		"client_ip":    "203.0.113.7",
+		"method":       "GET",
+		"path":         "/users",
+		"status":       float64(200),
+		"bytes":        float64(5),
+		"backend":      upstream,
+		"retries":      float64(0),
+		"rate_limited": false,
+	}
+	for field, value := range want {
+		if entry[field] != value {
+			t.Errorf("Field %s: expected %v, got %v", field, value, entry[field])
+		}
+	}
+	// поля выводятся в фиксированном порядке
+	if !strings.HasPrefix(lines[0], `{"time":`) || !strings.HasSuffix(lines[0], `"rate_limited":false}`) {
+		t.Errorf("Unexpected field order: %s", lines[0])
+	}
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	handler, _, read := newAccessLog(t, config.AccessLog{
+		Format: "logfmt",
+		Fields: []string{"method", "path", "status", "client_ip"},
+	})
+	logRequest(handler, "/a%20b")
+	logRequest(handler, `/q"uote`)
+
+	want := []string{
+		`method=GET path="/a b" status=200 client_ip=203.0.113.7`,
+		`method=GET path="/q\"uote" status=200 client_ip=203.0.113.7`,
+	}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected logfmt output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAccessLogRedact(t *testing.T) {
+	handler, _, read := newAccessLog(t, config.AccessLog{
+		Fields: []string{"client_ip", "path", "status"},
+		Redact: []string{"client_ip", "path"},
+	})
+	logRequest(handler, "/secret/token")
+
+	if got := read()[0]; got != `{"client_ip":"[REDACTED]","path":"[REDACTED]","status":200}` {
+		t.Errorf("Expected redacted values, got %s", got)
+	}
+	if _, err := accesslog.New(config.AccessLog{Redact: []string{"authorization"}}); err == nil {
+		t.Error("Expected unknown redact field to be rejected")
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	handler, _, read := newAccessLog(t, config.AccessLog{SampleRate: 0.25, Fields: []string{"status"}})
+	const requests = 2000
+	for i := 0; i < requests; i++ {
+		logRequest(handler, "/")
+	}
+	// ожидаем около 500 строк, границы с запасом в несколько стандартных отклонений (~19)
+	if n := len(read()); n < 400 || n > 600 {
+		t.Errorf("Expected about 25%% of %d requests logged, got %d", requests, n)
+	}
+
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := accesslog.New(config.AccessLog{SampleRate: rate}); err == nil {
+			t.Errorf("Expected sample_rate %v to be rejected", rate)
+		}
+	}
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	logger, err := accesslog.New(config.AccessLog{Output: path, MaxSizeMB: 1, MaxBackups: 2, Fields: []string{"path"}})
+	if err != nil {
+		t.Fatalf("accesslog.New failed: %v", err)
+	}
+	defer logger.Close()
+	logged := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// ~4 КБ на строку, 1000 строк - около 4 МБ, то есть несколько ротаций
+	long := "/" + strings.Repeat("x", 4096)
+	for i := 0; i < 1000; i++ {
+		logRequest(logged, long)
+	}
+
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 1<<20 {
+			t.Errorf("Expected %s to stay within max_size_mb, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "access.log.3")); !os.IsNotExist(err) {
+		t.Error("Expected only max_backups old files to be kept")
+	}
+
+	// строки не разрываются между файлами
+	data, _ := os.ReadFile(filepath.Join(dir, "access.log.1"))
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if len(line) != len(`{"path":""}`)+len(long) {
+			t.Fatalf("Expected whole lines in rotated file, got line of %d bytes", len(line))
+		}
+	}
+}
+
+func TestAccessLogRotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	logger, err := accesslog.New(config.AccessLog{Output: path, MaxSizeMB: 1, MaxBackups: 1, Fields: []string{"path"}})
+	if err != nil {
+		t.Fatalf("accesslog.New failed: %v", err)
+	}
+	defer logger.Close()
+	logged := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// непустой каталог на месте access.log.1 не даёт ни удалить копию, ни переименовать в неё файл
+	backup := filepath.Join(dir, "access.log.1")
+	if err := os.MkdirAll(filepath.Join(backup, "keep"), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	long := "/" + strings.Repeat("x", 4096)
+	for i := 0; i < 300; i++ {
+		logRequest(logged, long)
+	}
+	if info, err := os.Stat(backup); err != nil || !info.IsDir() {
+		t.Fatalf("Expected rotation to fail while %s is a directory", backup)
+	}
+
+	// после устранения помехи журнал ротируется и продолжает писаться
+	if err := os.RemoveAll(backup); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	logRequest(logged, long)
+	logRequest(logged, "/after")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(data), `{"path":"/after"}`) {
+		t.Errorf("Expected logging to continue after a failed rotation, got %d bytes without the last entry", len(data))
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("Expected the log to rotate once the backup path is free: %v", err)
+	}
+}
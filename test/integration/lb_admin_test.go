@@ -0,0 +1,314 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"loadbalancer/internal/admin"
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+const adminToken = "test-token"
+
+// adminRequest - запрос к административному API с токеном, возвращает код и тело.
+// Ошибки пишет через t.Errorf, поэтому вызывается и из горутин
+func adminRequest(t *testing.T, api *httptest.Server, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Errorf("Failed to build request: %v", err)
+		return 0, ""
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%s %s failed: %v", method, path, err)
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func newAdminAPI(t *testing.T, pool *backend.Pool) *httptest.Server {
+	t.Helper()
+	s, err := admin.NewServer(config.Admin{Token: adminToken}, pool)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	api := httptest.NewServer(s.Handler())
+	t.Cleanup(api.Close)
+	return api
+}
+
+func TestAdminAPIConfig(t *testing.T) {
+	if _, err := admin.NewServer(config.Admin{}, backend.NewPool(nil)); err == nil {
+		t.Error("Expected NewServer without token to fail")
+	}
+	if _, err := admin.NewServer(config.Admin{Token: "change-me"}, backend.NewPool(nil)); err == nil {
+		t.Error("Expected NewServer with the sample token to fail")
+	}
+
+	s, err := admin.NewServer(config.Admin{Token: adminToken}, backend.NewPool(nil))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	if s.Addr() != "127.0.0.1:9090" {
+		t.Errorf("Expected API to listen on 127.0.0.1:9090 by default, got %s", s.Addr())
+	}
+	s, _ = admin.NewServer(config.Admin{Token: adminToken, Bind: "0.0.0.0", Port: 9191}, backend.NewPool(nil))
+	if s.Addr() != "0.0.0.0:9191" {
+		t.Errorf("Expected configured bind address 0.0.0.0:9191, got %s", s.Addr())
+	}
+}
+
+func TestAdminAPIAuth(t *testing.T) {
+	api := newAdminAPI(t, backend.NewPool(nil))
+
+	for name, header := range map[string]string{
+		"no token":    "",
+		"wrong token": "Bearer wrong",
+		"not bearer":  "Basic " + adminToken,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, api.URL+"/backends", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: expected 401 with WWW-Authenticate, got %d", name, resp.StatusCode)
+		}
+	}
+	if code, _ := adminRequest(t, api, http.MethodGet, "/backends", ""); code != http.StatusOK {
+		t.Errorf("Expected 200 with valid token, got %d", code)
+	}
+}
+
+func TestAdminAPIBackends(t *testing.T) {
+	var hitsA, hitsB atomic.Int32
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hitsA.Add(1) }))
+	defer srvA.Close()
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hitsB.Add(1) }))
+	defer srvB.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: srvA.URL}})
+	api := newAdminAPI(t, pool)
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+	defer lb.Close()
+
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			resp, err := http.Get(lb.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	t.Run("add", func(t *testing.T) {
+		code, body := adminRequest(t, api, http.MethodPost, "/backends", `{"url": "`+srvB.URL+`", "weight": 2}`)
+		if code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", code, body)
+		}
+		var status admin.BackendStatus
+		if err := json.Unmarshal([]byte(body), &status); err != nil || status.URL != srvB.URL || status.Weight != 2 {
+			t.Errorf("Unexpected status %s", body)
+		}
+		send(10)
+		if hitsB.Load() == 0 {
+			t.Error("Expected added backend to receive traffic")
+		}
+
+		code, body = adminRequest(t, api, http.MethodGet, "/backends", "")
+		var list []admin.BackendStatus
+		if err := json.Unmarshal([]byte(body), &list); err != nil || code != http.StatusOK || len(list) != 2 {
+			t.Errorf("Expected two backends in list, got %d: %s", code, body)
+		}
+	})
+
+	t.Run("bad input", func(t *testing.T) {
+		cases := []struct {
+			method, path, body string
+			code               int
+		}{
+			{http.MethodPost, "/backends", `{"url": `, http.StatusBadRequest},
+			{http.MethodPost, "/backends", `{"url": "127.0.0.1:8001"}`, http.StatusBadRequest},
+			{http.MethodPost, "/backends", `{"url": "` + srvB.URL + `"}`, http.StatusConflict},
+			{http.MethodPost, "/backends", `{"url": "http://127.0.0.1:1", "health_check": {"interval": "soon"}}`, http.StatusBadRequest},
+			{http.MethodPost, "/backends/drain?url=" + srvB.URL + "&enabled=maybe", "", http.StatusBadRequest},
+			{http.MethodPost, "/backends/drain?url=http://127.0.0.1:1", "", http.StatusNotFound},
+			{http.MethodDelete, "/backends?url=http://127.0.0.1:1", "", http.StatusNotFound},
+			{http.MethodPut, "/backends", "", http.StatusMethodNotAllowed},
+		}
+		for _, tc := range cases {
+			code, body := adminRequest(t, api, tc.method, tc.path, tc.body)
+			if code != tc.code {
+				t.Errorf("%s %s %s: expected %d, got %d: %s", tc.method, tc.path, tc.body, tc.code, code, body)
+			}
+			if code != http.StatusMethodNotAllowed && !strings.Contains(body, `"message"`) {
+				t.Errorf("%s %s: expected JSON error, got %s", tc.method, tc.path, body)
+			}
+		}
+		if n := len(pool.Backends()); n != 2 {
+			t.Errorf("Expected bad requests to leave 2 backends, got %d", n)
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		code, body := adminRequest(t, api, http.MethodPost, "/backends/drain?url="+srvB.URL, "")
+		if code != http.StatusOK || !strings.Contains(body, `"draining":true`) {
+			t.Fatalf("Expected draining backend, got %d: %s", code, body)
+		}
+		before := hitsB.Load()
+		send(10)
+		if hitsB.Load() != before {
+			t.Errorf("Expected drained backend to get no new requests, got %d", hitsB.Load()-before)
+		}
+
+		code, body = adminRequest(t, api, http.MethodPost, "/backends/drain?url="+srvB.URL+"&enabled=false", "")
+		if code != http.StatusOK || !strings.Contains(body, `"draining":false`) {
+			t.Fatalf("Expected backend back in service, got %d: %s", code, body)
+		}
+		send(10)
+		if hitsB.Load() == before {
+			t.Error("Expected backend to receive traffic again after drain is disabled")
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if code, body := adminRequest(t, api, http.MethodDelete, "/backends?url="+srvB.URL, ""); code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", code, body)
+		}
+		before := hitsB.Load()
+		send(10)
+		if hitsB.Load() != before {
+			t.Error("Expected removed backend to get no requests")
+		}
+		if code, _ := adminRequest(t, api, http.MethodDelete, "/backends?url="+srvB.URL, ""); code != http.StatusNotFound {
+			t.Errorf("Expected 404 on second delete, got %d", code)
+		}
+	})
+}
+
+// TestAdminAPIConcurrentMutation - сервера добавляются, выводятся и удаляются, пока идут запросы:
+// ни один запрос не должен упасть, пока в пуле остаётся постоянный сервер
+func TestAdminAPIConcurrentMutation(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	stable := httptest.NewServer(handler)
+	defer stable.Close()
+	extras := make([]*httptest.Server, 4)
+	for i := range extras {
+		extras[i] = httptest.NewServer(handler)
+		defer extras[i].Close()
+	}
+
+	pool := backend.NewPool([]config.Backend{{URL: stable.URL}})
+	api := newAdminAPI(t, pool)
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+	defer lb.Close()
+
+	var failed atomic.Int32
+	done := make(chan struct{})
+	var traffic sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		traffic.Add(1)
+		go func() {
+			defer traffic.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				resp, err := http.Get(lb.URL)
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+
+	var admins sync.WaitGroup
+	for _, extra := range extras {
+		admins.Add(1)
+		go func() {
+			defer admins.Done()
+			steps := []struct {
+				method, path, body string
+				code               int
+			}{
+				{http.MethodPost, "/backends", `{"url": "` + extra.URL + `"}`, http.StatusCreated},
+				{http.MethodPost, "/backends/drain?url=" + extra.URL, "", http.StatusOK},
+				{http.MethodPost, "/backends/drain?url=" + extra.URL + "&enabled=false", "", http.StatusOK},
+				{http.MethodDelete, "/backends?url=" + extra.URL, "", http.StatusOK},
+			}
+			for i := 0; i < 20; i++ {
+				for _, step := range steps {
+					if code, body := adminRequest(t, api, step.method, step.path, step.body); code != step.code {
+						t.Errorf("%s %s: expected %d, got %d: %s", step.method, step.path, step.code, code, body)
+					}
+				}
+			}
+		}()
+	}
+	admins.Wait()
+	close(done)
+	traffic.Wait()
+
+	if n := failed.Load(); n != 0 {
+		t.Errorf("Expected no failed requests while the pool changes, got %d", n)
+	}
+	if backends := pool.Backends(); len(backends) != 1 || backends[0].URL.String() != stable.URL {
+		t.Errorf("Expected only the stable backend left, got %d backends", len(backends))
+	}
+}
+
+func TestConfigSummaryHidesSecrets(t *testing.T) {
+	conf := &config.Config{
+		Port:      8080,
+		LBMethod:  "RR",
+		Backends:  []config.Backend{{URL: "http://127.0.0.1:8001"}},
+		Upstreams: []config.Upstream{{Name: "api", Backends: []config.Backend{{URL: "http://127.0.0.1:8002"}}}},
+		Admin:     config.Admin{Enabled: true, Token: "admin-secret"},
+		RateLimit: config.RateLimit{
+			Enabled: true,
+			JWT:     config.JWT{Secret: "jwt-secret"},
+			Store: config.Store{
+				Redis:  config.RedisStore{Password: "redis-secret"},
+				Gossip: config.GossipStore{Secret: "gossip-secret"},
+			},
+		},
+	}
+	summary := conf.Summary()
+	for _, secret := range []string{"admin-secret", "jwt-secret", "redis-secret", "gossip-secret"} {
+		if strings.Contains(summary, secret) {
+			t.Errorf("Expected %s not to be logged, got %s", secret, summary)
+		}
+	}
+	want := "port=8080 lb_method=RR backends=1 upstreams=[api(1)] routes=0 features=[rate_limit admin]"
+	if summary != want {
+		t.Errorf("Expected summary %q, got %q", want, summary)
+	}
+}
@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+func TestLoadBalancerCircuitBreaker(t *testing.T) {
+	// 1. Бэкенд отвечает 500, пока его не "починят"
+	var healthy atomic.Bool
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: upstream.URL}})
+	pool.EnableCircuitBreaker(config.CircuitBreaker{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		OpenTimeout:         100 * time.Millisecond,
+		HalfOpenRequests:    2,
+	})
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+	defer srv.Close()
+
+	get := func() int {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	b := pool.Backends()[0]
+
+	// 2. Три ошибки подряд размыкают выключатель, дальше запросы до бэкенда не доходят
+	for i := 0; i < 3; i++ {
+		if code := get(); code != http.StatusInternalServerError {
+			t.Fatalf("Expected 500 from backend, got %d", code)
+		}
+	}
+	if b.CircuitState() != backend.CircuitOpen {
+		t.Fatalf("Expected open circuit, got %s", b.CircuitState())
+	}
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while circuit is open, got %d", code)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("Expected no requests on backend while circuit is open, got %d", hits.Load()-3)
+	}
+	if !b.IsAlive() {
+		t.Error("Circuit breaker must not change the health-check Alive flag")
+	}
+
+	// 3. После open_timeout пробный запрос с ошибкой снова размыкает выключатель
+	time.Sleep(150 * time.Millisecond)
+	if code := get(); code != http.StatusInternalServerError {
+		t.Fatalf("Expected trial request to reach backend, got %d", code)
+	}
+	if b.CircuitState() != backend.CircuitOpen {
+		t.Fatalf("Expected circuit to reopen after failed trial, got %s", b.CircuitState())
+	}
+
+	// 4. Успешные пробные запросы замыкают выключатель
+	healthy.Store(true)
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code := get(); code != http.StatusOK {
+			t.Fatalf("Expected trial request %d to succeed, got %d", i+1, code)
+		}
+	}
+	if b.CircuitState() != backend.CircuitClosed {
+		t.Errorf("Expected closed circuit after successful trials, got %s", b.CircuitState())
+	}
+}
@@ -0,0 +1,146 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+)
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	resolver, err := clientip.New(config.ClientIP{TrustedProxies: []string{"10.0.0.0/8", "2001:db8:ffff::1"}})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer ignores XFF", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.5"},
+		{"XFF walked from the right", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.1.2.3"}, "198.51.100.7"},
+		{"all hops trusted - leftmost", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.9.9.9, 10.1.2.3"}, "10.9.9.9"},
+		{"garbage stops the walk", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, bogus, 10.1.2.3"}, "10.1.2.3"},
+		{"Forwarded with IPv6", "[2001:db8:ffff::1]:443", map[string]string{"Forwarded": `for=198.51.100.7, for="[2001:DB8::0:1]:4711"`}, "2001:db8::1"},
+		{"X-Real-IP", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"IPv4-mapped peer", "[::ffff:203.0.113.5]:1234", nil, "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got, err := resolver.ClientIP(req)
+			if err != nil {
+				t.Fatalf("ClientIP failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := clientip.New(config.ClientIP{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestClientIPProxyProtocol(t *testing.T) {
+	resolver, _ := clientip.New(config.ClientIP{TrustedProxies: []string{"127.0.0.1"}})
+	clientip.SetDefault(resolver)
+	defer clientip.SetDefault(nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _ := clientip.Get(r)
+		w.Write([]byte(ip))
+	})}
+	go srv.Serve(clientip.ProxyListener(ln))
+	defer srv.Close()
+
+	// v2: сигнатура, PROXY, TCP over IPv6, адреса и порты
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x21\x00\x24")
+	v2 = append(v2, net.ParseIP("2001:db8::42")...)
+	v2 = append(v2, net.ParseIP("2001:db8::1")...)
+	v2 = binary.BigEndian.AppendUint16(v2, 5000)
+	v2 = binary.BigEndian.AppendUint16(v2, 443)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"v1", []byte("PROXY TCP4 198.51.100.7 10.0.0.1 5000 80\r\n"), "198.51.100.7"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "127.0.0.1"},
+		{"v2", v2, "2001:db8::42"},
+		{"no header", nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			conn.Write(append(tt.header, "GET / HTTP/1.1\r\nHost: lb\r\nConnection: close\r\n\r\n"...))
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("ReadResponse failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body := make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterIPv6Prefix(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 60,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: 1},
+			IPv6Prefix:      64,
+			Tiers: []config.Tier{
+				{IPs: []string{"2001:DB8::99"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 1}},
+			},
+		},
+	}
+	bm := bucket.NewBucketManager(cfg)
+	defer bm.Stop()
+
+	if !bm.Allow(bucket.Client{IP: "2001:db8::1"}).Allowed {
+		t.Fatal("First request from /64 should be allowed")
+	}
+	if bm.Allow(bucket.Client{IP: "2001:db8::2"}).Allowed {
+		t.Error("Second address of the same /64 should share the bucket")
+	}
+	if !bm.Allow(bucket.Client{IP: "2001:db8:0:1::1"}).Allowed {
+		t.Error("Another /64 should have its own bucket")
+	}
+	if !bm.Allow(bucket.Client{IP: "2001:db8::99"}).Allowed {
+		t.Error("Special limit IP should keep its own bucket")
+	}
+	if !bm.Allow(bucket.Client{IP: "192.0.2.1"}).Allowed || !bm.Allow(bucket.Client{IP: "192.0.2.2"}).Allowed {
+		t.Error("IPv4 addresses should not be grouped")
+	}
+}
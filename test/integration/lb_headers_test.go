@@ -0,0 +1,217 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/clientip"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+func TestLoadBalancerHeaders(t *testing.T) {
+	// 1. Бэкенд возвращает полученные заголовки и добавляет "внутренние"
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("X-Powered-By", "PHP/8")
+		w.Header().Set("X-Internal-Trace", "abc")
+		w.Header().Set("X-Legacy", "v")
+	}))
+	defer upstream.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: upstream.URL}})
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, pool, strategy, nil)
+	err := lb.ConfigureHeaders(config.Headers{
+		Request: config.HeaderRules{
+			Rename: map[string]string{"X-Old-Token": "X-Token"},
+			Remove: []string{"X-Debug"},
+			Set:    map[string]string{"X-Request-Id": "${request_id}", "X-Client": "${client_ip} via ${backend}"},
+			Add:    map[string]string{"X-Env": "test"},
+		},
+		Response: config.HeaderRules{
+			Rename: map[string]string{"X-Legacy": "X-Modern"},
+			Set:    map[string]string{"X-Request-Id": "${request_id}"},
+		},
+		Forwarded:       true,
+		BackendHeader:   "X-Backend",
+		StripResponse:   true,
+		InternalHeaders: []string{"X-Internal-Trace"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure headers: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(lb.BalanceRequest))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/path", nil)
+	req.Header.Set("X-Old-Token", "secret")
+	req.Header.Set("X-Debug", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// 2. Заголовки запроса к бэкенду
+	requestID := got.Get("X-Request-Id")
+	checks := map[string]string{
+		"X-Token":           "secret",
+		"X-Old-Token":       "",
+		"X-Debug":           "",
+		"X-Client":          "127.0.0.1 via " + upstream.URL,
+		"X-Env":             "test",
+		"X-Forwarded-Proto": "http",
+		"X-Real-Ip":         "127.0.0.1",
+		"X-Forwarded-For":   "127.0.0.1",
+	}
+	for name, want := range checks {
+		if value := got.Get(name); value != want {
+			t.Errorf("Request header %s: expected %q, got %q", name, want, value)
+		}
+	}
+	if requestID == "" {
+		t.Error("Expected generated X-Request-Id")
+	}
+	if forwarded := got.Get("Forwarded"); forwarded == "" {
+		t.Error("Expected Forwarded header")
+	}
+
+	// 3. Заголовки ответа клиенту
+	respChecks := map[string]string{
+		"X-Backend":        upstream.URL,
+		"Server":           "",
+		"X-Powered-By":     "",
+		"X-Internal-Trace": "",
+		"X-Legacy":         "",
+		"X-Modern":         "v",
+		"X-Request-Id":     requestID, // тот же идентификатор, что ушёл на бэкенд
+	}
+	for name, want := range respChecks {
+		if value := resp.Header.Get(name); value != want {
+			t.Errorf("Response header %s: expected %q, got %q", name, want, value)
+		}
+	}
+
+	// 4. Неизвестная переменная в шаблоне - ошибка конфигурации
+	if err := lb.ConfigureHeaders(config.Headers{Request: config.HeaderRules{Set: map[string]string{"X": "${nope}"}}}); err == nil {
+		t.Error("Expected error for unknown template variable")
+	}
+}
+
+func TestForwardedHeadersTrust(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, backend.NewPool([]config.Backend{{URL: upstream.URL}}), strategy, nil)
+	if err := lb.ConfigureHeaders(config.Headers{Forwarded: true}); err != nil {
+		t.Fatalf("Failed to configure headers: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(lb.BalanceRequest))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	// клиент присылает цепочку прокси, которой не было
+	send := func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		req.Header.Set("Forwarded", "for=203.0.113.9;proto=https")
+		req.Header.Set("X-Forwarded-Host", "spoofed.example.com")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// 1. Собеседник не доверенный прокси - его заголовки заменяются
+	send()
+	untrusted := map[string]string{
+		"X-Forwarded-For":   "127.0.0.1",
+		"Forwarded":         `for=127.0.0.1;host="` + host + `";proto=http`,
+		"X-Forwarded-Host":  host,
+		"X-Forwarded-Proto": "http",
+		"X-Real-Ip":         "127.0.0.1",
+	}
+	for name, want := range untrusted {
+		if value := strings.Join(got.Values(name), ", "); value != want {
+			t.Errorf("Untrusted peer, %s: expected %q, got %q", name, want, value)
+		}
+	}
+
+	// 2. Собеседник - доверенный прокси: цепочка продолжается, исходные host и proto сохраняются
+	resolver, _ := clientip.New(config.ClientIP{TrustedProxies: []string{"127.0.0.1"}})
+	clientip.SetDefault(resolver)
+	defer clientip.SetDefault(nil)
+	send()
+	trusted := map[string]string{
+		"X-Forwarded-For":   "203.0.113.9, 127.0.0.1",
+		"Forwarded":         `for=203.0.113.9;proto=https, for=203.0.113.9;host="` + host + `";proto=http`,
+		"X-Forwarded-Host":  "spoofed.example.com",
+		"X-Forwarded-Proto": "https",
+		"X-Real-Ip":         "203.0.113.9",
+	}
+	for name, want := range trusted {
+		if value := strings.Join(got.Values(name), ", "); value != want {
+			t.Errorf("Trusted peer, %s: expected %q, got %q", name, want, value)
+		}
+	}
+}
+
+func TestResponseRulesOnGeneratedErrors(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: closed.URL}})
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, pool, strategy, nil)
+	if err := lb.ConfigureHeaders(config.Headers{
+		Response:      config.HeaderRules{Set: map[string]string{"X-Request-Id": "${request_id}", "Cache-Control": "no-store"}},
+		BackendHeader: "X-Backend",
+	}); err != nil {
+		t.Fatalf("Failed to configure headers: %v", err)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-Id", "req-1")
+		lb.BalanceRequest(rec, req)
+		return rec
+	}
+
+	// 502: бэкенд не принимает соединения, ответ пишет балансировщик
+	rec := get()
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502, got %d", rec.Code)
+	}
+	for name, want := range map[string]string{"X-Request-Id": "req-1", "Cache-Control": "no-store", "X-Backend": closed.URL} {
+		if value := rec.Header().Get(name); value != want {
+			t.Errorf("502 response header %s: expected %q, got %q", name, want, value)
+		}
+	}
+
+	// 503: живых серверов нет, сервер не выбран - заголовка с адресом нет
+	pool.Backends()[0].SetAlive(false)
+	rec = get()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-Request-Id") != "req-1" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected response rules on 503, got %v", rec.Header())
+	}
+	if _, ok := rec.Header()["X-Backend"]; ok {
+		t.Error("Expected no backend header when no backend was selected")
+	}
+}
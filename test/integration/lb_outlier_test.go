@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+// outlierBackend - бэкенд, который отвечает кодом status и считает запросы
+type outlierBackend struct {
+	status atomic.Int32
+	hits   atomic.Int32
+	srv    *httptest.Server
+}
+
+func newOutlierBackend(t *testing.T, status int) *outlierBackend {
+	t.Helper()
+	ob := &outlierBackend{}
+	ob.status.Store(int32(status))
+	ob.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ob.hits.Add(1)
+		w.WriteHeader(int(ob.status.Load()))
+	}))
+	t.Cleanup(ob.srv.Close)
+	return ob
+}
+
+// newOutlierLB - балансировщик RR над urls с пассивной проверкой здоровья conf, возвращает функцию запроса
+func newOutlierLB(t *testing.T, conf config.OutlierDetection, urls ...string) (*backend.Pool, func() int) {
+	t.Helper()
+	backends := make([]config.Backend, len(urls))
+	for i, url := range urls {
+		backends[i] = config.Backend{URL: url}
+	}
+	pool := backend.NewPool(backends)
+	conf.Enabled = true
+	pool.EnableOutlierDetection(conf)
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+	t.Cleanup(lb.Close)
+
+	return pool, func() int {
+		resp, err := http.Get(lb.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+}
+
+func TestOutlierConsecutive5xx(t *testing.T) {
+	ob := newOutlierBackend(t, http.StatusInternalServerError)
+	pool, get := newOutlierLB(t, config.OutlierDetection{
+		Consecutive5xx:     3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionPercent: 100,
+	}, ob.srv.URL)
+	b := pool.Backends()[0]
+
+	// успешный ответ обнуляет счётчик: 2 ошибки, успех, 2 ошибки - порог не достигнут
+	for _, status := range []int{500, 500, 200, 500, 500} {
+		ob.status.Store(int32(status))
+		get()
+	}
+	if b.IsEjected() {
+		t.Fatal("Expected success in between to reset the consecutive 5xx counter")
+	}
+
+	// третья ошибка подряд исключает сервер, запросы до него больше не доходят
+	get()
+	if !b.IsEjected() {
+		t.Fatal("Expected backend to be ejected after 3 consecutive 5xx")
+	}
+	hits := ob.hits.Load()
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with the only backend ejected, got %d", code)
+	}
+	if ob.hits.Load() != hits {
+		t.Error("Expected ejected backend to get no requests")
+	}
+}
+
+func TestOutlierGatewayFailures(t *testing.T) {
+	conf := config.OutlierDetection{
+		Consecutive5xx:             10,
+		ConsecutiveGatewayFailures: 2,
+		BaseEjectionTime:           time.Minute,
+		MaxEjectionPercent:         100,
+	}
+
+	t.Run("502 responses", func(t *testing.T) {
+		ob := newOutlierBackend(t, http.StatusBadGateway)
+		pool, get := newOutlierLB(t, conf, ob.srv.URL)
+		get()
+		if pool.Backends()[0].IsEjected() {
+			t.Fatal("Expected one gateway failure to stay below the threshold")
+		}
+		get()
+		if !pool.Backends()[0].IsEjected() {
+			t.Error("Expected backend to be ejected after 2 consecutive 502")
+		}
+	})
+
+	t.Run("connection errors", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		pool, get := newOutlierLB(t, conf, closed.URL)
+		for i := 0; i < 2; i++ {
+			if code := get(); code != http.StatusBadGateway {
+				t.Fatalf("Expected 502 for refused connection, got %d", code)
+			}
+		}
+		if !pool.Backends()[0].IsEjected() {
+			t.Error("Expected backend to be ejected after 2 connection errors")
+		}
+	})
+
+	t.Run("plain 500 is not a gateway failure", func(t *testing.T) {
+		ob := newOutlierBackend(t, http.StatusInternalServerError)
+		pool, get := newOutlierLB(t, conf, ob.srv.URL)
+		for i := 0; i < 5; i++ {
+			get()
+		}
+		if pool.Backends()[0].IsEjected() {
+			t.Error("Expected 500 to count only towards consecutive_5xx")
+		}
+	})
+}
+
+func TestOutlierEjectionTimeGrows(t *testing.T) {
+	ob := newOutlierBackend(t, http.StatusInternalServerError)
+	pool, get := newOutlierLB(t, config.OutlierDetection{
+		Consecutive5xx:     1,
+		BaseEjectionTime:   100 * time.Millisecond,
+		MaxEjectionTime:    300 * time.Millisecond,
+		MaxEjectionPercent: 100,
+	}, ob.srv.URL)
+	b := pool.Backends()[0]
+
+	// 100ms, затем 200ms, затем 400ms ограничивается max_ejection_time 300ms
+	for _, duration := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		get()
+		if !b.IsEjected() {
+			t.Fatalf("Expected backend to be ejected for %v", duration)
+		}
+		time.Sleep(duration / 2)
+		if !b.IsEjected() {
+			t.Errorf("Expected backend to stay ejected halfway through %v", duration)
+		}
+		time.Sleep(duration/2 + 50*time.Millisecond)
+		if b.IsEjected() {
+			t.Errorf("Expected ejection of %v to be over", duration)
+		}
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	urls := make([]string, 4)
+	backends := make([]*outlierBackend, 4)
+	for i := range backends {
+		backends[i] = newOutlierBackend(t, http.StatusInternalServerError)
+		urls[i] = backends[i].srv.URL
+	}
+	pool, get := newOutlierLB(t, config.OutlierDetection{
+		Consecutive5xx:     1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionPercent: 50,
+	}, urls...)
+
+	for i := 0; i < 12; i++ {
+		get()
+	}
+	ejected := 0
+	for _, b := range pool.Backends() {
+		if b.IsEjected() {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Fatalf("Expected max_ejection_percent 50 to cap ejections at 2 of 4, got %d", ejected)
+	}
+
+	// оставшиеся сервера продолжают получать трафик, хотя тоже отвечают ошибками
+	if code := get(); code != http.StatusInternalServerError {
+		t.Errorf("Expected requests to reach the backends kept in the pool, got %d", code)
+	}
+}
@@ -0,0 +1,301 @@
+package integration
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+	"loadbalancer/internal/ratelimiter/middleware"
+	"loadbalancer/internal/server"
+)
+
+// signJWT - компактный JWT с заданными claims, sign подписывает "header.payload"
+func signJWT(t *testing.T, alg string, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+// rateLimitCodes - статусы n запросов через ограничитель, prepare настраивает каждый запрос
+func rateLimitCodes(handler http.Handler, n int, prepare func(r *http.Request)) map[int]int {
+	codes := make(map[int]int)
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		prepare(req)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes[rec.Code]++
+	}
+	return codes
+}
+
+func TestRateLimiterKeyExtractors(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	newHandler := func(t *testing.T, rl config.RateLimit) http.Handler {
+		rl.Enabled = true
+		rl.CleanupInterval = 1 * time.Minute
+		if rl.Default.Burst == 0 {
+			rl.Default = config.Limit{RequestsPerSec: 1, Burst: 2}
+		}
+		cfg := &config.Config{RateLimit: rl}
+		if err := bucket.Validate(cfg); err != nil {
+			t.Fatalf("Validate failed: %v", err)
+		}
+		bm := bucket.NewBucketManager(cfg)
+		t.Cleanup(bm.Stop)
+		return middleware.RateLimitMiddleware(bm, ok)
+	}
+
+	t.Run("header key with tiers", func(t *testing.T) {
+		handler := newHandler(t, config.RateLimit{
+			Key:   "header:X-API-Key",
+			Tiers: []config.Tier{{Name: "gold", Keys: []string{"gold-key"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 5}}},
+		})
+		// разные ключи - разные бакеты (с разных IP, иначе их ограничит общий лимит IP)
+		for i, key := range []string{"a", "b"} {
+			got := rateLimitCodes(handler, 3, func(r *http.Request) {
+				r.RemoteAddr = "203.0.113." + strconv.Itoa(i+1) + ":1"
+				r.Header.Set("X-API-Key", key)
+			})
+			if got[200] != 2 || got[429] != 1 {
+				t.Errorf("Key %s: expected 2 allowed and 1 limited, got %v", key, got)
+			}
+		}
+		// ключ из tiers не ограничивается лимитом IP, даже если IP его уже исчерпал
+		if got := rateLimitCodes(handler, 6, func(r *http.Request) {
+			r.RemoteAddr = "203.0.113.1:1"
+			r.Header.Set("X-API-Key", "gold-key")
+		}); got[200] != 5 {
+			t.Errorf("Gold tier: expected 5 allowed, got %v", got)
+		}
+		// без ключа - по IP
+		if got := rateLimitCodes(handler, 3, func(r *http.Request) { r.RemoteAddr = "198.51.100.1:1" }); got[200] != 2 {
+			t.Errorf("Fallback to IP: expected 2 allowed, got %v", got)
+		}
+	})
+
+	t.Run("query and cookie", func(t *testing.T) {
+		for _, tt := range []struct {
+			key     string
+			prepare func(r *http.Request)
+		}{
+			{"query:api_key", func(r *http.Request) { r.URL.RawQuery = "api_key=q1" }},
+			{"cookie:session", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "c1"}) }},
+		} {
+			handler := newHandler(t, config.RateLimit{Key: tt.key})
+			if got := rateLimitCodes(handler, 3, tt.prepare); got[200] != 2 {
+				t.Errorf("%s: expected 2 allowed, got %v", tt.key, got)
+			}
+			// ключа нет в tiers, поэтому его запросы списаны и с бакета IP: тот же IP без ключа уже ограничен
+			if got := rateLimitCodes(handler, 1, func(*http.Request) {}); got[429] != 1 {
+				t.Errorf("%s: expected IP bucket shared with unknown key, got %v", tt.key, got)
+			}
+		}
+	})
+
+	t.Run("jwt sub", func(t *testing.T) {
+		handler := newHandler(t, config.RateLimit{
+			Key:   "jwt",
+			Tiers: []config.Tier{{Name: "alice", Keys: []string{"alice"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 4}}},
+		})
+		token := signJWT(t, "HS256", map[string]any{"sub": "alice"}, hs256("whatever"))
+		if got := rateLimitCodes(handler, 5, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }); got[200] != 4 {
+			t.Errorf("Expected 4 allowed for alice, got %v", got)
+		}
+	})
+
+	t.Run("jwt_verified HS256", func(t *testing.T) {
+		handler := newHandler(t, config.RateLimit{
+			Key:   "jwt_verified",
+			JWT:   config.JWT{Secret: "s3cret"},
+			Tiers: []config.Tier{{Name: "bob", Keys: []string{"bob"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 4}}},
+		})
+		valid := signJWT(t, "HS256", map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}, hs256("s3cret"))
+		if got := rateLimitCodes(handler, 5, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+valid) }); got[200] != 4 {
+			t.Errorf("Valid token: expected 4 allowed, got %v", got)
+		}
+		// поддельная подпись и просроченный токен - ключа нет, ограничение по IP (burst 2)
+		for name, token := range map[string]string{
+			"forged":  signJWT(t, "HS256", map[string]any{"sub": "bob"}, hs256("wrong")),
+			"expired": signJWT(t, "HS256", map[string]any{"sub": "bob", "exp": time.Now().Add(-time.Hour).Unix()}, hs256("s3cret")),
+			"none":    signJWT(t, "none", map[string]any{"sub": "bob"}, func([]byte) []byte { return nil }),
+		} {
+			ip := map[string]string{"forged": "192.0.2.1:1", "expired": "192.0.2.2:1", "none": "192.0.2.3:1"}[name]
+			got := rateLimitCodes(handler, 3, func(r *http.Request) {
+				r.RemoteAddr = ip
+				r.Header.Set("Authorization", "Bearer "+token)
+			})
+			if got[200] != 2 {
+				t.Errorf("%s token: expected fallback to IP with 2 allowed, got %v", name, got)
+			}
+		}
+	})
+
+	t.Run("jwt_verified RS256", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		path := filepath.Join(t.TempDir(), "jwt.pem")
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+
+		handler := newHandler(t, config.RateLimit{Key: "jwt_verified", JWT: config.JWT{PublicKeyFile: path, Header: "X-Token"}})
+		token := signJWT(t, "RS256", map[string]any{"sub": "carol"}, func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			return sig
+		})
+		if got := rateLimitCodes(handler, 3, func(r *http.Request) { r.Header.Set("X-Token", token) }); got[200] != 2 || got[429] != 1 {
+			t.Errorf("Expected 2 allowed and 1 limited for carol, got %v", got)
+		}
+		if got := rateLimitCodes(handler, 1, func(*http.Request) {}); got[200] != 1 {
+			t.Errorf("Expected separate IP bucket without token, got %v", got)
+		}
+	})
+
+	t.Run("invalid specs", func(t *testing.T) {
+		for _, spec := range []string{"header:", "unknown", "ip+query:", "jwt_verified"} {
+			cfg := &config.Config{RateLimit: config.RateLimit{Key: spec}}
+			if err := bucket.Validate(cfg); err == nil {
+				t.Errorf("Expected error for key %q", spec)
+			}
+		}
+	})
+}
+
+// TestRateLimiterUnknownKeys - ключи, которые клиент придумывает сам, не обходят лимит IP и не заводят бакеты без предела
+func TestRateLimiterUnknownKeys(t *testing.T) {
+	newManager := func(t *testing.T, maxBuckets int) *bucket.BucketManager {
+		cfg := &config.Config{RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 1 * time.Minute,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: 2},
+			Key:             "header:X-API-Key",
+			MaxBuckets:      maxBuckets,
+		}}
+		bm := bucket.NewBucketManager(cfg)
+		t.Cleanup(bm.Stop)
+		return bm
+	}
+
+	t.Run("new keys do not bypass ip limit", func(t *testing.T) {
+		bm := newManager(t, 0)
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			if bm.Allow(bucket.Client{Key: "invented-" + strconv.Itoa(i), IP: "192.0.2.10"}).Allowed {
+				allowed++
+			}
+		}
+		if allowed != 2 {
+			t.Errorf("Expected IP burst of 2 across invented keys, got %d", allowed)
+		}
+	})
+
+	t.Run("key limit applies across ips", func(t *testing.T) {
+		bm := newManager(t, 0)
+		allowed := 0
+		for i := 0; i < 5; i++ {
+			if bm.Allow(bucket.Client{Key: "shared", IP: "192.0.2." + strconv.Itoa(20+i)}).Allowed {
+				allowed++
+			}
+		}
+		if allowed != 2 {
+			t.Errorf("Expected key burst of 2 across IPs, got %d", allowed)
+		}
+	})
+
+	t.Run("max buckets", func(t *testing.T) {
+		bm := newManager(t, 3)
+		// бакеты: IP .1 и ключ k, затем IP .2 - предел достигнут
+		bm.Allow(bucket.Client{Key: "k", IP: "192.0.2.1"})
+		bm.Allow(bucket.Client{Key: "k", IP: "192.0.2.2"})
+		// существующий бакет ключа по-прежнему действует
+		if bm.Allow(bucket.Client{Key: "k", IP: "192.0.2.3"}).Allowed {
+			t.Error("Expected existing key bucket to be enforced at max_buckets")
+		}
+		// новый ключ бакета не получает: с разных IP действует только лимит каждого IP
+		allowed := 0
+		for i := 0; i < 3; i++ {
+			if bm.Allow(bucket.Client{Key: "fresh", IP: "192.0.2." + strconv.Itoa(30+i)}).Allowed {
+				allowed++
+			}
+		}
+		if allowed != 3 {
+			t.Errorf("Expected new key limited by IP only at max_buckets, got %d allowed", allowed)
+		}
+	})
+}
+
+func TestRateLimiterRouteCompositeKey(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		LBMethod: "RR",
+		Routes: []config.Route{
+			{Name: "api", PathPrefix: "/api"},
+			{Name: "static", PathPrefix: "/static"},
+		},
+		RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 1 * time.Minute,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: 2},
+			Key:             "route+header:X-API-Key",
+			// ключи из tiers не ограничиваются общим лимитом IP, поэтому видно бакеты маршрутов
+			Tiers: []config.Tier{{Name: "k1", Keys: []string{"api+k1", "static+k1"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 2}}},
+		},
+	}
+	pool := backend.NewPool([]config.Backend{{URL: upstream.URL}})
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, pool, strategy, nil)
+	if err := lb.ConfigureRoutes(cfg); err != nil {
+		t.Fatalf("ConfigureRoutes failed: %v", err)
+	}
+	bm := bucket.NewBucketManager(cfg)
+	defer bm.Stop()
+	lb.SetBucketManager(bm)
+	handler := middleware.RateLimitMiddleware(bm, http.HandlerFunc(lb.BalanceRequest))
+
+	// у каждого маршрута свой бакет для одного и того же ключа
+	for _, path := range []string{"/api/users", "/static/app.js"} {
+		codes := make(map[int]int)
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("X-API-Key", "k1")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			codes[rec.Code]++
+		}
+		if codes[200] != 2 || codes[429] != 1 {
+			t.Errorf("%s: expected 2 allowed and 1 limited, got %v", path, codes)
+		}
+	}
+}
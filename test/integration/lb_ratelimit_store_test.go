@@ -0,0 +1,596 @@
+package integration
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+	"loadbalancer/internal/redis"
+)
+
+// fakeRedis - redis в процессе для тестов: протокол RESP2, строки с PX, TIME по своим часам и кеш скриптов
+// по SHA1, как у настоящего redis. Lua он не исполняет: скрипт GCRA ограничителя выполняется так же на Go
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+	delay    atomic.Int64 // сколько ждать перед ответом на каждую команду, наносекунды
+
+	mux     sync.Mutex
+	now     time.Time
+	data    map[string]fakeValue
+	scripts map[string]string // sha1 -> исходник
+	calls   map[string]int    // команда -> сколько раз вызвана
+	db      string            // последняя выбранная база
+}
+
+type fakeValue struct {
+	value    string
+	expireAt time.Time // нулевое - без срока
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	fr := &fakeRedis{
+		ln:       ln,
+		password: password,
+		now:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		data:     make(map[string]fakeValue),
+		scripts:  make(map[string]string),
+		calls:    make(map[string]int),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	t.Cleanup(fr.Close)
+	return fr
+}
+
+func (fr *fakeRedis) Addr() string { return fr.ln.Addr().String() }
+
+func (fr *fakeRedis) Close() { fr.ln.Close() }
+
+// advance - сдвигает часы, которые отдаёт TIME
+func (fr *fakeRedis) advance(d time.Duration) {
+	fr.mux.Lock()
+	fr.now = fr.now.Add(d)
+	fr.mux.Unlock()
+}
+
+func (fr *fakeRedis) callCount(cmd string) int {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	return fr.calls[cmd]
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := fr.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == fr.password {
+				authed = true
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		default:
+			// задержка не под fr.mux: медленный redis отвечает разным соединениям параллельно
+			time.Sleep(time.Duration(fr.delay.Load()))
+			fr.exec(w, cmd, args[1:])
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand - команда клиента: массив bulk-строк
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk header %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (fr *fakeRedis) exec(w *bufio.Writer, cmd string, args []string) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	fr.calls[cmd]++
+
+	switch cmd {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "SELECT":
+		fr.db = args[0]
+		w.WriteString("+OK\r\n")
+	case "TIME":
+		micros := fr.now.UnixMicro()
+		w.WriteString("*2\r\n")
+		writeBulk(w, strconv.FormatInt(micros/1e6, 10))
+		writeBulk(w, strconv.FormatInt(micros%1e6, 10))
+	case "GET":
+		if v, ok := fr.get(args[0]); ok {
+			writeBulk(w, v)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case "EVAL":
+		sum := sha1.Sum([]byte(args[0]))
+		fr.scripts[hex.EncodeToString(sum[:])] = args[0]
+		fr.runScript(w, args[0], args[1:])
+	case "EVALSHA":
+		src, ok := fr.scripts[args[0]]
+		if !ok {
+			w.WriteString("-NOSCRIPT No matching script. Please use EVAL.\r\n")
+			return
+		}
+		fr.runScript(w, src, args[1:])
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// get - значение ключа с учётом срока жизни, вызывается под fr.mux
+func (fr *fakeRedis) get(key string) (string, bool) {
+	v, ok := fr.data[key]
+	if !ok || (!v.expireAt.IsZero() && !fr.now.Before(v.expireAt)) {
+		return "", false
+	}
+	return v.value, true
+}
+
+// runScript - выполняет известный скрипт, args - numkeys, ключи и аргументы. Вызывается под fr.mux
+func (fr *fakeRedis) runScript(w *bufio.Writer, src string, args []string) {
+	if src != bucket.GCRAScript {
+		w.WriteString("-ERR fake redis runs the rate limiter GCRA script only\r\n")
+		return
+	}
+	key := args[1]
+	interval, _ := strconv.ParseInt(args[2], 10, 64)
+	tolerance, _ := strconv.ParseInt(args[3], 10, 64)
+
+	now := fr.now.UnixMicro()
+	tat := now
+	if v, ok := fr.get(key); ok {
+		tat, _ = strconv.ParseInt(v, 10, 64)
+	}
+	tat = max(tat, now)
+	allowed := 0
+	if tat+interval-now <= tolerance {
+		allowed = 1
+		tat += interval
+		fr.data[key] = fakeValue{value: strconv.FormatInt(tat, 10), expireAt: fr.now.Add(time.Duration(tat-now) * time.Microsecond)}
+	}
+	remaining, reset := tolerance/interval, int64(0)
+	if ahead := tat - now; ahead > 0 {
+		remaining = max((tolerance-ahead)/interval, 0)
+		reset = ahead - (tolerance - (remaining+1)*interval)
+	}
+	fmt.Fprintf(w, "*3\r\n:%d\r\n:%d\r\n:%d\r\n", allowed, remaining, reset)
+}
+
+// countAllowed - сколько из n запросов клиента пропустили ограничители, запросы идут по очереди на каждый
+func countAllowed(n int, ip string, managers ...*bucket.BucketManager) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if managers[i%len(managers)].Allow(bucket.Client{IP: ip}).Allowed {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func newStoreManager(t *testing.T, store config.Store) *bucket.BucketManager {
+	t.Helper()
+	cfg := &config.Config{RateLimit: config.RateLimit{
+		Enabled:         true,
+		CleanupInterval: 1 * time.Minute,
+		Default:         config.Limit{RequestsPerSec: 1, Burst: 5},
+		Store:           store,
+	}}
+	if err := bucket.Validate(cfg); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	bm := bucket.NewBucketManager(cfg)
+	t.Cleanup(bm.Stop)
+	return bm
+}
+
+func TestRateLimiterRedisStore(t *testing.T) {
+	fr := newFakeRedis(t, "secret")
+	store := config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{Addr: fr.Addr(), Password: "secret", DB: 2}}
+	replica1 := newStoreManager(t, store)
+	replica2 := newStoreManager(t, store)
+
+	t.Run("replicas share one limit", func(t *testing.T) {
+		if allowed := countAllowed(20, "10.0.0.1", replica1, replica2); allowed != 5 {
+			t.Errorf("Expected 5 requests allowed across two replicas, got %d", allowed)
+		}
+		// скрипт загружается один раз, дальше вызывается по хешу
+		if evals := fr.callCount("EVAL"); evals != 1 {
+			t.Errorf("Expected one EVAL after NOSCRIPT, got %d", evals)
+		}
+		if fr.callCount("EVALSHA") != 20 {
+			t.Errorf("Expected 20 EVALSHA calls, got %d", fr.callCount("EVALSHA"))
+		}
+		fr.mux.Lock()
+		db := fr.db
+		fr.mux.Unlock()
+		if db != "2" {
+			t.Errorf("Expected SELECT 2, got %q", db)
+		}
+	})
+
+	t.Run("refills by redis time", func(t *testing.T) {
+		fr.advance(2 * time.Second)
+		if allowed := countAllowed(10, "10.0.0.1", replica2, replica1); allowed != 2 {
+			t.Errorf("Expected 2 requests allowed after 2s at 1 rps, got %d", allowed)
+		}
+	})
+
+	t.Run("decision from redis", func(t *testing.T) {
+		d := replica1.Allow(bucket.Client{IP: "10.0.0.9"})
+		if !d.Allowed || d.Limit != 5 || d.Remaining != 4 || d.Reset != time.Second {
+			t.Errorf("Expected allowed with 4 of 5 remaining and 1s reset, got %+v", d)
+		}
+	})
+
+	t.Run("slow redis does not serialize clients", func(t *testing.T) {
+		const clients, delay = 10, 50 * time.Millisecond
+		fr.delay.Store(int64(delay))
+		defer fr.delay.Store(0)
+
+		calls := fr.callCount("EVALSHA")
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if !replica1.Allow(bucket.Client{IP: fmt.Sprintf("10.0.1.%d", i)}).Allowed {
+					t.Errorf("Expected the first request of client %d to be allowed", i)
+				}
+			}()
+		}
+		wg.Wait()
+		// по очереди проверки заняли бы clients*delay = 500ms
+		if elapsed := time.Since(start); elapsed > clients*delay/2 {
+			t.Errorf("Expected concurrent checks to wait for redis in parallel, took %v", elapsed)
+		}
+		if n := fr.callCount("EVALSHA") - calls; n != clients {
+			t.Errorf("Expected every check to reach redis, got %d EVALSHA calls", n)
+		}
+	})
+
+	t.Run("falls back to memory when redis is down", func(t *testing.T) {
+		down := newStoreManager(t, config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{
+			Addr: "127.0.0.1:1", Timeout: 50 * time.Millisecond,
+		}})
+		if allowed := countAllowed(10, "10.0.0.2", down); allowed != 5 {
+			t.Errorf("Expected burst of 5 allowed by local buckets, got %d", allowed)
+		}
+	})
+
+	t.Run("backs off while redis is down", func(t *testing.T) {
+		// сервер принимает соединение и сразу закрывает его - каждый запрос к redis заканчивается ошибкой
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer ln.Close()
+		var accepts atomic.Int32
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				accepts.Add(1)
+				conn.Close()
+			}
+		}()
+
+		down := newStoreManager(t, config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{Addr: ln.Addr().String()}})
+		if allowed := countAllowed(10, "10.0.0.4", down); allowed != 5 {
+			t.Errorf("Expected burst of 5 allowed by local buckets, got %d", allowed)
+		}
+		if n := accepts.Load(); n != 1 {
+			t.Errorf("Expected one connection to redis before backoff, got %d", n)
+		}
+		// после паузы redis снова проверяет один запрос
+		time.Sleep(600 * time.Millisecond)
+		countAllowed(5, "10.0.0.4", down)
+		if n := accepts.Load(); n != 2 {
+			t.Errorf("Expected one more connection after backoff expired, got %d", n)
+		}
+	})
+
+	t.Run("wrong password falls back to memory", func(t *testing.T) {
+		bad := newStoreManager(t, config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{Addr: fr.Addr(), Password: "wrong"}})
+		if allowed := countAllowed(10, "10.0.0.3", bad); allowed != 5 {
+			t.Errorf("Expected burst of 5 allowed by local buckets, got %d", allowed)
+		}
+	})
+}
+
+// TestGCRAScriptMatchesFake - настоящий redis выполняет GCRAScript так же, как fakeRedis, на котором
+// построены остальные тесты. Нужен запущенный redis: LB_TEST_REDIS_ADDR=127.0.0.1:6379 go test ./test/integration/
+func TestGCRAScriptMatchesFake(t *testing.T) {
+	addr := os.Getenv("LB_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("LB_TEST_REDIS_ADDR is not set")
+	}
+	server := redis.New(redis.Options{Addr: addr, Password: os.Getenv("LB_TEST_REDIS_PASSWORD")})
+	defer server.Close()
+	fr := newFakeRedis(t, "")
+	fake := redis.New(redis.Options{Addr: fr.Addr()})
+	defer fake.Close()
+	script := redis.NewScript(bucket.GCRAScript)
+
+	cases := []struct {
+		name      string
+		interval  int64 // микросекунды
+		tolerance int64
+		calls     int
+	}{
+		{"1 rps burst 3", 1_000_000, 3_000_000, 6},
+		{"2 rps burst 1", 500_000, 500_000, 3},
+		{"3 rps burst 2", 333_333, 666_666, 5},
+	}
+	for _, tc := range cases {
+		key := fmt.Sprintf("lb:test:gcra:%d:%s", time.Now().UnixNano(), tc.name)
+		args := []string{strconv.FormatInt(tc.interval, 10), strconv.FormatInt(tc.tolerance, 10)}
+		for i := 0; i < tc.calls; i++ {
+			want, err := script.Run(fake, []string{key}, args...)
+			if err != nil {
+				t.Fatalf("%s: fake redis: %v", tc.name, err)
+			}
+			got, err := script.Run(server, []string{key}, args...)
+			if err != nil {
+				t.Fatalf("%s: redis: %v", tc.name, err)
+			}
+			w, g := want.([]any), got.([]any)
+			if len(g) != 3 || g[0] != w[0] || g[1] != w[1] {
+				t.Fatalf("%s call %d: redis returned %v, fake %v", tc.name, i, g, w)
+			}
+			// часы настоящего redis идут между вызовами, поэтому время до следующего запроса сверяем с допуском
+			if diff := g[2].(int64) - w[2].(int64); diff > 50_000 || diff < -50_000 {
+				t.Errorf("%s call %d: redis reset %dus, fake %dus", tc.name, i, g[2], w[2])
+			}
+		}
+		// ключ живёт, пока TAT опережает время, и не дольше
+		ttl, err := server.Do("PTTL", key)
+		if err != nil {
+			t.Fatalf("%s: PTTL: %v", tc.name, err)
+		}
+		if ms := ttl.(int64); ms <= 0 || ms > (tc.tolerance+tc.interval)/1000 {
+			t.Errorf("%s: expected key TTL within tolerance, got %dms", tc.name, ms)
+		}
+		server.Do("DEL", key)
+	}
+}
+
+func TestRateLimiterStoreValidation(t *testing.T) {
+	cases := map[string]config.RateLimit{
+		"unknown type":          {Store: config.Store{Type: "memcached"}},
+		"redis without addr":    {Store: config.Store{Type: bucket.StoreRedis}},
+		"redis sliding log":     {Algorithm: bucket.AlgorithmSlidingLog, Store: config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{Addr: "127.0.0.1:6379"}}},
+		"gossip without addr":   {Store: config.Store{Type: bucket.StoreGossip, Gossip: config.GossipStore{Secret: "s"}}},
+		"gossip without secret": {Store: config.Store{Type: bucket.StoreGossip, Gossip: config.GossipStore{Listen: ":7946"}}},
+	}
+	for name, rl := range cases {
+		if err := bucket.Validate(&config.Config{RateLimit: rl}); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	gcra := config.RateLimit{Algorithm: bucket.AlgorithmGCRA, Store: config.Store{Type: bucket.StoreRedis, Redis: config.RedisStore{Addr: "127.0.0.1:6379"}}}
+	if err := bucket.Validate(&config.Config{RateLimit: gcra}); err != nil {
+		t.Errorf("Expected gcra with redis to be valid, got %v", err)
+	}
+}
+
+// freeAddr - свободный локальный адрес, чтобы заранее знать адреса всех реплик
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// postGossip - отправляет сообщение реплике с адресом addr, secret "" - без подписи
+func postGossip(t *testing.T, addr, body, secret string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/ratelimit/gossip", strings.NewReader(body))
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req.Header.Set("X-Gossip-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("gossip request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRateLimiterGossipStore(t *testing.T) {
+	addr1, addr2 := freeAddr(t), freeAddr(t)
+	gossip := func(listen, peer string) config.Store {
+		return config.Store{Type: bucket.StoreGossip, Gossip: config.GossipStore{
+			Listen: listen, Peers: []string{peer}, Interval: 20 * time.Millisecond, Secret: "shared",
+		}}
+	}
+	replica1 := newStoreManager(t, gossip(addr1, addr2))
+	replica2 := newStoreManager(t, gossip(addr2, addr1))
+
+	if allowed := countAllowed(5, "10.0.0.1", replica1); allowed != 5 {
+		t.Fatalf("Expected burst of 5 allowed on the first replica, got %d", allowed)
+	}
+	time.Sleep(200 * time.Millisecond) // несколько рассылок
+
+	if replica2.Allow(bucket.Client{IP: "10.0.0.1"}).Allowed {
+		t.Error("Expected the second replica to deny a client who used up the burst on the first one")
+	}
+	if !replica2.Allow(bucket.Client{IP: "10.0.0.2"}).Allowed {
+		t.Error("Expected other clients to be unaffected")
+	}
+
+	message := func(seq int, key string, allowed int) string {
+		return fmt.Sprintf(`{"from":"test","seq":%d,"sent_at":%d,"counts":[{"key":%q,"allowed":%d}]}`,
+			seq, time.Now().UnixNano(), key, allowed)
+	}
+
+	t.Run("unsigned messages are rejected", func(t *testing.T) {
+		if code := postGossip(t, addr1, message(1, "10.0.0.3", 100), ""); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for unsigned message, got %d", code)
+		}
+		if code := postGossip(t, addr1, message(1, "10.0.0.3", 100), "wrong"); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for message signed with another secret, got %d", code)
+		}
+		if !replica1.Allow(bucket.Client{IP: "10.0.0.3"}).Allowed {
+			t.Error("Expected unsigned message not to affect the limit")
+		}
+	})
+
+	t.Run("limit in message is ignored", func(t *testing.T) {
+		// прежний формат с лимитом в сообщении: нулевой лимит навсегда заблокировал бы клиента
+		body := fmt.Sprintf(`{"from":"forged","seq":1,"sent_at":%d,"counts":[{"key":"10.0.0.4","requests_per_sec":0,"burst":0,"algorithm":"sliding_log","allowed":1}]}`,
+			time.Now().UnixNano())
+		if code := postGossip(t, addr1, body, "shared"); code != http.StatusNoContent {
+			t.Fatalf("Expected 204 for signed message, got %d", code)
+		}
+		if allowed := countAllowed(10, "10.0.0.4", replica1); allowed != 4 {
+			t.Errorf("Expected 4 of 5 requests left under the replica's own limit, got %d", allowed)
+		}
+	})
+
+	t.Run("count is capped and unknown keys are dropped", func(t *testing.T) {
+		body := fmt.Sprintf(`{"from":"capped","seq":1,"sent_at":%d,"counts":[{"key":"10.0.0.5","allowed":1000000000},{"key":"gone\u0000route","allowed":5}]}`,
+			time.Now().UnixNano())
+		if code := postGossip(t, addr1, body, "shared"); code != http.StatusNoContent {
+			t.Fatalf("Expected 204 for signed message, got %d", code)
+		}
+		// не больше burst + rate*interval (5 + 1): клиент ждёт пару секунд, а не годы
+		d := replica1.Allow(bucket.Client{IP: "10.0.0.5"})
+		if d.Allowed || d.Reset > 3*time.Second {
+			t.Errorf("Expected capped debt repaid within 3s at 1 rps, got %+v", d)
+		}
+	})
+
+	t.Run("replayed messages are rejected", func(t *testing.T) {
+		body := message(1, "10.0.0.6", 1)
+		if code := postGossip(t, addr1, body, "shared"); code != http.StatusNoContent {
+			t.Fatalf("Expected 204 for the first message, got %d", code)
+		}
+		if code := postGossip(t, addr1, body, "shared"); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for the replayed message, got %d", code)
+		}
+		stale := fmt.Sprintf(`{"from":"stale","seq":1,"sent_at":%d,"counts":[{"key":"10.0.0.6","allowed":1}]}`,
+			time.Now().Add(-time.Minute).UnixNano())
+		if code := postGossip(t, addr1, stale, "shared"); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a stale message, got %d", code)
+		}
+		if allowed := countAllowed(10, "10.0.0.6", replica1); allowed != 4 {
+			t.Errorf("Expected only the first message to count, 4 of 5 requests left, got %d", allowed)
+		}
+	})
+}
+
+func TestRateLimiterGossipMaxBuckets(t *testing.T) {
+	addr := freeAddr(t)
+	cfg := &config.Config{RateLimit: config.RateLimit{
+		Enabled:         true,
+		CleanupInterval: 1 * time.Minute,
+		Default:         config.Limit{RequestsPerSec: 1, Burst: 5},
+		MaxBuckets:      3,
+		Store: config.Store{Type: bucket.StoreGossip, Gossip: config.GossipStore{
+			Listen: addr, Interval: 20 * time.Millisecond, Secret: "shared",
+		}},
+	}}
+	bm := bucket.NewBucketManager(cfg)
+	t.Cleanup(bm.Stop)
+
+	// реплика сообщает об исчерпанном burst у 10 клиентов, а бакетов можно завести только 3
+	counts := make([]string, 10)
+	for i := range counts {
+		counts[i] = fmt.Sprintf(`{"key":"10.0.2.%d","allowed":5}`, i)
+	}
+	body := fmt.Sprintf(`{"from":"peer","seq":1,"sent_at":%d,"counts":[%s]}`, time.Now().UnixNano(), strings.Join(counts, ","))
+	if code := postGossip(t, addr, body, "shared"); code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for signed message, got %d", code)
+	}
+
+	denied := 0
+	for i := range counts {
+		if !bm.Allow(bucket.Client{IP: fmt.Sprintf("10.0.2.%d", i)}).Allowed {
+			denied++
+		}
+	}
+	if denied != 3 {
+		t.Errorf("Expected gossip to create only max_buckets 3 buckets, %d clients were limited", denied)
+	}
+}
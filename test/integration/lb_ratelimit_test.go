@@ -2,6 +2,7 @@ package integration
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
 	"loadbalancer/internal/config"
 	"loadbalancer/internal/ratelimiter/bucket"
 	"loadbalancer/internal/ratelimiter/middleware"
@@ -35,31 +37,14 @@ func TestLoadBalancerWithRateLimiter(t *testing.T) {
 		Port:                     8080,
 		ServerShutdownTimeoutSec: 5 * time.Second,
 		LBMethod:                 "RR",
-		Backends: []string{
-			backend1.URL,
-			backend2.URL,
+		Backends: []config.Backend{
+			{URL: backend1.URL},
+			{URL: backend2.URL},
 		},
-		RateLimit: struct {
-			Enabled         bool          `yaml:"enabled"`
-			CleanupInterval time.Duration `yaml:"cleanup_interval"`
-			Default         struct {
-				RequestsPerSec int `yaml:"requests_per_sec"`
-				Burst          int `yaml:"burst"`
-			} `yaml:"default"`
-			SpecialLimits []struct {
-				IPs   []string `yaml:"ips"`
-				Limit struct {
-					RequestsPerSec int `yaml:"requests_per_sec"`
-					Burst          int `yaml:"burst"`
-				} `yaml:"limit"`
-			} `yaml:"special_limits"`
-		}{
+		RateLimit: config.RateLimit{
 			Enabled:         true,
 			CleanupInterval: 1 * time.Minute,
-			Default: struct {
-				RequestsPerSec int `yaml:"requests_per_sec"`
-				Burst          int `yaml:"burst"`
-			}{RequestsPerSec: 10, Burst: 20},
+			Default:         config.Limit{RequestsPerSec: 10, Burst: 20},
 		},
 	}
 
@@ -69,19 +54,15 @@ func TestLoadBalancerWithRateLimiter(t *testing.T) {
 	defer bm.Stop()
 
 	// 4. Создаем тестовый load balancer
-	lb := server.NewLoadBalancer(cfg.Port, backendPool)
-
-	// 5. Создаем тестовый HTTP сервер
-	type BalanceMethod func(w http.ResponseWriter, r *http.Request)
-	var balanceMethod BalanceMethod
-	if cfg.LBMethod == "RR" {
-		balanceMethod = lb.BalanceRequestRoundRobin
-	} else if cfg.LBMethod == "LC" {
-		balanceMethod = lb.BalanceRequestLeastConns
+	strategy, err := balancer.New(cfg.LBMethod, balancer.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create strategy: %v", err)
 	}
+	lb := server.NewLoadBalancer(cfg.Port, backendPool, strategy, nil)
 
+	// 5. Создаем тестовый HTTP сервер
 	testServer := httptest.NewServer(
-		middleware.RateLimitMiddleware(bm, http.HandlerFunc(balanceMethod)),
+		middleware.RateLimitMiddleware(bm, http.HandlerFunc(lb.BalanceRequest)),
 	)
 	defer testServer.Close()
 
@@ -176,13 +157,13 @@ func TestLoadBalancerWithRateLimiter(t *testing.T) {
 	// 8. Тестируем graceful shutdown
 	t.Run("Graceful shutdown", func(t *testing.T) {
 		// Создаем отдельный сервер для этого теста
-		lb := server.NewLoadBalancer(cfg.Port, backend.NewPool(cfg.Backends))
+		lb := server.NewLoadBalancer(cfg.Port, backend.NewPool(cfg.Backends), strategy, nil)
 		bm := bucket.NewBucketManager(cfg)
 		defer bm.Stop()
 
 		srv := &http.Server{
 			Addr:    ":" + strconv.Itoa(cfg.Port),
-			Handler: middleware.RateLimitMiddleware(bm, http.HandlerFunc(lb.BalanceRequestRoundRobin)),
+			Handler: middleware.RateLimitMiddleware(bm, http.HandlerFunc(lb.BalanceRequest)),
 		}
 
 		// Запускаем сервер в горутине
@@ -204,3 +185,130 @@ func TestLoadBalancerWithRateLimiter(t *testing.T) {
 		}
 	})
 }
+
+func TestRateLimiterCIDRLists(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 1 * time.Minute,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: 1},
+			Tiers: []config.Tier{
+				{Name: "office", IPs: []string{"10.0.0.0/8"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 3}},
+				{Name: "build", IPs: []string{"10.1.0.0/16"}, Limit: config.Limit{RequestsPerSec: 1, Burst: 5}},
+			},
+			Allowlist: []string{"192.0.2.0/24", "2001:db8::/32"},
+			Denylist:  []string{"198.51.100.0/24", "192.0.2.66"},
+		},
+	}
+	if err := bucket.Validate(cfg); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	bm := bucket.NewBucketManager(cfg)
+	defer bm.Stop()
+	handler := middleware.RateLimitMiddleware(bm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// count - сколько из n запросов с адреса получили каждый статус
+	count := func(ip string, n int) map[int]int {
+		codes := make(map[int]int)
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = net.JoinHostPort(ip, "12345")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			codes[rec.Code]++
+		}
+		return codes
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want map[int]int
+	}{
+		{"default", "203.0.113.1", map[int]int{200: 1, 429: 9}},
+		{"special /8", "10.2.3.4", map[int]int{200: 3, 429: 7}},
+		{"longest prefix /16", "10.1.2.3", map[int]int{200: 5, 429: 5}},
+		{"allowlist", "192.0.2.10", map[int]int{200: 10}},
+		{"allowlist IPv6", "2001:db8::5", map[int]int{200: 10}},
+		{"denylist", "198.51.100.9", map[int]int{403: 10}},
+		{"denylist wins over allowlist", "192.0.2.66", map[int]int{403: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := count(tt.ip, 10)
+			for code, n := range tt.want {
+				if got[code] != n {
+					t.Errorf("Expected %d responses with %d, got %v", n, code, got)
+				}
+			}
+		})
+	}
+
+	cfg.RateLimit.Denylist = []string{"not-an-ip"}
+	if err := bucket.Validate(cfg); err == nil {
+		t.Error("Expected error for invalid denylist entry")
+	}
+}
+
+func TestRateLimiterHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	newHandler := func(t *testing.T, enabled bool) http.Handler {
+		cfg := &config.Config{RateLimit: config.RateLimit{
+			Enabled:         enabled,
+			CleanupInterval: 1 * time.Minute,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: 2},
+		}}
+		bm := bucket.NewBucketManager(cfg)
+		t.Cleanup(bm.Stop)
+		return middleware.RateLimitMiddleware(bm, ok)
+	}
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("remaining budget on every response", func(t *testing.T) {
+		handler := newHandler(t, true)
+		for i, want := range []struct {
+			code      int
+			remaining string
+		}{{http.StatusOK, "1"}, {http.StatusOK, "0"}, {http.StatusTooManyRequests, "0"}} {
+			rec := serve(handler)
+			if rec.Code != want.code {
+				t.Fatalf("request %d: expected %d, got %d", i+1, want.code, rec.Code)
+			}
+			h := rec.Header()
+			if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != want.remaining || h.Get("RateLimit-Reset") != "1" {
+				t.Errorf("request %d: unexpected headers limit=%q remaining=%q reset=%q", i+1,
+					h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), h.Get("RateLimit-Reset"))
+			}
+			if retry := h.Get("Retry-After"); (want.code == http.StatusTooManyRequests) != (retry == "1") {
+				t.Errorf("request %d: unexpected Retry-After %q", i+1, retry)
+			}
+		}
+	})
+
+	t.Run("no headers when limiter is disabled", func(t *testing.T) {
+		rec := serve(newHandler(t, false))
+		if rec.Header().Get("RateLimit-Limit") != "" || rec.Header().Get("Retry-After") != "" {
+			t.Errorf("Expected no rate limit headers, got %v", rec.Header())
+		}
+	})
+
+	t.Run("stricter limit wins", func(t *testing.T) {
+		h := http.Header{}
+		bucket.Decision{Allowed: true, Limit: 100, Remaining: 50, Reset: time.Second}.SetHeaders(h)
+		bucket.Decision{Allowed: true, Limit: 5, Remaining: 2, Reset: 3 * time.Second}.SetHeaders(h)
+		bucket.Decision{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}.SetHeaders(h)
+		if h.Get("RateLimit-Limit") != "5" || h.Get("RateLimit-Remaining") != "2" || h.Get("RateLimit-Reset") != "3" {
+			t.Errorf("Expected headers of the stricter limit, got %v", h)
+		}
+		bucket.Decision{Allowed: false, Limit: 10, Remaining: 0, Reset: 1500 * time.Millisecond}.SetHeaders(h)
+		if h.Get("RateLimit-Limit") != "10" || h.Get("Retry-After") != "2" {
+			t.Errorf("Expected headers of the denying limit with Retry-After rounded up, got %v", h)
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package integration
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+	"loadbalancer/internal/ratelimiter/middleware"
+	"loadbalancer/internal/server"
+)
+
+// reloadFixture - балансировщик с основным пулом, ограничителем и функцией отправки запроса
+type reloadFixture struct {
+	lb      *server.LoadBalancer
+	pool    *backend.Pool
+	handler http.Handler
+}
+
+func newReloadFixture(t *testing.T, cfg *config.Config) *reloadFixture {
+	t.Helper()
+	strategy, err := balancer.New(cfg.LBMethod, balancer.Options{Hash: cfg.Hash})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	pool := backend.NewPool(cfg.Backends)
+	lb := server.NewLoadBalancer(8080, pool, strategy, nil)
+	if err := lb.ConfigureRoutes(cfg); err != nil {
+		t.Fatalf("ConfigureRoutes failed: %v", err)
+	}
+	bm := bucket.NewBucketManager(cfg)
+	t.Cleanup(bm.Stop)
+	lb.SetBucketManager(bm)
+	return &reloadFixture{lb: lb, pool: pool, handler: middleware.RateLimitMiddleware(bm, http.HandlerFunc(lb.BalanceRequest))}
+}
+
+// send - запрос от одного клиента, возвращает код и имя ответившего сервера
+func (f *reloadFixture) send() (int, string) {
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code, rec.Header().Get("X-Backend")
+}
+
+// namedBackends - сервера, которые отвечают своим именем в X-Backend
+func namedBackends(t *testing.T, names ...string) []config.Backend {
+	t.Helper()
+	backends := make([]config.Backend, len(names))
+	for i, name := range names {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Backend", name)
+		}))
+		t.Cleanup(srv.Close)
+		backends[i] = config.Backend{URL: srv.URL}
+	}
+	return backends
+}
+
+func reloadConfig(backends []config.Backend, burst int) *config.Config {
+	return &config.Config{
+		LBMethod: "RR",
+		Backends: backends,
+		RateLimit: config.RateLimit{
+			Enabled:         true,
+			CleanupInterval: 1 * time.Minute,
+			Default:         config.Limit{RequestsPerSec: 1, Burst: burst},
+		},
+	}
+}
+
+func TestReloadKeepsStrategyState(t *testing.T) {
+	backends := namedBackends(t, "a", "b", "c")
+	f := newReloadFixture(t, reloadConfig(backends, 100))
+
+	seen := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		_, name := f.send()
+		seen[name]++
+	}
+	// та же очередь RR продолжается после перезагрузки с неизменным lb_method
+	if err := f.lb.Reload(reloadConfig(backends, 100)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	_, name := f.send()
+	seen[name]++
+	if len(seen) != 3 {
+		t.Errorf("Expected RR to continue over 3 backends after reload, got %v", seen)
+	}
+}
+
+func TestReloadKeepsRateLimitState(t *testing.T) {
+	backends := namedBackends(t, "a")
+	f := newReloadFixture(t, reloadConfig(backends, 2))
+	for i := 0; i < 2; i++ {
+		f.send()
+	}
+
+	// лимит не изменился - бакет клиента сохранил потраченные токены
+	if err := f.lb.Reload(reloadConfig(backends, 2)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if code, _ := f.send(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected exhausted bucket to survive reload with the same limit, got %d", code)
+	}
+
+	// лимит изменился - бакет создаётся заново
+	if err := f.lb.Reload(reloadConfig(backends, 3)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if code, _ := f.send(); code != http.StatusOK {
+		t.Errorf("Expected new bucket after limit change, got %d", code)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	backends := namedBackends(t, "a", "b")
+	f := newReloadFixture(t, reloadConfig(backends, 3))
+	_, first := f.send()
+
+	invalid := map[string]func(cfg *config.Config){
+		"unknown lb_method": func(cfg *config.Config) { cfg.LBMethod = "NOPE" },
+		"bad backend url":   func(cfg *config.Config) { cfg.Backends = []config.Backend{{URL: "127.0.0.1:8001"}} },
+		"duplicate backend": func(cfg *config.Config) { cfg.Backends = append(cfg.Backends, cfg.Backends[0]) },
+		"bad route":         func(cfg *config.Config) { cfg.Routes = []config.Route{{Name: "r", PathRegex: "("}} },
+		"bad rate limit key": func(cfg *config.Config) {
+			cfg.RateLimit.Key = "unknown"
+			cfg.RateLimit.Default.Burst = 100
+		},
+		"new upstream": func(cfg *config.Config) { cfg.Upstreams = []config.Upstream{{Name: "extra", Backends: backends}} },
+	}
+	for name, mutate := range invalid {
+		cfg := reloadConfig(backends, 3)
+		mutate(cfg)
+		if err := f.lb.Reload(cfg); err == nil {
+			t.Errorf("%s: expected reload to be rejected", name)
+		}
+	}
+
+	// старый конфиг в силе: оба сервера в пуле, очередь RR не сброшена, лимит прежний (burst 3)
+	if n := len(f.pool.Backends()); n != 2 {
+		t.Errorf("Expected 2 backends after rejected reloads, got %d", n)
+	}
+	code, second := f.send()
+	if code != http.StatusOK || second == first {
+		t.Errorf("Expected RR to continue to the other backend, got %d from %s after %s", code, second, first)
+	}
+	f.send()
+	if code, _ := f.send(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected old limit of 3 requests to stay in force, got %d", code)
+	}
+}
+
+func TestReloadKeepsAdminBackends(t *testing.T) {
+	backends := namedBackends(t, "a", "b")
+	f := newReloadFixture(t, reloadConfig(backends[:1], 100))
+	if _, err := f.pool.AddBackend(backends[1]); err != nil {
+		t.Fatalf("AddBackend failed: %v", err)
+	}
+
+	// сервер из API не пропадает при перезагрузке конфига без него
+	if err := f.lb.Reload(reloadConfig(backends[:1], 100)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if f.pool.Find(backends[1].URL) == nil {
+		t.Fatal("Expected backend added via admin API to survive reload")
+	}
+
+	// адрес попал в конфиг - дальше им управляет конфиг и удаляет вместе с ним
+	if err := f.lb.Reload(reloadConfig(backends, 100)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := f.lb.Reload(reloadConfig(backends[:1], 100)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if f.pool.Find(backends[1].URL) != nil {
+		t.Error("Expected backend managed by config to be removed with it")
+	}
+}
+
+// routingFixture - балансировщик с основным пулом и upstreams из конфига
+type routingFixture struct {
+	lb *server.LoadBalancer
+}
+
+func newRoutingFixture(t *testing.T, cfg *config.Config) *routingFixture {
+	t.Helper()
+	strategy, err := balancer.New(cfg.LBMethod, balancer.Options{Hash: cfg.Hash})
+	if err != nil {
+		t.Fatalf("balancer.New failed: %v", err)
+	}
+	lb := server.NewLoadBalancer(8080, backend.NewPool(cfg.Backends), strategy, nil)
+	for _, up := range cfg.Upstreams {
+		lb.AddUpstream(up.Name, backend.NewPool(up.Backends))
+	}
+	if err := lb.ConfigureRoutes(cfg); err != nil {
+		t.Fatalf("ConfigureRoutes failed: %v", err)
+	}
+	return &routingFixture{lb: lb}
+}
+
+// send - имя сервера, ответившего на GET path с заголовком Host host
+func (f *routingFixture) send(host, path string) string {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	f.lb.BalanceRequest(rec, req)
+	return rec.Header().Get("X-Backend")
+}
+
+func TestReloadRouteTable(t *testing.T) {
+	backends := namedBackends(t, "main", "a", "b")
+	routesConfig := func(routes ...config.Route) *config.Config {
+		return &config.Config{
+			LBMethod: "RR",
+			Backends: backends[:1],
+			Upstreams: []config.Upstream{
+				{Name: "a", Backends: backends[1:2]},
+				{Name: "b", Backends: backends[2:3]},
+			},
+			Routes: routes,
+		}
+	}
+	f := newRoutingFixture(t, routesConfig(config.Route{Name: "api", PathPrefix: "/api", Upstream: "a"}))
+	if got := f.send("", "/api/users"); got != "a" {
+		t.Fatalf("Expected /api to go to upstream a, got %s", got)
+	}
+
+	// маршрут переехал на другой пул, добавился маршрут по хосту
+	if err := f.lb.Reload(routesConfig(
+		config.Route{Name: "api", PathPrefix: "/api", Upstream: "b"},
+		config.Route{Name: "shop", Host: "shop.example.com", Upstream: "a"},
+	)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	for _, tc := range []struct{ host, path, want string }{
+		{"", "/api/users", "b"},
+		{"shop.example.com", "/", "a"},
+		{"other.example.com", "/", "main"},
+	} {
+		if got := f.send(tc.host, tc.path); got != tc.want {
+			t.Errorf("After reload %s%s: expected %s, got %s", tc.host, tc.path, tc.want, got)
+		}
+	}
+
+	// маршруты удалены - всё уходит в основной пул
+	if err := f.lb.Reload(routesConfig()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := f.send("shop.example.com", "/api/users"); got != "main" {
+		t.Errorf("Expected requests to fall back to the main pool without routes, got %s", got)
+	}
+}
+
+func TestReloadRejectsUpstreamChanges(t *testing.T) {
+	backends := namedBackends(t, "main", "a", "b")
+	cfg := &config.Config{
+		LBMethod: "RR",
+		Backends: backends[:1],
+		Upstreams: []config.Upstream{
+			{Name: "a", Backends: backends[1:2]},
+			{Name: "b", Backends: backends[2:3]},
+		},
+		Routes: []config.Route{{Name: "api", PathPrefix: "/api", Upstream: "a"}},
+	}
+	f := newRoutingFixture(t, cfg)
+
+	changes := map[string][]config.Upstream{
+		"added":   append(slices.Clone(cfg.Upstreams), config.Upstream{Name: "c", Backends: backends[:1]}),
+		"removed": cfg.Upstreams[:1],
+		"renamed": {cfg.Upstreams[0], {Name: "c", Backends: backends[2:3]}},
+	}
+	for name, upstreams := range changes {
+		next := *cfg
+		next.Upstreams = upstreams
+		next.Routes = []config.Route{{Name: "api", PathPrefix: "/api", Upstream: "b"}}
+		if err := f.lb.Reload(&next); err == nil || !strings.Contains(err.Error(), "requires a restart") {
+			t.Errorf("%s upstream: expected reload to be rejected with a restart hint, got %v", name, err)
+		}
+	}
+	// ни один из отклонённых конфигов не применился частично
+	if got := f.send("", "/api/users"); got != "a" {
+		t.Errorf("Expected the old route table to stay in force, got %s", got)
+	}
+}
+
+func TestReloadValidatesAllPoolsFirst(t *testing.T) {
+	backends := namedBackends(t, "main", "a", "other")
+	cfg := &config.Config{
+		LBMethod:  "RR",
+		Backends:  backends[:1],
+		Upstreams: []config.Upstream{{Name: "a", Backends: backends[1:2]}},
+		Routes:    []config.Route{{Name: "api", PathPrefix: "/api", Upstream: "a"}},
+	}
+	f := newRoutingFixture(t, cfg)
+
+	// основной пул меняется корректно, а в upstream - сервер без схемы
+	next := *cfg
+	next.Backends = backends[2:3]
+	next.Upstreams = []config.Upstream{{Name: "a", Backends: []config.Backend{{URL: "127.0.0.1:8001"}}}}
+	if err := f.lb.Reload(&next); err == nil {
+		t.Fatal("Expected reload with an invalid upstream backend to be rejected")
+	}
+	if got := f.send("", "/"); got != "main" {
+		t.Errorf("Expected the main pool to keep its backends after a rejected reload, got %s", got)
+	}
+	if got := f.send("", "/api"); got != "a" {
+		t.Errorf("Expected upstream a to keep its backends after a rejected reload, got %s", got)
+	}
+}
+
+func TestReloadWarnsAboutRestartOnlySections(t *testing.T) {
+	backends := namedBackends(t, "main", "a")
+	cfg := &config.Config{
+		LBMethod:  "RR",
+		Backends:  backends[:1],
+		Upstreams: []config.Upstream{{Name: "a", Backends: backends[1:2]}},
+	}
+	f := newRoutingFixture(t, cfg)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if err := f.lb.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if strings.Contains(logs.String(), "WARN") {
+		t.Errorf("Expected no warnings for an unchanged config, got %s", logs.String())
+	}
+
+	next := *cfg
+	next.OutlierDetection = config.OutlierDetection{Enabled: true}
+	next.CircuitBreaker = config.CircuitBreaker{Enabled: true}
+	next.HealthCheck = config.HealthCheck{Path: "/ready"}
+	next.UpstreamTLS = config.UpstreamTLS{InsecureSkipVerify: true}
+	next.Upstreams = []config.Upstream{{Name: "a", Backends: backends[1:2], HealthCheck: &config.HealthCheck{Path: "/ping"}}}
+	if err := f.lb.Reload(&next); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	want := "WARN: outlier_detection, circuit_breaker, health_check, upstream_tls, upstreams.a.health_check changes require a restart"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("Expected warning %q, got %s", want, logs.String())
+	}
+}
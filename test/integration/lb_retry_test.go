@@ -0,0 +1,91 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+func TestLoadBalancerRetry(t *testing.T) {
+	// 1. Один бэкенд отвечает 503, второй выключен, третий живой и возвращает тело запроса
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close() // connection refused
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Backend", "healthy")
+		w.Write(body)
+	}))
+	defer healthy.Close()
+
+	pool := backend.NewPool([]config.Backend{{URL: failing.URL}, {URL: down.URL}, {URL: healthy.URL}})
+
+	newServer := func(t *testing.T, retryConf config.Retry) *httptest.Server {
+		strategy, err := balancer.New("RR", balancer.Options{})
+		if err != nil {
+			t.Fatalf("Failed to create strategy: %v", err)
+		}
+		policy, err := server.NewRetryPolicy(retryConf)
+		if err != nil {
+			t.Fatalf("Failed to create retry policy: %v", err)
+		}
+		lb := server.NewLoadBalancer(8080, pool, strategy, policy)
+		return httptest.NewServer(http.HandlerFunc(lb.BalanceRequest))
+	}
+
+	// 2. Идемпотентный запрос с телом доходит до живого сервера с любого стартового бэкенда
+	t.Run("Failover to healthy backend", func(t *testing.T) {
+		srv := newServer(t, config.Retry{MaxAttempts: 3, RetryOnStatus: []int{http.StatusServiceUnavailable}})
+		defer srv.Close()
+
+		for i := 0; i < 6; i++ {
+			req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Backend") != "healthy" {
+				t.Fatalf("Expected response from healthy backend, got %d %q", resp.StatusCode, resp.Header.Get("X-Backend"))
+			}
+			if string(body) != "payload" {
+				t.Errorf("Expected replayed body %q, got %q", "payload", body)
+			}
+		}
+	})
+
+	// 3. POST по умолчанию не повторяется - часть запросов получает ошибку бэкенда
+	t.Run("Non-idempotent request is not retried", func(t *testing.T) {
+		srv := newServer(t, config.Retry{MaxAttempts: 3, RetryOnStatus: []int{http.StatusServiceUnavailable}})
+		defer srv.Close()
+
+		failed := 0
+		for i := 0; i < 3; i++ {
+			resp, err := http.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				failed++
+			}
+		}
+		if failed != 2 {
+			t.Errorf("Expected 2 failed POST requests without retries, got %d", failed)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+	"loadbalancer/internal/server"
+)
+
+func TestLoadBalancerRouting(t *testing.T) {
+	// 1. Два сервиса, каждый отвечает своим именем и путём, который до него дошёл
+	newService := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Service", name)
+			io.WriteString(w, r.URL.Path)
+		}))
+	}
+	api, web := newService("api"), newService("web")
+	defer api.Close()
+	defer web.Close()
+
+	cfg := &config.Config{
+		LBMethod: "RR",
+		Upstreams: []config.Upstream{
+			{Name: "api", LBMethod: "LC", Backends: []config.Backend{{URL: api.URL}}},
+			{Name: "web", Backends: []config.Backend{{URL: web.URL}}},
+		},
+		Routes: []config.Route{
+			{Name: "canary", PathPrefix: "/api/", Headers: map[string]string{"X-Canary": "1"}, Upstream: "web"},
+			{Name: "api", Host: "*.example.com", PathPrefix: "/api/", StripPrefix: true, Upstream: "api",
+				RateLimit: &config.Limit{RequestsPerSec: 1, Burst: 2}},
+			{Name: "legacy", PathRegex: `^/v1/users/(\d+)$`, Rewrite: "/users/$1", Methods: []string{"GET"}, Upstream: "api"},
+			{Name: "web", Host: "www.example.com", Upstream: "web"},
+		},
+		RateLimit: config.RateLimit{Enabled: true, CleanupInterval: 60, Default: config.Limit{RequestsPerSec: 100, Burst: 100}},
+	}
+
+	strategy, _ := balancer.New(cfg.LBMethod, balancer.Options{})
+	lb := server.NewLoadBalancer(8080, backend.NewPool(nil), strategy, nil)
+	for _, up := range cfg.Upstreams {
+		lb.AddUpstream(up.Name, backend.NewPool(up.Backends))
+	}
+	if err := lb.ConfigureRoutes(cfg); err != nil {
+		t.Fatalf("Failed to configure routes: %v", err)
+	}
+	bm := bucket.NewBucketManager(cfg)
+	defer bm.Stop()
+	lb.SetBucketManager(bm)
+
+	srv := httptest.NewServer(http.HandlerFunc(lb.BalanceRequest))
+	defer srv.Close()
+
+	do := func(method, host, path string, header map[string]string) (int, string, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Host = host
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("X-Service"), string(body)
+	}
+
+	// 2. Маршруты выбираются по хосту, пути, методу и заголовкам, путь переписывается
+	tests := []struct {
+		name, method, host, path string
+		header                   map[string]string
+		code                     int
+		service, gotPath         string
+	}{
+		{"Host and prefix with strip", "GET", "shop.example.com", "/api/orders", nil, 200, "api", "/orders"},
+		{"Header match wins by order", "GET", "shop.example.com", "/api/orders", map[string]string{"X-Canary": "1"}, 200, "web", "/api/orders"},
+		{"Regex rewrite", "GET", "any.host", "/v1/users/42", nil, 200, "api", "/users/42"},
+		{"Method mismatch", "POST", "any.host", "/v1/users/42", nil, 404, "", ""},
+		{"Exact host", "GET", "www.example.com:8080", "/index.html", nil, 200, "web", "/index.html"},
+		{"No route and empty default pool", "GET", "other.org", "/", nil, 404, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, service, gotPath := do(tt.method, tt.host, tt.path, tt.header)
+			if code != tt.code || service != tt.service || (tt.gotPath != "" && gotPath != tt.gotPath) {
+				t.Errorf("Expected %d from %q with path %q, got %d from %q with path %q",
+					tt.code, tt.service, tt.gotPath, code, service, gotPath)
+			}
+		})
+	}
+
+	// 3. Свой лимит маршрута: burst 2, дальше 429 (общий лимит при этом не исчерпан)
+	t.Run("Route rate limit", func(t *testing.T) {
+		time.Sleep(time.Second) // бакет маршрута мог потратить токены в проверках выше
+		codes := make([]int, 0, 4)
+		for i := 0; i < 4; i++ {
+			code, _, _ := do("GET", "shop.example.com", "/api/orders", nil)
+			codes = append(codes, code)
+		}
+		if codes[0] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+			t.Errorf("Expected first request allowed and last limited, got %v", codes)
+		}
+		if code, _, _ := do("GET", "www.example.com", "/", nil); code != http.StatusOK {
+			t.Errorf("Expected other routes not to be limited, got %d", code)
+		}
+	})
+}
+
+func TestRoutingPathPrefixBoundary(t *testing.T) {
+	backends := namedBackends(t, "main", "api")
+	cfg := &config.Config{
+		LBMethod:  "RR",
+		Backends:  backends[:1],
+		Upstreams: []config.Upstream{{Name: "api", Backends: backends[1:]}},
+		Routes: []config.Route{
+			{Name: "api", PathPrefix: "/api", StripPrefix: true, Upstream: "api"},
+		},
+	}
+	f := newRoutingFixture(t, cfg)
+
+	// /api - это сам /api и всё под /api/, но не /apiary и не /api-docs
+	tests := map[string]string{
+		"/api":       "api",
+		"/api/":      "api",
+		"/api/users": "api",
+		"/apiary":    "main",
+		"/api-docs":  "main",
+		"/":          "main",
+	}
+	for path, want := range tests {
+		if got := f.send("", path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
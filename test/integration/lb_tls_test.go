@@ -0,0 +1,224 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+	"loadbalancer/internal/tlsutil"
+)
+
+// writeCert - самоподписанный сертификат на имена names, записанный в dir/file.crt и dir/file.key
+func writeCert(t *testing.T, dir, file string, names ...string) config.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	cert := config.Certificate{CertFile: filepath.Join(dir, file+".crt"), KeyFile: filepath.Join(dir, file+".key")}
+	if err := os.WriteFile(cert.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(cert.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return cert
+}
+
+// servedName - имя из сертификата, который сервер отдал клиенту с SNI serverName
+func servedName(t *testing.T, addr, serverName string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Handshake with SNI %q failed: %v", serverName, err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// newTLSServer - https-сервер с сертификатами из store, возвращает его адрес.
+// Не httptest: тот подставляет свой сертификат клиентам без SNI
+func newTLSServer(t *testing.T, store *tlsutil.CertStore) string {
+	t.Helper()
+	tlsConfig, err := tlsutil.ServerConfig(config.TLS{}, store)
+	if err != nil {
+		t.Fatalf("ServerConfig failed: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: tlsConfig,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestTLSCertificateBySNI(t *testing.T) {
+	dir := t.TempDir()
+	certs := []config.Certificate{
+		writeCert(t, dir, "default", "example.com"),
+		writeCert(t, dir, "api", "api.example.org"),
+		writeCert(t, dir, "wildcard", "*.apps.example.org"),
+	}
+	store, err := tlsutil.NewCertStore(certs)
+	if err != nil {
+		t.Fatalf("NewCertStore failed: %v", err)
+	}
+	addr := newTLSServer(t, store)
+
+	cases := map[string]string{
+		"api.example.org":      "api.example.org",
+		"API.Example.org":      "api.example.org",
+		"one.apps.example.org": "*.apps.example.org",
+		"a.b.apps.example.org": "example.com", // шаблон покрывает только один уровень
+		"unknown.example.net":  "example.com",
+		"":                     "example.com", // клиент без SNI
+		"example.com":          "example.com",
+	}
+	for sni, want := range cases {
+		if got := servedName(t, addr, sni); got != want {
+			t.Errorf("SNI %q: expected certificate %q, got %q", sni, want, got)
+		}
+	}
+}
+
+func TestTLSCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeCert(t, dir, "site", "old.example.com")
+	store, err := tlsutil.NewCertStore([]config.Certificate{cert})
+	if err != nil {
+		t.Fatalf("NewCertStore failed: %v", err)
+	}
+	addr := newTLSServer(t, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	// время изменения сдвигается вперёд, чтобы перезапись не попала в ту же отметку времени файловой системы
+	touch := func(paths ...string) {
+		future := time.Now().Add(time.Minute)
+		for _, path := range paths {
+			if err := os.Chtimes(path, future, future); err != nil {
+				t.Fatalf("Chtimes failed: %v", err)
+			}
+		}
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for servedName(t, addr, "") != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected certificate %q to be served after reload", want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	writeCert(t, dir, "site", "new.example.com")
+	touch(cert.CertFile, cert.KeyFile)
+	waitFor("new.example.com")
+
+	// ключ не от этого сертификата - перезагрузка не удаётся, остаётся прежний
+	other := writeCert(t, dir, "other", "other.example.com")
+	data, err := os.ReadFile(other.CertFile)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if err := os.WriteFile(cert.CertFile, data, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	touch(cert.CertFile)
+	time.Sleep(100 * time.Millisecond)
+	if got := servedName(t, addr, ""); got != "new.example.com" {
+		t.Errorf("Expected broken files to keep the current certificate, got %q", got)
+	}
+}
+
+func TestTLSRejectsInsecureCipherSuites(t *testing.T) {
+	for _, suite := range tls.InsecureCipherSuites() {
+		if _, err := tlsutil.ParseCipherSuites([]string{suite.Name}); err == nil {
+			t.Errorf("Expected insecure cipher suite %s to be rejected", suite.Name)
+		}
+	}
+	if _, err := tlsutil.ParseCipherSuites([]string{"TLS_NOT_A_SUITE"}); err == nil {
+		t.Error("Expected unknown cipher suite to be rejected")
+	}
+	ids, err := tlsutil.ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Expected secure cipher suite to be accepted, got %v, %v", ids, err)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	redirects := []struct {
+		port           int
+		host, target   string
+		location, desc string
+	}{
+		{8443, "example.com:8080", "/path?q=1", "https://example.com:8443/path?q=1", "custom port"},
+		{443, "example.com", "/path", "https://example.com/path", "default port"},
+		{443, "[::1]:8080", "/", "https://[::1]/", "ipv6 host"},
+		{8443, "example.com", "/healthz", "https://example.com:8443/healthz", "not the health path"},
+	}
+	for _, tc := range redirects {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tc.target, nil)
+		req.Host = tc.host
+		server.RedirectToHTTPS(tc.port, next).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s: expected 308 to %s, got %d to %s", tc.desc, tc.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	// проверки здоровья и ACME HTTP-01 обслуживаются по http
+	for _, path := range []string{"/health", "/.well-known/acme-challenge/token123"} {
+		rec := httptest.NewRecorder()
+		server.RedirectToHTTPS(8443, next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("%s: expected request to reach the handler, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+	"loadbalancer/internal/tracing"
+)
+
+const (
+	remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpanID  = "00f067aa0ba902b7"
+)
+
+// exportedSpan - поля спана из запроса OTLP/HTTP JSON, которые проверяют тесты
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+// collector - коллектор OTLP, который запоминает полученные спаны
+type collector struct {
+	srv   *httptest.Server
+	mux   sync.Mutex
+	spans []exportedSpan
+}
+
+func newCollector(t *testing.T, handle func()) *collector {
+	t.Helper()
+	c := &collector{}
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil {
+			handle()
+		}
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Collector got invalid OTLP JSON: %v", err)
+		}
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				c.spans = append(c.spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(c.srv.Close)
+	return c
+}
+
+func (c *collector) received() []exportedSpan {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]exportedSpan(nil), c.spans...)
+}
+
+// tracedLB - балансировщик с трассировкой поверх сервера, который запоминает заголовки трассировки
+type tracedLB struct {
+	tracer  *tracing.Tracer
+	handler http.Handler
+
+	mux     sync.Mutex
+	headers []http.Header // заголовки, с которыми запросы пришли на бэкенд
+}
+
+func newTracedLB(t *testing.T, conf config.Tracing) *tracedLB {
+	t.Helper()
+	tl := &tracedLB{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tl.mux.Lock()
+		tl.headers = append(tl.headers, r.Header.Clone())
+		tl.mux.Unlock()
+	}))
+	t.Cleanup(upstream.Close)
+
+	tracer, err := tracing.New(conf)
+	if err != nil {
+		t.Fatalf("tracing.New failed: %v", err)
+	}
+	tl.tracer = tracer
+	strategy, _ := balancer.New("RR", balancer.Options{})
+	lb := server.NewLoadBalancer(8080, backend.NewPool([]config.Backend{{URL: upstream.URL}}), strategy, nil)
+	tl.handler = tracer.Middleware(http.HandlerFunc(lb.BalanceRequest))
+	return tl
+}
+
+// send - запрос с заголовками трассировки, возвращает заголовки, с которыми он дошёл до бэкенда
+func (tl *tracedLB) send(t *testing.T, traceparent, tracestate string) http.Header {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if traceparent != "" {
+		req.Header.Set("Traceparent", traceparent)
+	}
+	if tracestate != "" {
+		req.Header.Set("Tracestate", tracestate)
+	}
+	tl.handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tl.mux.Lock()
+	defer tl.mux.Unlock()
+	if len(tl.headers) == 0 {
+		t.Fatal("Expected request to reach the backend")
+	}
+	return tl.headers[len(tl.headers)-1]
+}
+
+func (tl *tracedLB) shutdown(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tl.tracer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
+
+func TestTracingPropagation(t *testing.T) {
+	c := newCollector(t, nil)
+	tl := newTracedLB(t, config.Tracing{CollectorURL: c.srv.URL})
+
+	header := tl.send(t, "00-"+remoteTraceID+"-"+remoteSpanID+"-01", "vendor=value")
+	parts := strings.Split(header.Get("Traceparent"), "-")
+	if len(parts) != 4 || parts[0] != "00" || parts[1] != remoteTraceID || parts[3] != "01" {
+		t.Fatalf("Expected traceparent to continue trace %s, got %q", remoteTraceID, header.Get("Traceparent"))
+	}
+	if parts[2] == remoteSpanID {
+		t.Error("Expected the balancer to send its own span id to the backend")
+	}
+	if header.Get("Tracestate") != "vendor=value" {
+		t.Errorf("Expected tracestate of continued trace to be passed through, got %q", header.Get("Tracestate"))
+	}
+
+	tl.shutdown(t)
+	spans := make(map[string]exportedSpan)
+	for _, span := range c.received() {
+		if span.TraceID != remoteTraceID {
+			t.Errorf("Span %s: expected trace %s, got %s", span.Name, remoteTraceID, span.TraceID)
+		}
+		spans[span.Name] = span
+	}
+	root, upstream := spans["lb.request"], spans["upstream"]
+	if root.ParentSpanID != remoteSpanID {
+		t.Errorf("Expected root span parent %s, got %q", remoteSpanID, root.ParentSpanID)
+	}
+	if upstream.ParentSpanID != root.SpanID || upstream.SpanID != parts[2] {
+		t.Errorf("Expected backend to see upstream span %s (child of root %s), got span %s with parent %s",
+			parts[2], root.SpanID, upstream.SpanID, upstream.ParentSpanID)
+	}
+}
+
+func TestTracingMalformedTraceparent(t *testing.T) {
+	c := newCollector(t, nil)
+	tl := newTracedLB(t, config.Tracing{CollectorURL: c.srv.URL})
+	defer tl.shutdown(t)
+
+	malformed := map[string]string{
+		"too few parts":     "00-" + remoteTraceID + "-" + remoteSpanID,
+		"short trace id":    "00-4bf92f35-" + remoteSpanID + "-01",
+		"not hex":           "00-" + strings.Repeat("z", 32) + "-" + remoteSpanID + "-01",
+		"zero trace id":     "00-" + strings.Repeat("0", 32) + "-" + remoteSpanID + "-01",
+		"zero span id":      "00-" + remoteTraceID + "-" + strings.Repeat("0", 16) + "-01",
+		"forbidden version": "ff-" + remoteTraceID + "-" + remoteSpanID + "-01",
+		"extra part for 00": "00-" + remoteTraceID + "-" + remoteSpanID + "-01-extra",
+		"bad flags":         "00-" + remoteTraceID + "-" + remoteSpanID + "-0x",
+		"garbage":           "not a traceparent",
+	}
+	for name, value := range malformed {
+		header := tl.send(t, value, "vendor=value")
+		parts := strings.Split(header.Get("Traceparent"), "-")
+		if len(parts) != 4 || parts[1] == remoteTraceID || parts[3] != "01" {
+			t.Errorf("%s: expected a new sampled trace, got %q", name, header.Get("Traceparent"))
+		}
+		// tracestate чужой трассировки к новой не относится
+		if header.Get("Tracestate") != "" {
+			t.Errorf("%s: expected tracestate to be dropped, got %q", name, header.Get("Tracestate"))
+		}
+	}
+
+	// будущая версия формата с дополнительными полями принимается
+	header := tl.send(t, "01-"+remoteTraceID+"-"+remoteSpanID+"-01-future", "")
+	if !strings.Contains(header.Get("Traceparent"), remoteTraceID) {
+		t.Errorf("Expected higher version traceparent to be continued, got %q", header.Get("Traceparent"))
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	c := newCollector(t, nil)
+	tl := newTracedLB(t, config.Tracing{CollectorURL: c.srv.URL})
+
+	header := tl.send(t, "00-"+remoteTraceID+"-"+remoteSpanID+"-00", "")
+	if parts := strings.Split(header.Get("Traceparent"), "-"); len(parts) != 4 || parts[3] != "00" {
+		t.Errorf("Expected sampled flag 00 to be propagated, got %q", header.Get("Traceparent"))
+	}
+	tl.shutdown(t)
+	if spans := c.received(); len(spans) != 0 {
+		t.Errorf("Expected no spans exported for an unsampled trace, got %d", len(spans))
+	}
+}
+
+func TestTracingDropsSpansWhenQueueIsFull(t *testing.T) {
+	// коллектор не отвечает, пока тест его не отпустит
+	release := make(chan struct{})
+	c := newCollector(t, func() { <-release })
+	tl := newTracedLB(t, config.Tracing{CollectorURL: c.srv.URL, BatchSize: 1, QueueSize: 2})
+
+	const requests = 50
+	start := time.Now()
+	for i := 0; i < requests; i++ {
+		tl.send(t, "", "")
+	}
+	// запросы не ждут экспорта, хотя коллектор завис
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected requests not to block on a stuck collector, took %v", elapsed)
+	}
+
+	close(release)
+	tl.shutdown(t)
+	// каждый запрос даёт несколько спанов, доходят только уже отправляемый и помещённые в очередь
+	if n := len(c.received()); n == 0 || n > 3 {
+		t.Errorf("Expected spans beyond the queue to be dropped, collector got %d", n)
+	}
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/server"
+)
+
+func TestLoadBalancerTransport(t *testing.T) {
+	// 1. Бэкенд, который не успевает прислать заголовки за response_header_timeout, получает 502
+	t.Run("Response header timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+		}))
+		defer slow.Close()
+
+		pool := backend.NewPool([]config.Backend{{URL: slow.URL, Transport: &config.Transport{
+			ResponseHeaderTimeout: 50 * time.Millisecond,
+		}}})
+		strategy, _ := balancer.New("RR", balancer.Options{})
+		srv := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+		defer srv.Close()
+
+		start := time.Now()
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("Expected 502, got %d", resp.StatusCode)
+		}
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("Expected the timeout to cut the request short, took %v", elapsed)
+		}
+	})
+
+	// 2. LC не отправляет запросы на сервер, упёршийся в max_conns, пока есть свободный
+	t.Run("LC skips busy backend", func(t *testing.T) {
+		release := make(chan struct{})
+		limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Header().Set("X-Backend", "limited")
+		}))
+		defer limited.Close()
+
+		var mu sync.Mutex
+		hits := 0
+		free := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits++
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond) // держим подключение, чтобы у свободного сервера их было больше
+			w.Header().Set("X-Backend", "free")
+		}))
+		defer free.Close()
+
+		pool := backend.NewPool([]config.Backend{
+			{URL: limited.URL, Transport: &config.Transport{MaxConns: 1}},
+			{URL: free.URL},
+		})
+		strategy, _ := balancer.New("LC", balancer.Options{})
+		srv := httptest.NewServer(http.HandlerFunc(server.NewLoadBalancer(8080, pool, strategy, nil).BalanceRequest))
+		defer srv.Close()
+		// первый запрос занимает единственное соединение limited
+		first := make(chan struct{})
+		go func() {
+			defer close(first)
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Errorf("First request failed: %v", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+		// отпускаем первый запрос и дожидаемся его ответа до остановки серверов
+		defer func() {
+			close(release)
+			<-first
+		}()
+		deadline := time.Now().Add(time.Second)
+		for pool.Backends()[0].GetActiveConnects() == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if !pool.Backends()[0].IsBusy() {
+			t.Fatal("Expected limited backend to be busy")
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := http.Get(srv.URL)
+				if err != nil {
+					t.Errorf("Request failed: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if got := resp.Header.Get("X-Backend"); got != "free" {
+					t.Errorf("Expected request on free backend, got %q", got)
+				}
+			}()
+		}
+		wg.Wait()
+		if hits != 5 {
+			t.Errorf("Expected 5 requests on free backend, got %d", hits)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/backend"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/metrics"
+	"loadbalancer/internal/ratelimiter/bucket"
+)
+
+// scrape - ответ /metrics: тип содержимого и тело
+func scrape(t *testing.T) (string, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+// lines - строки вывода метрики name (без HELP и TYPE)
+func lines(body, name string) []string {
+	var out []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, name) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func TestExpositionFormat(t *testing.T) {
+	counter := metrics.NewCounterVec("test_format_total", "Help with \\ and\nnewline.", "path", "code")
+	counter.Inc("/a", "200")
+	counter.Add(2.5, `/q"uote\`, "500")
+
+	contentType, body := scrape(t)
+	if contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	for _, want := range []string{
+		"# HELP test_format_total Help with \\\\ and\\nnewline.\n# TYPE test_format_total counter\n",
+		`test_format_total{path="/a",code="200"} 1` + "\n",
+		`test_format_total{path="/q\"uote\\",code="500"} 2.5` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in output:\n%s", want, body)
+		}
+	}
+	// серии отсортированы по меткам, чтобы вывод был стабильным
+	if got := lines(body, "test_format_total{"); len(got) != 2 || !strings.Contains(got[0], `path="/a"`) {
+		t.Errorf("Expected two sorted series, got %v", got)
+	}
+
+	metrics.NewGaugeFunc("test_format_gauge", "Gauge.", []string{"name"}, func(emit func(float64, ...string)) {
+		emit(3, "x")
+	})
+	if _, body := scrape(t); !strings.Contains(body, "# TYPE test_format_gauge gauge\ntest_format_gauge{name=\"x\"} 3\n") {
+		t.Errorf("Expected gauge series in output:\n%s", body)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	// границы сортируются, значение на границе попадает в её корзину (le - меньше или равно)
+	h := metrics.NewHistogramVec("test_histogram_seconds", "Histogram.", []float64{1, 0.1, 0.5}, "backend")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.5, 0.7, 2} {
+		h.Observe(v, "a")
+	}
+
+	_, body := scrape(t)
+	want := []string{
+		`test_histogram_seconds_bucket{backend="a",le="0.1"} 2`,
+		`test_histogram_seconds_bucket{backend="a",le="0.5"} 4`,
+		`test_histogram_seconds_bucket{backend="a",le="1"} 5`,
+		`test_histogram_seconds_bucket{backend="a",le="+Inf"} 6`,
+		`test_histogram_seconds_sum{backend="a"} 3.65`,
+		`test_histogram_seconds_count{backend="a"} 6`,
+	}
+	got := lines(body, "test_histogram_seconds_")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected histogram output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(body, "# TYPE test_histogram_seconds histogram\n") {
+		t.Error("Expected histogram TYPE line")
+	}
+}
+
+func TestDeleteLabelValue(t *testing.T) {
+	counter := metrics.NewCounterVec("test_delete_total", "Delete.", "backend", "code")
+	counter.Inc("a", "200")
+	counter.Inc("a", "500")
+	counter.Inc("b", "200")
+
+	if n := counter.DeleteLabelValue("backend", "a"); n != 2 {
+		t.Errorf("Expected 2 series deleted, got %d", n)
+	}
+	if n := counter.DeleteLabelValue("missing", "a"); n != 0 {
+		t.Errorf("Expected unknown label to delete nothing, got %d", n)
+	}
+	_, body := scrape(t)
+	if got := lines(body, "test_delete_total{"); len(got) != 1 || !strings.Contains(got[0], `backend="b"`) {
+		t.Errorf("Expected only backend b left, got %v", got)
+	}
+}
+
+func TestRemovedBackendSeries(t *testing.T) {
+	pool := backend.NewPool([]config.Backend{{URL: "http://127.0.0.1:18001"}, {URL: "http://127.0.0.1:18002"}})
+	pool.RegisterMetrics("test_removed")
+	metrics.RequestsTotal.Inc("http://127.0.0.1:18001", "200")
+	metrics.RequestsTotal.Inc("http://127.0.0.1:18002", "200")
+	metrics.RequestDuration.Observe(0.1, "http://127.0.0.1:18002", "200")
+
+	if _, err := pool.RemoveBackend("http://127.0.0.1:18002"); err != nil {
+		t.Fatalf("RemoveBackend failed: %v", err)
+	}
+	if err := pool.SyncBackends(nil); err != nil {
+		t.Fatalf("SyncBackends failed: %v", err)
+	}
+	_, body := scrape(t)
+	for _, url := range []string{"18001", "18002"} {
+		if strings.Contains(body, "http://127.0.0.1:"+url) {
+			t.Errorf("Expected series of removed backend %s to be deleted", url)
+		}
+	}
+}
+
+func TestRateLimitBucketsGauge(t *testing.T) {
+	cfg := &config.Config{RateLimit: config.RateLimit{
+		Enabled: true, CleanupInterval: time.Minute, Default: config.Limit{RequestsPerSec: 1, Burst: 1},
+	}}
+	bm1, bm2 := bucket.NewBucketManager(cfg), bucket.NewBucketManager(cfg)
+	bm1.Allow(bucket.Client{IP: "10.0.0.1"})
+	bm2.Allow(bucket.Client{IP: "10.0.0.2"})
+	bm2.Allow(bucket.Client{IP: "10.0.0.3"})
+
+	if _, body := scrape(t); !strings.Contains(body, "\nlb_rate_limit_buckets 3\n") {
+		t.Errorf("Expected buckets of both managers, got %v", lines(body, "lb_rate_limit_buckets"))
+	}
+	// остановленный менеджер больше не учитывается и не удерживается gauge-функцией
+	bm2.Stop()
+	if _, body := scrape(t); !strings.Contains(body, "\nlb_rate_limit_buckets 1\n") {
+		t.Errorf("Expected only running manager buckets, got %v", lines(body, "lb_rate_limit_buckets"))
+	}
+	bm1.Stop()
+}
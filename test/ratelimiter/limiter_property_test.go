@@ -0,0 +1,302 @@
+package ratelimiter
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/ratelimiter/bucket"
+)
+
+var algorithms = []string{
+	bucket.AlgorithmTokenBucket,
+	bucket.AlgorithmGCRA,
+	bucket.AlgorithmSlidingLog,
+	bucket.AlgorithmSlidingWindow,
+}
+
+// start - начало виртуального времени, все проверки идут по нему, а не по часам
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newLimiter(t *testing.T, algorithm string, rate, burst int) bucket.Limiter {
+	t.Helper()
+	l, err := bucket.NewLimiter(algorithm, rate, burst, start)
+	if err != nil {
+		t.Fatalf("NewLimiter(%s) failed: %v", algorithm, err)
+	}
+	return l
+}
+
+// randomArrivals - n запросов со случайными паузами: пачки подряд вперемешку с затишьями
+func randomArrivals(rnd *rand.Rand, n int, rate int) []time.Time {
+	arrivals := make([]time.Time, n)
+	now := start
+	mean := time.Second / time.Duration(rate)
+	for i := range arrivals {
+		switch rnd.Intn(4) {
+		case 0: // та же наносекунда - пачка
+		case 1:
+			now = now.Add(time.Duration(rnd.Int63n(int64(mean) * 10)))
+		default:
+			now = now.Add(time.Duration(rnd.Int63n(int64(mean)/2 + 1)))
+		}
+		arrivals[i] = now
+	}
+	return arrivals
+}
+
+// allowedTimes - моменты пропущенных запросов
+func allowedTimes(l bucket.Limiter, arrivals []time.Time) []time.Time {
+	var allowed []time.Time
+	for _, at := range arrivals {
+		if l.AllowAt(at).Allowed {
+			allowed = append(allowed, at)
+		}
+	}
+	return allowed
+}
+
+// maxInWindow - наибольшее число пропущенных запросов в окне (t-w, t]
+func maxInWindow(allowed []time.Time, w time.Duration) int {
+	best := 0
+	for i := range allowed {
+		j := sort.Search(i+1, func(j int) bool { return allowed[j].After(allowed[i].Add(-w)) })
+		best = max(best, i-j+1)
+	}
+	return best
+}
+
+// TestLimiterNeverExceedsRate - при любом порядке запросов бакетные алгоритмы пропускают на любом отрезке
+// не больше burst + rate*длина, а скользящие - не больше burst (журнал) и 2*burst (счётчики) в любом окне
+func TestLimiterNeverExceedsRate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for iteration := 0; iteration < 50; iteration++ {
+		rate := 1 + rnd.Intn(50)
+		burst := 1 + rnd.Intn(20)
+		arrivals := randomArrivals(rnd, 400, rate)
+		w := time.Duration(float64(burst) / float64(rate) * float64(time.Second))
+
+		for _, algorithm := range algorithms {
+			allowed := allowedTimes(newLimiter(t, algorithm, rate, burst), arrivals)
+
+			switch algorithm {
+			case bucket.AlgorithmTokenBucket, bucket.AlgorithmGCRA:
+				for i := range allowed {
+					for j := i; j < len(allowed); j++ {
+						limit := float64(burst) + float64(rate)*allowed[j].Sub(allowed[i]).Seconds() + 1e-6
+						if float64(j-i+1) > limit {
+							t.Fatalf("%s rate=%d burst=%d: %d requests allowed in %v, limit %.2f",
+								algorithm, rate, burst, j-i+1, allowed[j].Sub(allowed[i]), limit)
+						}
+					}
+				}
+			case bucket.AlgorithmSlidingLog:
+				if got := maxInWindow(allowed, w); got > burst {
+					t.Fatalf("%s rate=%d burst=%d: %d requests in one window, limit %d", algorithm, rate, burst, got, burst)
+				}
+			case bucket.AlgorithmSlidingWindow:
+				if got := maxInWindow(allowed, w); got > 2*burst {
+					t.Fatalf("%s rate=%d burst=%d: %d requests in one window, limit %d", algorithm, rate, burst, got, 2*burst)
+				}
+			}
+		}
+	}
+}
+
+// TestLimiterThroughput - при постоянной перегрузке все алгоритмы в среднем пропускают rate запросов в секунду
+func TestLimiterThroughput(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for iteration := 0; iteration < 20; iteration++ {
+		// burst от 2: при burst 1 бакет обрезает дробный остаток токена, и шаг запросов съедает часть скорости
+		rate := 1 + rnd.Intn(100)
+		burst := 2 + rnd.Intn(20)
+		duration := 60 * time.Second
+		step := time.Second / time.Duration(rate*10) // в 10 раз чаще лимита
+
+		for _, algorithm := range algorithms {
+			l := newLimiter(t, algorithm, rate, burst)
+			allowed := 0
+			for at := start; at.Before(start.Add(duration)); at = at.Add(step) {
+				if l.AllowAt(at).Allowed {
+					allowed++
+				}
+			}
+
+			want := float64(burst) + float64(rate)*duration.Seconds()
+			tolerance := 0.02 // бакетные алгоритмы точны до запроса
+			switch algorithm {
+			case bucket.AlgorithmSlidingLog:
+				tolerance = 0.1 // окно считается от отметок запросов, шаг запросов съедает часть окна
+			case bucket.AlgorithmSlidingWindow:
+				tolerance = 0.15 // плюс оценка предыдущего окна в предположении равномерного трафика
+			}
+			if diff := (float64(allowed) - want) / want; diff > tolerance || diff < -tolerance-0.01 {
+				t.Errorf("%s rate=%d burst=%d: allowed %d in %v, want about %.0f", algorithm, rate, burst, allowed, duration, want)
+			}
+		}
+	}
+}
+
+// TestLimiterLowRateDoesNotStarve - частые запросы при низкой скорости не обнуляют пополнение
+// (раньше int(elapsed*rate) округлялся до нуля, а время последней проверки всё равно сдвигалось)
+func TestLimiterLowRateDoesNotStarve(t *testing.T) {
+	for _, algorithm := range algorithms {
+		l := newLimiter(t, algorithm, 1, 2)
+		allowed := 0
+		for at := start; at.Before(start.Add(60 * time.Second)); at = at.Add(300 * time.Millisecond) {
+			if l.AllowAt(at).Allowed {
+				allowed++
+			}
+		}
+		// бакетные алгоритмы копят дробные токены - 1 в секунду плюс всплеск; скользящим окнам
+		// нужно целое окно после прошлых запросов, а запросы приходят с шагом 0.3 с
+		want := 61
+		if algorithm == bucket.AlgorithmSlidingLog || algorithm == bucket.AlgorithmSlidingWindow {
+			want = 50
+		}
+		if allowed < want || allowed > 62 {
+			t.Errorf("%s: allowed %d of 200 requests in 60s at 1 rps, want at least %d", algorithm, allowed, want)
+		}
+	}
+}
+
+// TestLimiterCapacityAfterIdle - после долгого простоя всплеск не больше burst (бакет не переполняется)
+func TestLimiterCapacityAfterIdle(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	for iteration := 0; iteration < 20; iteration++ {
+		rate := 1 + rnd.Intn(100)
+		burst := 1 + rnd.Intn(50)
+		for _, algorithm := range algorithms {
+			l := newLimiter(t, algorithm, rate, burst)
+			l.AllowAt(start)
+			idle := start.Add(time.Hour + time.Duration(rnd.Int63n(int64(time.Hour))))
+			allowed := 0
+			for i := 0; i < burst*3; i++ {
+				if l.AllowAt(idle).Allowed {
+					allowed++
+				}
+			}
+			if allowed != burst {
+				t.Errorf("%s rate=%d burst=%d: allowed %d at once after idle, want %d", algorithm, rate, burst, allowed, burst)
+			}
+		}
+	}
+}
+
+func TestLimiterUnknownAlgorithm(t *testing.T) {
+	if _, err := bucket.NewLimiter("leaky", 1, 1, start); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+// TestLimiterDecisionIsTruthful - после отказа клиент, повторивший запрос через Reset (Retry-After), проходит
+func TestLimiterDecisionIsTruthful(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	for iteration := 0; iteration < 50; iteration++ {
+		rate := 1 + rnd.Intn(50)
+		burst := 1 + rnd.Intn(20)
+		arrivals := randomArrivals(rnd, 200, rate)
+
+		for _, algorithm := range algorithms {
+			l := newLimiter(t, algorithm, rate, burst)
+			for _, at := range arrivals {
+				d := l.AllowAt(at)
+				if d.Limit != burst || d.Remaining < 0 || d.Remaining > burst || d.Reset < 0 {
+					t.Fatalf("%s rate=%d burst=%d: inconsistent decision %+v", algorithm, rate, burst, d)
+				}
+				if d.Allowed {
+					continue
+				}
+				if d.Remaining != 0 || d.Reset == 0 {
+					t.Fatalf("%s rate=%d burst=%d: denied with %+v", algorithm, rate, burst, d)
+				}
+				// проверяем первый отказ: дальше время у повтора и у следующих запросов пошло бы в разные стороны
+				retry := at.Add(d.Reset)
+				if next := l.AllowAt(retry); !next.Allowed {
+					t.Fatalf("%s rate=%d burst=%d: denied again %v after Retry-After %v: %+v", algorithm, rate, burst, retry.Sub(at), d.Reset, next)
+				}
+				break
+			}
+		}
+	}
+}
+
+// TestLimiterRemainingIsAllowed - Remaining запросов в тот же момент действительно проходят
+func TestLimiterRemainingIsAllowed(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	for iteration := 0; iteration < 50; iteration++ {
+		rate := 1 + rnd.Intn(50)
+		burst := 1 + rnd.Intn(20)
+		arrivals := randomArrivals(rnd, 50, rate)
+
+		for _, algorithm := range algorithms {
+			l := newLimiter(t, algorithm, rate, burst)
+			var d bucket.Decision
+			for _, at := range arrivals {
+				d = l.AllowAt(at)
+			}
+			at := arrivals[len(arrivals)-1]
+			for i := 0; i < d.Remaining; i++ {
+				if !l.AllowAt(at).Allowed {
+					t.Fatalf("%s rate=%d burst=%d: request %d of remaining %d denied", algorithm, rate, burst, i+1, d.Remaining)
+				}
+			}
+		}
+	}
+}
+
+// TestSlidingLogGrowsToBurst - журнал sliding_log выделяется небольшим и растёт по мере запросов,
+// в том числе когда самые старые отметки уже вышли из окна и буфер прокручен
+func TestSlidingLogGrowsToBurst(t *testing.T) {
+	l := newLimiter(t, bucket.AlgorithmSlidingLog, 10, 100) // окно 10s
+	allowedAt := func(at time.Time, n int) (allowed int, last bucket.Decision) {
+		for i := 0; i < n; i++ {
+			if last = l.AllowAt(at); last.Allowed {
+				allowed++
+			}
+		}
+		return allowed, last
+	}
+
+	// по 10 запросов в секунду: в окне никогда не больше 100, пропускаются все
+	for sec := 0; sec < 30; sec++ {
+		if allowed, _ := allowedAt(start.Add(time.Duration(sec)*time.Second), 10); allowed != 10 {
+			t.Fatalf("Second %d: expected all 10 requests allowed, got %d", sec, allowed)
+		}
+	}
+	// в окне (20s, 30s] уже 90 отметок: пропускаются ещё 10, следующая освободится, когда выйдут отметки 21-й секунды
+	allowed, last := allowedAt(start.Add(30*time.Second), 50)
+	if allowed != 10 || last.Remaining != 0 || last.Reset != time.Second {
+		t.Errorf("Expected 10 more allowed with reset 1s, got %d and %+v", allowed, last)
+	}
+}
+
+func TestSlidingLogMemoryValidation(t *testing.T) {
+	newConfig := func(burst, maxBuckets int) *config.Config {
+		return &config.Config{RateLimit: config.RateLimit{
+			Algorithm:  bucket.AlgorithmSlidingLog,
+			Default:    config.Limit{RequestsPerSec: 100, Burst: 200},
+			Tiers:      []config.Tier{{Name: "big", Limit: config.Limit{RequestsPerSec: 100, Burst: burst}}},
+			MaxBuckets: maxBuckets,
+		}}
+	}
+	// 200 отметок по 24 байта на 100000 бакетов - около 460 МБ
+	if err := bucket.Validate(newConfig(200, 0)); err != nil {
+		t.Errorf("Expected sample burst 200 to be valid, got %v", err)
+	}
+	// 10000 отметок на 100000 бакетов - больше 20 ГБ
+	if err := bucket.Validate(newConfig(10000, 0)); err == nil {
+		t.Error("Expected sliding_log burst 10000 with default max_buckets to be rejected")
+	}
+	if err := bucket.Validate(newConfig(10000, 1000)); err != nil {
+		t.Errorf("Expected burst 10000 with max_buckets 1000 to be valid, got %v", err)
+	}
+	// sliding_window хранит два счётчика при любом burst
+	cfg := newConfig(10000, 0)
+	cfg.RateLimit.Tiers[0].Limit.Algorithm = bucket.AlgorithmSlidingWindow
+	if err := bucket.Validate(cfg); err != nil {
+		t.Errorf("Expected sliding_window with large burst to be valid, got %v", err)
+	}
+}